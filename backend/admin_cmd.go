@@ -0,0 +1,349 @@
+package main
+
+import (
+	"auto-grad-backend/internal/api"
+	"auto-grad-backend/internal/config"
+	"auto-grad-backend/internal/db"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const adminUsage = `usage: auto-grad-backend [-config file] admin <group> <command> [flags]
+
+users:
+  list            [-role r]                          列出用户
+  create          -username u -role r [-name n] [-email e] [-password p]
+                                                     创建用户，未给出 -password 时生成随机密码
+  disable         -username u -role r                停用账号，停用后无法登录
+  enable          -username u -role r                重新启用账号
+  reset-password  -username u -role r [-password p]  重置密码，未给出 -password 时生成随机密码
+  set-role        -username u -role r -to r2         修改角色，名下的改卷等记录一并转移
+  unlock          -username u -role r                解除登录失败导致的锁定
+
+gradings:
+  requeue         [-status s1,s2] [id ...]           把失败或额度不足的改卷重新排队，服务启动时继续处理
+  purge           -older-than d [-status s1,s2] [-dry-run]
+                                                     删除早于 d 提交的已结束改卷及其图片
+
+角色：parent、teacher、admin`
+
+var userRoles = []string{"parent", "teacher", "admin"}
+
+// runAdminCommand 处理 admin 子命令，返回进程退出码
+func runAdminCommand(cfg *config.Config, args []string) int {
+	if len(args) < 2 {
+		fmt.Fprintln(os.Stderr, adminUsage)
+		return 2
+	}
+	var run func(ctx context.Context, pool *pgxpool.Pool, cfg *config.Config, args []string) error
+	switch args[0] + " " + args[1] {
+	case "users list":
+		run = adminListUsers
+	case "users create":
+		run = adminCreateUser
+	case "users disable":
+		run = func(ctx context.Context, pool *pgxpool.Pool, cfg *config.Config, args []string) error {
+			return adminSetDisabled(ctx, pool, args, true)
+		}
+	case "users enable":
+		run = func(ctx context.Context, pool *pgxpool.Pool, cfg *config.Config, args []string) error {
+			return adminSetDisabled(ctx, pool, args, false)
+		}
+	case "users reset-password":
+		run = adminResetPassword
+	case "users set-role":
+		run = adminSetRole
+	case "users unlock":
+		run = adminUnlock
+	case "gradings requeue":
+		run = adminRequeue
+	case "gradings purge":
+		run = adminPurge
+	default:
+		fmt.Fprintln(os.Stderr, adminUsage)
+		return 2
+	}
+
+	pool, err := db.Connect(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer pool.Close()
+	ctx := context.Background()
+	if err := requireMigrated(ctx, pool); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	err = run(ctx, pool, cfg, args[2:])
+	if errors.Is(err, flag.ErrHelp) || errors.Is(err, errUsage) {
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// errUsage 表示参数错误，具体原因已输出
+var errUsage = errors.New("usage error")
+
+// requireMigrated 管理命令依赖最新的表结构，有未执行的迁移时拒绝运行
+func requireMigrated(ctx context.Context, pool *pgxpool.Pool) error {
+	states, err := db.MigrationStatus(ctx, pool)
+	if err != nil {
+		return err
+	}
+	for _, s := range states {
+		if !s.Applied {
+			return fmt.Errorf("migration %04d_%s is pending, run `migrate up` first", s.Version, s.Name)
+		}
+	}
+	return nil
+}
+
+// userFlags 是针对单个用户的命令共用的参数
+type userFlags struct {
+	*flag.FlagSet
+	username string
+	role     string
+}
+
+func newUserFlags(name string) *userFlags {
+	f := &userFlags{FlagSet: flag.NewFlagSet(name, flag.ContinueOnError)}
+	f.StringVar(&f.username, "username", "", "用户名（登录账号）")
+	f.StringVar(&f.role, "role", "", "角色："+strings.Join(userRoles, "、"))
+	return f
+}
+
+func (f *userFlags) parse(args []string) error {
+	if err := f.Parse(args); err != nil {
+		return err
+	}
+	if f.username == "" || f.role == "" {
+		fmt.Fprintln(os.Stderr, "-username and -role are required")
+		return errUsage
+	}
+	return checkRole(f.role)
+}
+
+func checkRole(role string) error {
+	for _, r := range userRoles {
+		if role == r {
+			return nil
+		}
+	}
+	fmt.Fprintf(os.Stderr, "invalid role %q, must be one of %s\n", role, strings.Join(userRoles, ", "))
+	return errUsage
+}
+
+// generatePassword 生成 16 位随机密码
+func generatePassword() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func adminListUsers(ctx context.Context, pool *pgxpool.Pool, _ *config.Config, args []string) error {
+	f := flag.NewFlagSet("users list", flag.ContinueOnError)
+	role := f.String("role", "", "只列出该角色的用户")
+	if err := f.Parse(args); err != nil {
+		return err
+	}
+	users, err := api.NewUserStore(pool).List(ctx, *role)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "USERNAME\tROLE\tNAME\tEMAIL\tSTATUS\tCREATED AT")
+	for _, u := range users {
+		status := "active"
+		if u.Disabled {
+			status = "disabled"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", u.Username, u.Role, u.Name, u.Email, status, u.CreatedAt)
+	}
+	return w.Flush()
+}
+
+func adminCreateUser(ctx context.Context, pool *pgxpool.Pool, _ *config.Config, args []string) error {
+	f := newUserFlags("users create")
+	name := f.String("name", "", "显示名称，默认与用户名相同")
+	email := f.String("email", "", "邮箱")
+	password := f.String("password", "", "初始密码，默认生成随机密码")
+	if err := f.parse(args); err != nil {
+		return err
+	}
+	pw, generated, err := passwordOrGenerate(*password)
+	if err != nil {
+		return err
+	}
+	user := api.User{
+		Username: f.username,
+		Password: pw,
+		Role:     f.role,
+		Name:     *name,
+		Email:    *email,
+	}
+	if user.Name == "" {
+		user.Name = user.Username
+	}
+	if err := api.NewUserStore(pool).Create(ctx, user); err != nil {
+		return err
+	}
+	fmt.Printf("created %s/%s\n", f.role, f.username)
+	if generated {
+		fmt.Printf("password: %s\n", pw)
+	}
+	return nil
+}
+
+func adminSetDisabled(ctx context.Context, pool *pgxpool.Pool, args []string, disabled bool) error {
+	name, verb := "users enable", "enabled"
+	if disabled {
+		name, verb = "users disable", "disabled"
+	}
+	f := newUserFlags(name)
+	if err := f.parse(args); err != nil {
+		return err
+	}
+	if err := api.NewUserStore(pool).SetDisabled(ctx, f.username, f.role, disabled); err != nil {
+		return err
+	}
+	fmt.Printf("%s %s/%s\n", verb, f.role, f.username)
+	return nil
+}
+
+func adminResetPassword(ctx context.Context, pool *pgxpool.Pool, _ *config.Config, args []string) error {
+	f := newUserFlags("users reset-password")
+	password := f.String("password", "", "新密码，默认生成随机密码")
+	if err := f.parse(args); err != nil {
+		return err
+	}
+	pw, generated, err := passwordOrGenerate(*password)
+	if err != nil {
+		return err
+	}
+	if err := api.NewUserStore(pool).SetPassword(ctx, f.username, f.role, pw); err != nil {
+		return err
+	}
+	fmt.Printf("password reset for %s/%s\n", f.role, f.username)
+	if generated {
+		fmt.Printf("password: %s\n", pw)
+	}
+	return nil
+}
+
+func adminSetRole(ctx context.Context, pool *pgxpool.Pool, _ *config.Config, args []string) error {
+	f := newUserFlags("users set-role")
+	to := f.String("to", "", "新角色")
+	if err := f.parse(args); err != nil {
+		return err
+	}
+	if err := checkRole(*to); err != nil {
+		return err
+	}
+	if *to == f.role {
+		fmt.Fprintln(os.Stderr, "-to must differ from -role")
+		return errUsage
+	}
+	if err := api.NewUserStore(pool).ChangeRole(ctx, f.username, f.role, *to); err != nil {
+		return err
+	}
+	fmt.Printf("changed %s from %s to %s\n", f.username, f.role, *to)
+	return nil
+}
+
+func adminUnlock(ctx context.Context, pool *pgxpool.Pool, _ *config.Config, args []string) error {
+	f := newUserFlags("users unlock")
+	if err := f.parse(args); err != nil {
+		return err
+	}
+	if err := api.NewRateLimitStore(pool).UnlockLogin(ctx, f.username, f.role); err != nil {
+		return err
+	}
+	fmt.Printf("unlocked %s/%s\n", f.role, f.username)
+	return nil
+}
+
+func passwordOrGenerate(password string) (string, bool, error) {
+	if password != "" {
+		return password, false, nil
+	}
+	pw, err := generatePassword()
+	return pw, true, err
+}
+
+func adminRequeue(ctx context.Context, pool *pgxpool.Pool, _ *config.Config, args []string) error {
+	f := flag.NewFlagSet("gradings requeue", flag.ContinueOnError)
+	status := f.String("status", "failed,quota_exceeded", "要重新排队的状态，逗号分隔；processing 仅在服务全部停止时使用")
+	if err := f.Parse(args); err != nil {
+		return err
+	}
+	ids, err := api.NewGradingStore(pool).Requeue(ctx, splitList(*status), f.Args())
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		fmt.Println(id)
+	}
+	fmt.Fprintf(os.Stderr, "requeued %d gradings; they are processed when the server next starts\n", len(ids))
+	return nil
+}
+
+func adminPurge(ctx context.Context, pool *pgxpool.Pool, cfg *config.Config, args []string) error {
+	f := flag.NewFlagSet("gradings purge", flag.ContinueOnError)
+	olderThan := f.Duration("older-than", 0, "只删除提交时间早于该时长之前的改卷，如 2160h（90 天）")
+	status := f.String("status", "", "只删除这些状态的改卷，逗号分隔，默认为全部已结束状态")
+	dryRun := f.Bool("dry-run", false, "只列出将被删除的改卷")
+	if err := f.Parse(args); err != nil {
+		return err
+	}
+	if *olderThan <= 0 {
+		fmt.Fprintln(os.Stderr, "-older-than is required")
+		return errUsage
+	}
+	items, err := api.NewGradingStore(pool).Purge(ctx, api.PurgeFilter{
+		Before:   time.Now().Add(-*olderThan),
+		Statuses: splitList(*status),
+		DryRun:   *dryRun,
+	}, cfg.Storage.UploadDir)
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSTATUS\tOWNER\tSUBMITTED AT")
+	for _, g := range items {
+		fmt.Fprintf(w, "%s\t%s\t%s/%s\t%s\n", g.ID, g.Status, g.OwnerRole, g.OwnerUsername, g.SubmitTime)
+	}
+	_ = w.Flush()
+	if err != nil {
+		return err
+	}
+	verb := "purged"
+	if *dryRun {
+		verb = "would purge"
+	}
+	fmt.Fprintf(os.Stderr, "%s %d gradings\n", verb, len(items))
+	return nil
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
@@ -0,0 +1,433 @@
+// autograd 是离线批量阅卷工具：对目录或通配符匹配的试卷图片做 OCR 与 AI 评分，
+// 与服务端共用同一套识别、评分、限速与重试实现
+package main
+
+import (
+	"auto-grad-backend/internal/config"
+	"auto-grad-backend/internal/services"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/joho/godotenv"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode/utf8"
+)
+
+const usage = `usage: autograd [flags] [dir|file|glob ...]
+
+对试卷图片批量 OCR 并评分，默认处理 ./papers。结果写入 -out 指定的文件（.json 或 .csv），
+每完成一张即追加到检查点文件；中断后以相同参数重新运行会跳过已成功的图片、重试失败的图片。
+
+flags:`
+
+// 支持的图片扩展名，与上传接口一致
+var imageExts = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".bmp": true}
+
+// 未指定 -rubric 时依次在输入目录中查找的评分标准文件
+var rubricFiles = []string{"rubric.txt", "rubric.md"}
+
+type options struct {
+	subject         string
+	rubric          string
+	concurrency     int
+	out             string
+	format          string
+	checkpoint      string
+	doublePass      bool
+	reviewThreshold float64
+}
+
+func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	flags := flag.NewFlagSet("autograd", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, usage)
+		flags.PrintDefaults()
+	}
+	configPath := flags.String("config", "", "配置文件路径（.yaml/.yml/.toml），默认读取 CONFIG_FILE")
+	rubricPath := flags.String("rubric", "", "评分标准文件，默认使用输入目录下的 rubric.txt 或 rubric.md")
+	var opts options
+	flags.StringVar(&opts.subject, "subject", "通用", "科目名称，写入评分提示词")
+	flags.IntVar(&opts.concurrency, "concurrency", 2, "同时处理的图片数，实际调用仍受配置中的限速约束")
+	flags.StringVar(&opts.out, "out", "results.json", "结果文件")
+	flags.StringVar(&opts.format, "format", "", "输出格式 json 或 csv，默认按 -out 的扩展名推断")
+	flags.StringVar(&opts.checkpoint, "checkpoint", "", "检查点文件，默认为 <out>.checkpoint.jsonl")
+	doublePass := flags.Bool("double-pass", false, "每张试卷评分两次，用分差衡量一致性，默认取配置 grading.double_pass")
+	reviewThreshold := flags.Float64("review-threshold", 0, "综合置信度低于该值时标记为待复核，默认取配置 grading.review_threshold")
+	if err := flags.Parse(os.Args[1:]); err != nil {
+		return 2
+	}
+
+	_ = godotenv.Load(".env")
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	// 命令行显式给出的值优先于配置
+	opts.doublePass = cfg.Grading.DoublePass
+	opts.reviewThreshold = cfg.Grading.ReviewThreshold
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "double-pass":
+			opts.doublePass = *doublePass
+		case "review-threshold":
+			opts.reviewThreshold = *reviewThreshold
+		}
+	})
+
+	if opts.concurrency < 1 {
+		fmt.Fprintln(os.Stderr, "-concurrency must be at least 1")
+		return 2
+	}
+	if opts.format == "" {
+		opts.format = strings.TrimPrefix(strings.ToLower(filepath.Ext(opts.out)), ".")
+	}
+	if opts.format != "json" && opts.format != "csv" {
+		fmt.Fprintf(os.Stderr, "unsupported output format %q, use -format json or csv\n", opts.format)
+		return 2
+	}
+	if opts.checkpoint == "" {
+		opts.checkpoint = opts.out + ".checkpoint.jsonl"
+	}
+
+	inputs := flags.Args()
+	if len(inputs) == 0 {
+		inputs = []string{"./papers"}
+	}
+	files, err := collectImages(inputs)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if len(files) == 0 {
+		fmt.Fprintf(os.Stderr, "no images (%s) found in %s\n", strings.Join(sortedExts(), ", "), strings.Join(inputs, " "))
+		return 1
+	}
+	opts.rubric, err = loadRubric(*rubricPath, inputs)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	g := newGrader(cfg, opts)
+	if !g.ocr.Configured() || !g.scorer.Configured() {
+		fmt.Fprintln(os.Stderr, "BAIDU_API_KEY, BAIDU_SECRET_KEY and DEEPSEEK_API_KEY are required")
+		return 1
+	}
+
+	done, err := loadCheckpoint(opts.checkpoint)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	cp, err := openCheckpoint(opts.checkpoint)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer cp.Close()
+
+	// 第一次中断时停止派发并等待在途的图片，未完成的不写检查点，下次运行重试
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	results := g.gradeAll(ctx, files, done, cp)
+	if err := writeResults(opts.out, opts.format, results); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	printSummary(os.Stdout, results, g.prices.Currency)
+	fmt.Fprintf(os.Stderr, "results written to %s\n", opts.out)
+
+	if ctx.Err() != nil {
+		fmt.Fprintf(os.Stderr, "interrupted, rerun with the same flags to resume from %s\n", opts.checkpoint)
+		return 130
+	}
+	for _, r := range results {
+		if r.Status == statusFailed {
+			return 1
+		}
+	}
+	return 0
+}
+
+// collectImages 展开目录与通配符，按路径排序去重；直接给出的文件不检查扩展名
+func collectImages(inputs []string) ([]string, error) {
+	seen := map[string]bool{}
+	var files []string
+	add := func(path string) {
+		if !seen[path] {
+			seen[path] = true
+			files = append(files, path)
+		}
+	}
+	for _, in := range inputs {
+		matches, err := filepath.Glob(in)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", in, err)
+		}
+		if matches == nil {
+			if strings.ContainsAny(in, "*?[") {
+				return nil, fmt.Errorf("no files match %q", in)
+			}
+			if _, err := os.Stat(in); err != nil {
+				return nil, err
+			}
+			matches = []string{in}
+		}
+		for _, m := range matches {
+			info, err := os.Stat(m)
+			if err != nil {
+				return nil, err
+			}
+			if !info.IsDir() {
+				if m == in || isImage(m) {
+					add(m)
+				}
+				continue
+			}
+			entries, err := os.ReadDir(m)
+			if err != nil {
+				return nil, err
+			}
+			for _, e := range entries {
+				if !e.IsDir() && isImage(e.Name()) {
+					add(filepath.Join(m, e.Name()))
+				}
+			}
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func isImage(name string) bool {
+	return imageExts[strings.ToLower(filepath.Ext(name))]
+}
+
+func sortedExts() []string {
+	exts := make([]string, 0, len(imageExts))
+	for ext := range imageExts {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+	return exts
+}
+
+// loadRubric 读取评分标准；未指定时在第一个输入目录中查找，找不到则不使用评分标准
+func loadRubric(path string, inputs []string) (string, error) {
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("read rubric: %w", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	for _, in := range inputs {
+		if info, err := os.Stat(in); err != nil || !info.IsDir() {
+			continue
+		}
+		for _, name := range rubricFiles {
+			data, err := os.ReadFile(filepath.Join(in, name))
+			if err == nil {
+				return strings.TrimSpace(string(data)), nil
+			}
+			if !errors.Is(err, os.ErrNotExist) {
+				return "", fmt.Errorf("read rubric: %w", err)
+			}
+		}
+		break
+	}
+	return "", nil
+}
+
+// gate 与服务端的调用关口一致：熔断与重试包住每次尝试，每次尝试重新申请限速名额。
+// 离线工具不经过数据库，没有每日额度
+type gate struct {
+	limiter *services.ProviderLimiter
+	breaker *services.CircuitBreaker
+	retry   services.RetryPolicy
+}
+
+func newGate(limits config.ProviderLimits, res config.ResilienceConfig) *gate {
+	return &gate{
+		limiter: services.NewProviderLimiter(limits.QPS, limits.Burst, limits.Concurrency),
+		breaker: services.NewCircuitBreaker(res.BreakerThreshold, res.BreakerCooldown),
+		retry: services.RetryPolicy{
+			MaxAttempts: res.MaxAttempts,
+			BaseDelay:   res.RetryBaseDelay,
+			MaxDelay:    res.RetryMaxDelay,
+		},
+	}
+}
+
+func (g *gate) call(ctx context.Context, fn func(ctx context.Context) error) error {
+	return g.retry.Do(ctx, g.breaker, func(ctx context.Context) error {
+		release, err := g.limiter.Acquire(ctx)
+		if err != nil {
+			return err
+		}
+		defer release()
+		return fn(ctx)
+	})
+}
+
+type grader struct {
+	opts         options
+	ocr          *services.BaiduOCRService
+	scorer       *services.DeepSeekService
+	baidu        *gate
+	deepSeek     *gate
+	prices       services.PriceTable
+	ocrTimeout   time.Duration
+	scoreTimeout time.Duration
+}
+
+func newGrader(cfg *config.Config, opts options) *grader {
+	prices, err := services.ParsePriceTable(cfg.DeepSeek.Prices)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "LLM_PRICES ignored: %v\n", err)
+	}
+	return &grader{
+		opts:         opts,
+		ocr:          services.NewBaiduOCRService(services.NewBaiduTokenCache(cfg.Baidu.APIKey, cfg.Baidu.SecretKey)),
+		scorer:       services.NewDeepSeekService(cfg.DeepSeek.APIKey, cfg.DeepSeek.BaseURL),
+		baidu:        newGate(cfg.Baidu.Limits, cfg.Resilience),
+		deepSeek:     newGate(cfg.DeepSeek.Limits, cfg.Resilience),
+		prices:       prices,
+		ocrTimeout:   cfg.Grading.OCRTimeout,
+		scoreTimeout: cfg.Grading.ScoreTimeout,
+	}
+}
+
+// gradeAll 按文件顺序返回结果；检查点中已成功的图片直接复用，ctx 取消后未开始的图片不出现在结果中
+func (g *grader) gradeAll(ctx context.Context, files []string, done map[string]Result, cp *checkpoint) []Result {
+	results := make([]*Result, len(files))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	finished := 0
+	for w := 0; w < g.opts.concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				r := g.gradeFile(ctx, files[i], done)
+				if r.Status == statusFailed && ctx.Err() != nil {
+					continue
+				}
+				mu.Lock()
+				results[i] = &r
+				finished++
+				fmt.Fprintf(os.Stderr, "[%d/%d] %s\n", finished, len(files), r.progressLine())
+				if !r.Resumed {
+					if err := cp.append(r); err != nil {
+						fmt.Fprintf(os.Stderr, "write checkpoint: %v\n", err)
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+dispatch:
+	for i := range files {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	out := make([]Result, 0, len(files))
+	for _, r := range results {
+		if r != nil {
+			out = append(out, *r)
+		}
+	}
+	return out
+}
+
+// gradeFile 与服务端流水线相同：OCR、评分、可选的第二次评分，综合置信度低于阈值时标记待复核
+func (g *grader) gradeFile(ctx context.Context, path string, done map[string]Result) Result {
+	r := Result{File: path}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return r.fail("读取图片失败", err)
+	}
+	sum := sha256.Sum256(data)
+	r.SHA256 = hex.EncodeToString(sum[:])
+	if prev, ok := done[r.SHA256]; ok {
+		prev.File = path
+		prev.Resumed = true
+		return prev
+	}
+
+	ocrCtx, cancelOCR := context.WithTimeout(ctx, g.ocrTimeout)
+	var ocr services.OCRResult
+	err = g.baidu.call(ocrCtx, func(ctx context.Context) error {
+		var err error
+		ocr, err = g.ocr.Recognize(ctx, data)
+		return err
+	})
+	cancelOCR()
+	if err != nil {
+		return r.fail("OCR 识别失败", err)
+	}
+	r.Answer = ocr.Text
+	r.Chars = utf8.RuneCountInString(ocr.Text)
+	r.OCRConfidence = ocr.Confidence
+
+	scoreCtx, cancelScore := context.WithTimeout(ctx, g.scoreTimeout)
+	defer cancelScore()
+	score := func() (services.ScoreResult, error) {
+		var result services.ScoreResult
+		err := g.deepSeek.call(scoreCtx, func(ctx context.Context) error {
+			var err error
+			result, err = g.scorer.Score(ctx, g.opts.subject, ocr.Text, g.opts.rubric)
+			return err
+		})
+		if err == nil {
+			r.Usage.Add(result.Usage)
+		}
+		return result, err
+	}
+	result, err := score()
+	if err != nil {
+		return r.fail("DeepSeek 评分失败", err)
+	}
+	passConfidence := 1.0
+	if g.opts.doublePass {
+		second, err := score()
+		if err != nil {
+			return r.fail("DeepSeek 评分失败", err)
+		}
+		passConfidence = services.PassAgreement(result.Score, second.Score)
+	}
+
+	r.Score = result.Score
+	r.Feedback = result.Feedback
+	r.Confidence = services.CombineConfidence(ocr.Confidence, result.Confidence, passConfidence)
+	r.Status = statusCompleted
+	if r.Confidence < g.opts.reviewThreshold {
+		r.Status = statusNeedsReview
+	}
+	r.Cost, _ = g.prices.Cost(services.DeepSeekChatModel, r.Usage)
+	r.GradedAt = time.Now().Format(time.RFC3339)
+	return r
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"auto-grad-backend/internal/logging"
+	"auto-grad-backend/internal/services"
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"unicode/utf8"
+)
+
+// 状态取值与服务端 gradings.status 一致
+const (
+	statusCompleted   = "completed"
+	statusNeedsReview = "needs_review"
+	statusFailed      = "failed"
+)
+
+// Result 是单张试卷的评分结果，同时作为检查点与 JSON 输出的记录格式
+type Result struct {
+	File          string              `json:"file"`
+	SHA256        string              `json:"sha256"`
+	Status        string              `json:"status"`
+	Score         int                 `json:"score"`
+	Confidence    float64             `json:"confidence"`
+	OCRConfidence float64             `json:"ocrConfidence"`
+	Chars         int                 `json:"chars"`
+	Feedback      string              `json:"feedback,omitempty"`
+	Answer        string              `json:"answer,omitempty"`
+	Usage         services.TokenUsage `json:"usage"`
+	Cost          float64             `json:"cost"`
+	Error         string              `json:"error,omitempty"`
+	GradedAt      string              `json:"gradedAt,omitempty"`
+	// 本次运行从检查点复用，不再写回检查点
+	Resumed bool `json:"-"`
+}
+
+// fail 记录失败原因；错误信息可能带有请求地址中的 access_token，先脱敏
+func (r Result) fail(stage string, err error) Result {
+	r.Status = statusFailed
+	r.Error = stage + ": " + logging.Redact(err.Error())
+	return r
+}
+
+func (r Result) progressLine() string {
+	line := fmt.Sprintf("%s %s", r.File, r.Status)
+	switch {
+	case r.Status == statusFailed:
+		line += " " + r.Error
+	case r.Resumed:
+		line += fmt.Sprintf(" score=%d (checkpoint)", r.Score)
+	default:
+		line += fmt.Sprintf(" score=%d confidence=%.2f", r.Score, r.Confidence)
+	}
+	return line
+}
+
+// checkpoint 逐行追加已处理的结果（JSON Lines），进程中断时最多丢失正在写的一行
+type checkpoint struct {
+	f *os.File
+}
+
+// loadCheckpoint 按图片内容摘要返回已成功的结果；文件不存在时返回空表，无法解析的行（如中断时写了一半）跳过
+func loadCheckpoint(path string) (map[string]Result, error) {
+	done := map[string]Result{}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return done, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open checkpoint: %w", err)
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; sc.Scan(); line++ {
+		var r Result
+		if err := json.Unmarshal(sc.Bytes(), &r); err != nil || r.SHA256 == "" {
+			fmt.Fprintf(os.Stderr, "%s:%d: skipping unreadable checkpoint entry\n", path, line)
+			continue
+		}
+		if r.Status != statusFailed {
+			done[r.SHA256] = r
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("read checkpoint: %w", err)
+	}
+	if len(done) > 0 {
+		fmt.Fprintf(os.Stderr, "resuming from %s: %d graded images will be skipped\n", path, len(done))
+	}
+	return done, nil
+}
+
+func openCheckpoint(path string) (*checkpoint, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open checkpoint: %w", err)
+	}
+	return &checkpoint{f: f}, nil
+}
+
+func (c *checkpoint) append(r Result) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = c.f.Write(append(data, '\n'))
+	return err
+}
+
+func (c *checkpoint) Close() error {
+	return c.f.Close()
+}
+
+// writeResults 先写临时文件再改名，避免中断时留下不完整的结果文件
+func writeResults(path, format string, results []Result) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("write results: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if format == "csv" {
+		err = writeCSV(tmp, results)
+	} else {
+		enc := json.NewEncoder(tmp)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		err = enc.Encode(results)
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		return fmt.Errorf("write results: %w", err)
+	}
+	return nil
+}
+
+var csvHeader = []string{"file", "status", "score", "confidence", "ocrConfidence", "chars", "totalTokens", "cost", "feedback", "error", "answer", "sha256", "gradedAt"}
+
+func writeCSV(w io.Writer, results []Result) error {
+	// 带 BOM，Excel 才能正确识别 UTF-8 中文
+	if _, err := io.WriteString(w, "\ufeff"); err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, r := range results {
+		if err := cw.Write([]string{
+			r.File,
+			r.Status,
+			strconv.Itoa(r.Score),
+			strconv.FormatFloat(r.Confidence, 'f', 2, 64),
+			strconv.FormatFloat(r.OCRConfidence, 'f', 2, 64),
+			strconv.Itoa(r.Chars),
+			strconv.Itoa(r.Usage.TotalTokens),
+			strconv.FormatFloat(r.Cost, 'f', 6, 64),
+			r.Feedback,
+			r.Error,
+			r.Answer,
+			r.SHA256,
+			r.GradedAt,
+		}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// printSummary 输出逐张结果表与汇总；失败的图片不计入分数统计
+func printSummary(w io.Writer, results []Result, currency string) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "FILE\tSCORE\tCONFIDENCE\tCHARS\tSTATUS")
+	var usage services.TokenUsage
+	var cost float64
+	graded, failed, review, sum, minScore, maxScore := 0, 0, 0, 0, 0, 0
+	for _, r := range results {
+		usage.Add(r.Usage)
+		cost += r.Cost
+		if r.Status == statusFailed {
+			failed++
+			fmt.Fprintf(tw, "%s\t-\t-\t-\t%s\n", r.File, truncate(r.Error, 60))
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%.2f\t%d\t%s\n", r.File, r.Score, r.Confidence, r.Chars, r.Status)
+		if r.Status == statusNeedsReview {
+			review++
+		}
+		if graded == 0 || r.Score < minScore {
+			minScore = r.Score
+		}
+		if graded == 0 || r.Score > maxScore {
+			maxScore = r.Score
+		}
+		graded++
+		sum += r.Score
+	}
+	_ = tw.Flush()
+
+	fmt.Fprintf(w, "\n%d images: %d graded (%d need review), %d failed\n", len(results), graded, review, failed)
+	if graded > 0 {
+		fmt.Fprintf(w, "score: avg %.1f, min %d, max %d\n", float64(sum)/float64(graded), minScore, maxScore)
+	}
+	fmt.Fprintf(w, "tokens: %d (prompt %d, completion %d), cost %.4f %s\n", usage.TotalTokens, usage.PromptTokens, usage.CompletionTokens, cost, currency)
+}
+
+// truncate 截断过长的错误信息，并把换行换成空格以免打乱表格对齐
+func truncate(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n]) + "…"
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckpointResume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run.jsonl")
+	cp, err := openCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []Result{
+		{File: "a.jpg", SHA256: "aaa", Status: statusCompleted, Score: 90},
+		{File: "b.jpg", SHA256: "bbb", Status: statusFailed, Error: "ocr: timeout"},
+		{File: "c.jpg", SHA256: "ccc", Status: statusNeedsReview, Score: 55},
+		// 重新处理后以最后一行为准
+		{File: "a.jpg", SHA256: "aaa", Status: statusCompleted, Score: 92},
+	} {
+		if err := cp.append(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := cp.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// 模拟中断时写了一半的行
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"file":"d.jpg","sha2`)
+	f.Close()
+
+	done, err := loadCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		sha       string
+		want      bool
+		wantScore int
+	}{
+		{"aaa", true, 92},
+		{"bbb", false, 0},
+		{"ccc", true, 55},
+		{"ddd", false, 0},
+	}
+	for _, tt := range tests {
+		r, ok := done[tt.sha]
+		if ok != tt.want || r.Score != tt.wantScore {
+			t.Errorf("done[%s] = %+v, %v; want present=%v score=%d", tt.sha, r, ok, tt.want, tt.wantScore)
+		}
+	}
+
+	if done, err := loadCheckpoint(filepath.Join(t.TempDir(), "missing.jsonl")); err != nil || len(done) != 0 {
+		t.Fatalf("missing checkpoint: %v, %v", done, err)
+	}
+}
+
+func TestCollectImages(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"b.jpg", "a.PNG", "notes.txt", "rubric.md", "sub/c.jpg"} {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	join := func(names ...string) []string {
+		var out []string
+		for _, n := range names {
+			out = append(out, filepath.Join(dir, n))
+		}
+		return out
+	}
+	tests := []struct {
+		name    string
+		inputs  []string
+		want    []string
+		wantErr bool
+	}{
+		{"directory skips non-images and subdirectories", join(""), join("a.PNG", "b.jpg"), false},
+		{"glob", join("*.jpg"), join("b.jpg"), false},
+		{"explicit file kept regardless of extension", join("notes.txt"), join("notes.txt"), false},
+		{"duplicates removed and sorted", join("b.jpg", "", "sub"), join("a.PNG", "b.jpg", "sub/c.jpg"), false},
+		{"glob without matches", join("*.gif"), nil, true},
+		{"missing file", join("nope.jpg"), nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := collectImages(tt.inputs)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Fatalf("collectImages = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
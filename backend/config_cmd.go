@@ -0,0 +1,41 @@
+package main
+
+import (
+	"auto-grad-backend/internal/config"
+	"fmt"
+	"os"
+	"text/tabwriter"
+)
+
+const configUsage = `usage: auto-grad-backend [-config file] config <command>
+
+commands:
+  print         列出生效的配置（密钥已隐去）并校验
+  check         只校验配置，有错误时以非零状态退出`
+
+// runConfigCommand 处理 config 子命令，返回进程退出码
+func runConfigCommand(cfg *config.Config, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, configUsage)
+		return 2
+	}
+	switch args[0] {
+	case "print":
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "KEY\tENV\tVALUE")
+		for _, f := range cfg.Fields() {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", f.Key, f.Env, f.Display())
+		}
+		_ = w.Flush()
+	case "check":
+	default:
+		fmt.Fprintln(os.Stderr, configUsage)
+		return 2
+	}
+	if err := cfg.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "\ninvalid configuration (env=%s):\n%v\n", cfg.Env, err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "configuration is valid (env=%s)\n", cfg.Env)
+	return 0
+}
@@ -0,0 +1,702 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"strings"
+	"time"
+)
+
+var (
+	errClassNotFound = errors.New("class not found")
+	errClassExists   = errors.New("该学校已有同名班级")
+	errJoinCode      = errors.New("班级码无效")
+	// 名单中已有同名同学号的学生
+	errStudentEnrolled = errors.New("班级中已有同名同学号的学生")
+	// 按姓名匹配到多个名单学生
+	errStudentAmbiguous = errors.New("有多个同名学生，请指定班级或学号")
+)
+
+// Class 是教师创建的班级，学生通过 class_enrollments 加入
+type Class struct {
+	ID           int64  `json:"id"`
+	Name         string `json:"name"`
+	Grade        string `json:"grade"`
+	SchoolID     int64  `json:"schoolId"`
+	School       string `json:"school"`
+	JoinCode     string `json:"joinCode,omitempty"`
+	StudentCount int    `json:"studentCount"`
+	CreatedAt    string `json:"createdAt,omitempty"`
+	// 班主任的用户名，供家长查看
+	Teacher       string `json:"teacher,omitempty"`
+	OwnerUsername string `json:"-"`
+	OwnerRole     string `json:"-"`
+}
+
+type ClassStore struct {
+	pool *pgxpool.Pool
+}
+
+func NewClassStore(pool *pgxpool.Pool) *ClassStore {
+	return &ClassStore{pool: pool}
+}
+
+const classSelect = `
+SELECT c.id, c.name, c.grade, s.id, s.name, c.join_code, c.created_at, c.owner_username, c.owner_role,
+  (SELECT count(*) FROM class_enrollments e WHERE e.class_id = c.id)
+FROM classes c JOIN schools s ON s.id = c.school_id`
+
+func scanClass(row pgx.Row, cl *Class) error {
+	var created time.Time
+	if err := row.Scan(&cl.ID, &cl.Name, &cl.Grade, &cl.SchoolID, &cl.School, &cl.JoinCode, &created, &cl.OwnerUsername, &cl.OwnerRole, &cl.StudentCount); err != nil {
+		return err
+	}
+	cl.CreatedAt = formatTime(&created)
+	return nil
+}
+
+func (s *ClassStore) query(ctx context.Context, sql string, args ...interface{}) ([]Class, error) {
+	rows, err := s.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list classes: %w", err)
+	}
+	defer rows.Close()
+	items := []Class{}
+	for rows.Next() {
+		var cl Class
+		if err := scanClass(rows, &cl); err != nil {
+			return nil, fmt.Errorf("list classes: %w", err)
+		}
+		items = append(items, cl)
+	}
+	return items, rows.Err()
+}
+
+// list 列出教师创建的班级
+func (s *ClassStore) list(ctx context.Context, username, role string) ([]Class, error) {
+	return s.query(ctx, classSelect+` WHERE c.owner_username=$1 AND c.owner_role=$2 ORDER BY s.name, c.name`, username, role)
+}
+
+// get 读取教师名下的班级；不存在或属于其他教师时返回 errClassNotFound
+func (s *ClassStore) get(ctx context.Context, id int64, username, role string) (Class, error) {
+	var cl Class
+	err := scanClass(s.pool.QueryRow(ctx, classSelect+` WHERE c.id=$1 AND c.owner_username=$2 AND c.owner_role=$3`, id, username, role), &cl)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Class{}, errClassNotFound
+	}
+	if err != nil {
+		return Class{}, fmt.Errorf("get class %d: %w", id, err)
+	}
+	return cl, nil
+}
+
+// forOwner 按孩子分组返回家长名下孩子加入的班级，不含班级码
+func (s *ClassStore) forOwner(ctx context.Context, username, role string) (map[int64][]Class, error) {
+	rows, err := s.pool.Query(ctx, `
+SELECT e.student_id, c.id, c.name, c.grade, s.id, s.name, c.owner_username, c.created_at
+FROM class_enrollments e
+JOIN students st ON st.id = e.student_id
+JOIN classes c ON c.id = e.class_id
+JOIN schools s ON s.id = c.school_id
+WHERE st.owner_username=$1 AND st.owner_role=$2
+ORDER BY e.enrolled_at`, username, role)
+	if err != nil {
+		return nil, fmt.Errorf("list student classes: %w", err)
+	}
+	defer rows.Close()
+	out := map[int64][]Class{}
+	for rows.Next() {
+		var studentID int64
+		var cl Class
+		var created time.Time
+		if err := rows.Scan(&studentID, &cl.ID, &cl.Name, &cl.Grade, &cl.SchoolID, &cl.School, &cl.Teacher, &created); err != nil {
+			return nil, fmt.Errorf("list student classes: %w", err)
+		}
+		cl.CreatedAt = formatTime(&created)
+		out[studentID] = append(out[studentID], cl)
+	}
+	return out, rows.Err()
+}
+
+// create 创建班级，学校按名称复用，并生成家长加入用的班级码
+func (s *ClassStore) create(ctx context.Context, cl *Class) error {
+	code, err := joinCode()
+	if err != nil {
+		return fmt.Errorf("create class: %w", err)
+	}
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("create class: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	err = tx.QueryRow(ctx, `
+INSERT INTO schools (name) VALUES ($1)
+ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name
+RETURNING id`, cl.School).Scan(&cl.SchoolID)
+	if err != nil {
+		return fmt.Errorf("create class: upsert school: %w", err)
+	}
+	var created time.Time
+	err = tx.QueryRow(ctx, `
+INSERT INTO classes (school_id, name, grade, owner_username, owner_role, join_code) VALUES ($1,$2,$3,$4,$5,$6)
+ON CONFLICT (school_id, name) DO NOTHING
+RETURNING id, created_at`, cl.SchoolID, cl.Name, cl.Grade, cl.OwnerUsername, cl.OwnerRole, code).Scan(&cl.ID, &created)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return errClassExists
+	}
+	if err != nil {
+		return fmt.Errorf("create class: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("create class: %w", err)
+	}
+	cl.JoinCode = code
+	cl.CreatedAt = formatTime(&created)
+	return nil
+}
+
+func (s *ClassStore) update(ctx context.Context, cl Class) error {
+	tag, err := s.pool.Exec(ctx, `
+UPDATE classes SET name=$4, grade=$5
+WHERE id=$1 AND owner_username=$2 AND owner_role=$3
+AND NOT EXISTS (SELECT 1 FROM classes o WHERE o.school_id = classes.school_id AND o.name = $4 AND o.id <> $1)`,
+		cl.ID, cl.OwnerUsername, cl.OwnerRole, cl.Name, cl.Grade)
+	if err != nil {
+		return fmt.Errorf("update class %d: %w", cl.ID, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return errClassExists
+	}
+	return nil
+}
+
+// delete 删除班级与名单；尚未被家长认领的名单学生一并删除，其改卷保留并解除关联
+func (s *ClassStore) delete(ctx context.Context, id int64, username, role string) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("delete class %d: %w", id, err)
+	}
+	defer tx.Rollback(ctx)
+	tag, err := tx.Exec(ctx, `DELETE FROM classes WHERE id=$1 AND owner_username=$2 AND owner_role=$3`, id, username, role)
+	if err != nil {
+		return fmt.Errorf("delete class %d: %w", id, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return errClassNotFound
+	}
+	if _, err := tx.Exec(ctx, deleteOrphanStudents); err != nil {
+		return fmt.Errorf("delete class %d: %w", id, err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("delete class %d: %w", id, err)
+	}
+	return nil
+}
+
+// deleteOrphanStudents 删除不在任何班级、也没有家长认领的名单学生
+const deleteOrphanStudents = `
+DELETE FROM students st WHERE st.owner_username = '' AND st.owner_role = ''
+AND NOT EXISTS (SELECT 1 FROM class_enrollments e WHERE e.student_id = st.id)`
+
+// roster 按学号、姓名列出班级名单
+func (s *ClassStore) roster(ctx context.Context, classID int64) ([]Student, error) {
+	return queryStudents(ctx, s.pool, `
+SELECT `+studentColumns+` FROM students
+WHERE id IN (SELECT student_id FROM class_enrollments WHERE class_id=$1)
+ORDER BY student_number, name, id`, classID)
+}
+
+// enroll 在名单中新建一个尚未认领的学生；同班已有同名同学号的学生时返回 errStudentEnrolled
+func (s *ClassStore) enroll(ctx context.Context, cl Class, st *Student) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("enroll student: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	var exists bool
+	err = tx.QueryRow(ctx, `
+SELECT EXISTS (SELECT 1 FROM students st JOIN class_enrollments e ON e.student_id = st.id
+WHERE e.class_id=$1 AND st.name=$2 AND st.student_number=$3)`, cl.ID, st.Name, st.StudentNumber).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("enroll student: %w", err)
+	}
+	if exists {
+		return errStudentEnrolled
+	}
+	var created time.Time
+	err = tx.QueryRow(ctx, `
+INSERT INTO students (owner_username, owner_role, name, class, school, student_number) VALUES ('', '', $1, $2, $3, $4)
+RETURNING id, created_at`, st.Name, cl.Name, cl.School, st.StudentNumber).Scan(&st.ID, &created)
+	if err != nil {
+		return fmt.Errorf("enroll student: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `INSERT INTO class_enrollments (class_id, student_id) VALUES ($1, $2)`, cl.ID, st.ID); err != nil {
+		return fmt.Errorf("enroll student: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("enroll student: %w", err)
+	}
+	st.Class, st.School = cl.Name, cl.School
+	st.CreatedAt = formatTime(&created)
+	return nil
+}
+
+// unenroll 把学生移出班级，尚未认领且不在其他班级的名单学生随之删除
+func (s *ClassStore) unenroll(ctx context.Context, classID, studentID int64) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("unenroll student %d: %w", studentID, err)
+	}
+	defer tx.Rollback(ctx)
+	tag, err := tx.Exec(ctx, `DELETE FROM class_enrollments WHERE class_id=$1 AND student_id=$2`, classID, studentID)
+	if err != nil {
+		return fmt.Errorf("unenroll student %d: %w", studentID, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return errStudentNotFound
+	}
+	if _, err := tx.Exec(ctx, deleteOrphanStudents+` AND st.id=$1`, studentID); err != nil {
+		return fmt.Errorf("unenroll student %d: %w", studentID, err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("unenroll student %d: %w", studentID, err)
+	}
+	return nil
+}
+
+// join 用班级码把家长的孩子加入班级，返回是否认领了名单中的学生。只有姓名与学号都和名单中
+// 未认领的学生一致时才视为同一人：其改卷、学号与其他班级一并转到孩子名下，再删除名单中的占位记录。
+// 仅凭姓名不合并，避免持有班级码的家长认领同名同学的改卷记录
+func (s *ClassStore) join(ctx context.Context, code string, child Student, studentNumber string) (Class, bool, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return Class{}, false, fmt.Errorf("join class: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	var cl Class
+	err = scanClass(tx.QueryRow(ctx, classSelect+` WHERE c.join_code=$1`, code), &cl)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Class{}, false, errJoinCode
+	}
+	if err != nil {
+		return Class{}, false, fmt.Errorf("join class: %w", err)
+	}
+	var placeholder int64
+	if studentNumber != "" {
+		err = tx.QueryRow(ctx, `
+SELECT st.id FROM students st JOIN class_enrollments e ON e.student_id = st.id
+WHERE e.class_id=$1 AND st.owner_username='' AND st.owner_role='' AND st.name=$2 AND st.student_number=$3
+ORDER BY st.id LIMIT 1`, cl.ID, child.Name, studentNumber).Scan(&placeholder)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return Class{}, false, fmt.Errorf("join class: %w", err)
+		}
+	}
+	if placeholder != 0 {
+		for _, sql := range []string{
+			`UPDATE gradings SET student_id=$2 WHERE student_id=$1`,
+			`UPDATE students SET student_number=(SELECT student_number FROM students WHERE id=$1) WHERE id=$2 AND student_number=''`,
+			`INSERT INTO class_enrollments (class_id, student_id, enrolled_at)
+SELECT class_id, $2, enrolled_at FROM class_enrollments WHERE student_id=$1 ON CONFLICT DO NOTHING`,
+			`DELETE FROM students WHERE id=$1`,
+		} {
+			if _, err := tx.Exec(ctx, sql, placeholder, child.ID); err != nil {
+				return Class{}, false, fmt.Errorf("join class: merge roster student %d: %w", placeholder, err)
+			}
+		}
+	}
+	tag, err := tx.Exec(ctx, `INSERT INTO class_enrollments (class_id, student_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`, cl.ID, child.ID)
+	if err != nil {
+		return Class{}, false, fmt.Errorf("join class: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return Class{}, false, fmt.Errorf("join class: %w", err)
+	}
+	cl.Teacher = cl.OwnerUsername
+	cl.JoinCode = ""
+	if placeholder == 0 && tag.RowsAffected() > 0 {
+		cl.StudentCount++
+	}
+	return cl, placeholder != 0, nil
+}
+
+// rosterStudent 在教师名下的班级中查找学生：按姓名或学号匹配，classID 为 0 时查找全部班级；
+// 匹配到多个学生时返回 errStudentAmbiguous
+func (s *ClassStore) rosterStudent(ctx context.Context, username, role string, classID int64, name string) (Student, error) {
+	items, err := queryStudents(ctx, s.pool, `
+SELECT DISTINCT `+prefixColumns("st", studentColumns)+` FROM students st
+JOIN class_enrollments e ON e.student_id = st.id
+JOIN classes c ON c.id = e.class_id
+WHERE c.owner_username=$1 AND c.owner_role=$2 AND ($3 = 0 OR c.id = $3)
+AND (st.name=$4 OR (st.student_number <> '' AND st.student_number=$4))
+LIMIT 2`, username, role, classID, name)
+	if err != nil {
+		return Student{}, err
+	}
+	switch len(items) {
+	case 0:
+		return Student{}, errStudentNotFound
+	case 1:
+		return items[0], nil
+	}
+	return Student{}, errStudentAmbiguous
+}
+
+// teacherStudent 读取教师某个班级中的学生
+func (s *ClassStore) teacherStudent(ctx context.Context, id int64, username, role string) (Student, error) {
+	items, err := queryStudents(ctx, s.pool, `
+SELECT `+studentColumns+` FROM students WHERE id=$1 AND id IN (
+  SELECT e.student_id FROM class_enrollments e JOIN classes c ON c.id = e.class_id
+  WHERE c.owner_username=$2 AND c.owner_role=$3)`, id, username, role)
+	if err != nil {
+		return Student{}, err
+	}
+	if len(items) == 0 {
+		return Student{}, errStudentNotFound
+	}
+	return items[0], nil
+}
+
+func prefixColumns(alias, columns string) string {
+	parts := strings.Split(columns, ", ")
+	for i, p := range parts {
+		parts[i] = alias + "." + p
+	}
+	return strings.Join(parts, ", ")
+}
+
+// ClassAnalytics 汇总班级学生已完成的改卷，subject 非空时只统计该科目
+type ClassAnalytics struct {
+	ClassID      int64         `json:"classId"`
+	Subject      string        `json:"subject,omitempty"`
+	Students     int           `json:"students"`
+	Graded       int           `json:"graded"`
+	AverageScore float64       `json:"averageScore"`
+	Distribution []ScoreBucket `json:"distribution"`
+	Subjects     []SubjectStat `json:"subjects"`
+	Ranking      []StudentStat `json:"ranking"`
+}
+
+type ScoreBucket struct {
+	Range string `json:"range"`
+	Count int    `json:"count"`
+}
+
+type SubjectStat struct {
+	Subject      string  `json:"subject"`
+	Count        int     `json:"count"`
+	AverageScore float64 `json:"averageScore"`
+}
+
+// StudentStat 是一个学生的成绩汇总，没有已完成改卷时 LatestScore 为空
+type StudentStat struct {
+	StudentID     int64   `json:"studentId"`
+	Name          string  `json:"name"`
+	StudentNumber string  `json:"studentNumber,omitempty"`
+	Count         int     `json:"count"`
+	AverageScore  float64 `json:"averageScore"`
+	LatestScore   *int    `json:"latestScore"`
+	LatestAt      string  `json:"latestAt,omitempty"`
+}
+
+// 分数段的下界，依次对应 <60、60-69、70-79、80-89、90-100
+var scoreBuckets = []string{"<60", "60-69", "70-79", "80-89", "90-100"}
+
+// classGradings 是班级学生已完成改卷的公共表达式，参数 $1 为班级、$2 为科目
+const classGradings = `
+WITH cg AS (
+  SELECT g.* FROM gradings g JOIN class_enrollments e ON e.student_id = g.student_id
+  WHERE e.class_id=$1 AND g.status='completed' AND ($2 = '' OR g.subject = $2)
+)`
+
+func (s *ClassStore) analytics(ctx context.Context, cl Class, subject string) (ClassAnalytics, error) {
+	out := ClassAnalytics{ClassID: cl.ID, Subject: subject, Students: cl.StudentCount}
+	counts := make([]int, len(scoreBuckets))
+	err := s.pool.QueryRow(ctx, classGradings+`
+SELECT count(*), coalesce(avg(score), 0)::float8,
+  count(*) FILTER (WHERE score < 60),
+  count(*) FILTER (WHERE score >= 60 AND score < 70),
+  count(*) FILTER (WHERE score >= 70 AND score < 80),
+  count(*) FILTER (WHERE score >= 80 AND score < 90),
+  count(*) FILTER (WHERE score >= 90)
+FROM cg`, cl.ID, subject).Scan(&out.Graded, &out.AverageScore, &counts[0], &counts[1], &counts[2], &counts[3], &counts[4])
+	if err != nil {
+		return out, fmt.Errorf("class analytics %d: %w", cl.ID, err)
+	}
+	for i, r := range scoreBuckets {
+		out.Distribution = append(out.Distribution, ScoreBucket{Range: r, Count: counts[i]})
+	}
+
+	rows, err := s.pool.Query(ctx, classGradings+`
+SELECT subject, count(*), avg(score)::float8 FROM cg GROUP BY subject ORDER BY subject`, cl.ID, subject)
+	if err != nil {
+		return out, fmt.Errorf("class analytics %d: subjects: %w", cl.ID, err)
+	}
+	out.Subjects = []SubjectStat{}
+	for rows.Next() {
+		var st SubjectStat
+		if err := rows.Scan(&st.Subject, &st.Count, &st.AverageScore); err != nil {
+			rows.Close()
+			return out, fmt.Errorf("class analytics %d: subjects: %w", cl.ID, err)
+		}
+		out.Subjects = append(out.Subjects, st)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return out, fmt.Errorf("class analytics %d: subjects: %w", cl.ID, err)
+	}
+
+	rows, err = s.pool.Query(ctx, classGradings+`
+SELECT st.id, st.name, st.student_number, count(cg.id), coalesce(avg(cg.score), 0)::float8,
+  (array_agg(cg.score ORDER BY cg.submit_time DESC) FILTER (WHERE cg.id IS NOT NULL))[1],
+  max(cg.submit_time)
+FROM class_enrollments e
+JOIN students st ON st.id = e.student_id
+LEFT JOIN cg ON cg.student_id = st.id
+WHERE e.class_id=$1
+GROUP BY st.id
+ORDER BY count(cg.id) = 0, 5 DESC, st.student_number, st.name`, cl.ID, subject)
+	if err != nil {
+		return out, fmt.Errorf("class analytics %d: ranking: %w", cl.ID, err)
+	}
+	defer rows.Close()
+	out.Ranking = []StudentStat{}
+	for rows.Next() {
+		var st StudentStat
+		var latest *time.Time
+		if err := rows.Scan(&st.StudentID, &st.Name, &st.StudentNumber, &st.Count, &st.AverageScore, &st.LatestScore, &latest); err != nil {
+			return out, fmt.Errorf("class analytics %d: ranking: %w", cl.ID, err)
+		}
+		if latest != nil {
+			st.LatestAt = formatTime(latest)
+		}
+		out.Ranking = append(out.Ranking, st)
+	}
+	return out, rows.Err()
+}
+
+// joinCode 生成 8 位班级码，去掉了容易看错的 0、O、1、I
+func joinCode() (string, error) {
+	const alphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = alphabet[int(b[i])%len(alphabet)]
+	}
+	return string(b), nil
+}
+
+// teacherOnly 限制 /api/teacher 下的接口只对教师开放
+func teacherOnly(c *fiber.Ctx) error {
+	if currentUser(c).Role != "teacher" {
+		return c.Status(403).JSON(fiber.Map{"error": "仅教师可以访问"})
+	}
+	return c.Next()
+}
+
+// ownedClass 读取路径参数 :id 指定的当前教师名下的班级
+func ownedClass(c *fiber.Ctx) (Class, error) {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return Class{}, errClassNotFound
+	}
+	user := currentUser(c)
+	return classStore.get(c.UserContext(), id, user.Username, user.Role)
+}
+
+type classRequest struct {
+	Name   string `json:"name"`
+	Grade  string `json:"grade"`
+	School string `json:"school"`
+}
+
+func listClasses(c *fiber.Ctx) error {
+	user := currentUser(c)
+	items, err := classStore.list(c.UserContext(), user.Username, user.Role)
+	if err != nil {
+		return storeError(c, "list classes", err)
+	}
+	return c.JSON(fiber.Map{"classes": items})
+}
+
+func createClass(c *fiber.Ctx) error {
+	user := currentUser(c)
+	var req classRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	cl := Class{
+		Name:          strings.TrimSpace(req.Name),
+		Grade:         strings.TrimSpace(req.Grade),
+		School:        strings.TrimSpace(req.School),
+		OwnerUsername: user.Username,
+		OwnerRole:     user.Role,
+	}
+	if cl.Name == "" || cl.School == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "请填写学校和班级名称"})
+	}
+	if err := classStore.create(c.UserContext(), &cl); err != nil {
+		return storeError(c, "create class", err)
+	}
+	return c.Status(201).JSON(cl)
+}
+
+// updateClass 只修改请求中给出的班级名称与年级，学校不可修改
+func updateClass(c *fiber.Ctx) error {
+	var req classRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	cl, err := ownedClass(c)
+	if err != nil {
+		return storeError(c, "get class", err)
+	}
+	if name := strings.TrimSpace(req.Name); name != "" {
+		cl.Name = name
+	}
+	if req.Grade != "" {
+		cl.Grade = strings.TrimSpace(req.Grade)
+	}
+	if err := classStore.update(c.UserContext(), cl); err != nil {
+		return storeError(c, "update class", err)
+	}
+	return c.JSON(cl)
+}
+
+func deleteClass(c *fiber.Ctx) error {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{"error": "Not found"})
+	}
+	user := currentUser(c)
+	if err := classStore.delete(c.UserContext(), id, user.Username, user.Role); err != nil {
+		return storeError(c, "delete class", err)
+	}
+	return c.JSON(fiber.Map{"message": "已删除，历史改卷记录保留"})
+}
+
+func getClassRoster(c *fiber.Ctx) error {
+	cl, err := ownedClass(c)
+	if err != nil {
+		return storeError(c, "get class", err)
+	}
+	items, err := classStore.roster(c.UserContext(), cl.ID)
+	if err != nil {
+		return storeError(c, "list roster", err)
+	}
+	return c.JSON(fiber.Map{"class": cl, "students": items})
+}
+
+// addRosterStudents 向名单添加学生，支持单个对象或 {"students": [...]} 批量导入；
+// 批量导入时跳过已在名单中的学生
+func addRosterStudents(c *fiber.Ctx) error {
+	type entry struct {
+		Name          string `json:"name"`
+		StudentNumber string `json:"studentNumber"`
+	}
+	var req struct {
+		entry
+		Students []entry `json:"students"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	cl, err := ownedClass(c)
+	if err != nil {
+		return storeError(c, "get class", err)
+	}
+	batch := req.Students != nil
+	if !batch {
+		req.Students = []entry{req.entry}
+	}
+	added := []Student{}
+	skipped := 0
+	for _, e := range req.Students {
+		st := Student{Name: strings.TrimSpace(e.Name), StudentNumber: strings.TrimSpace(e.StudentNumber)}
+		if st.Name == "" {
+			if batch {
+				skipped++
+				continue
+			}
+			return c.Status(400).JSON(fiber.Map{"error": "请填写学生姓名"})
+		}
+		err := classStore.enroll(c.UserContext(), cl, &st)
+		if errors.Is(err, errStudentEnrolled) {
+			if batch {
+				skipped++
+				continue
+			}
+			return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+		}
+		if err != nil {
+			return storeError(c, "enroll student", err)
+		}
+		added = append(added, st)
+	}
+	if !batch {
+		return c.Status(201).JSON(added[0])
+	}
+	return c.Status(201).JSON(fiber.Map{"students": added, "skipped": skipped})
+}
+
+func removeRosterStudent(c *fiber.Ctx) error {
+	cl, err := ownedClass(c)
+	if err != nil {
+		return storeError(c, "get class", err)
+	}
+	studentID, ok := idParam(c, "studentId")
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{"error": "Not found"})
+	}
+	if err := classStore.unenroll(c.UserContext(), cl.ID, studentID); err != nil {
+		return storeError(c, "unenroll student", err)
+	}
+	return c.JSON(fiber.Map{"message": "已移出班级"})
+}
+
+func getClassAnalytics(c *fiber.Ctx) error {
+	cl, err := ownedClass(c)
+	if err != nil {
+		return storeError(c, "get class", err)
+	}
+	out, err := classStore.analytics(c.UserContext(), cl, strings.TrimSpace(c.Query("subject")))
+	if err != nil {
+		return storeError(c, "class analytics", err)
+	}
+	return c.JSON(out)
+}
+
+// joinClass 家长凭教师提供的班级码把孩子加入班级
+func joinClass(c *fiber.Ctx) error {
+	user := currentUser(c)
+	id, ok := idParam(c, "id")
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{"error": "Not found"})
+	}
+	var req struct {
+		Code string `json:"code"`
+		// 教师名单中的学号，与姓名一起匹配名单中已有的学生
+		StudentNumber string `json:"studentNumber"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	st, err := studentStore.get(c.UserContext(), id, user.Username, user.Role)
+	if err != nil {
+		return storeError(c, "get student", err)
+	}
+	cl, claimed, err := classStore.join(c.UserContext(), strings.ToUpper(strings.TrimSpace(req.Code)), st, strings.TrimSpace(req.StudentNumber))
+	if errors.Is(err, errJoinCode) {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return storeError(c, "join class", err)
+	}
+	return c.JSON(fiber.Map{"message": "已加入班级", "class": cl, "claimed": claimed})
+}
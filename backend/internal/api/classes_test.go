@@ -0,0 +1,44 @@
+package api
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestJoinCode(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 200; i++ {
+		code, err := joinCode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(code) != 8 {
+			t.Fatalf("len(%q) = %d, want 8", code, len(code))
+		}
+		if i := strings.IndexAny(code, "01IO"); i >= 0 {
+			t.Fatalf("code %q contains ambiguous character %q", code, code[i])
+		}
+		if strings.ToUpper(code) != code {
+			t.Fatalf("code %q is not upper case", code)
+		}
+		seen[code] = true
+	}
+	if len(seen) < 199 {
+		t.Fatalf("only %d distinct codes out of 200", len(seen))
+	}
+}
+
+func TestPrefixColumns(t *testing.T) {
+	tests := []struct {
+		columns, want string
+	}{
+		{"id", "st.id"},
+		{"id, name, class", "st.id, st.name, st.class"},
+		{studentColumns, "st.id, st.name, st.class, st.school, st.student_number, st.created_at, st.owner_username, st.owner_role"},
+	}
+	for _, tt := range tests {
+		if got := prefixColumns("st", tt.columns); got != tt.want {
+			t.Errorf("prefixColumns(%q) = %q, want %q", tt.columns, got, tt.want)
+		}
+	}
+}
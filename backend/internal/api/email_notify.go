@@ -0,0 +1,204 @@
+package api
+
+import (
+	"auto-grad-backend/internal/events"
+	"bytes"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"log/slog"
+	"strings"
+	"text/template"
+)
+
+// 邮件中反馈摘要的最大长度（字符数）
+const emailFeedbackLimit = 200
+
+var gradingEmailTemplate = template.Must(template.New("grading").Parse(`{{.Name}}，您好：
+
+{{if .Completed -}}
+{{.StudentName}}的「{{.Subject}}」试卷已批改完成{{if .Reviewed}}，并已由老师复核{{end}}。
+
+得分：{{.Score}} / {{.TotalScore}}
+{{- if .Feedback}}
+
+评语摘要：
+{{.Feedback}}
+{{- end}}
+{{- else if .NeedsReview -}}
+{{.StudentName}}的「{{.Subject}}」试卷已完成初步批改，由于识别把握不高，正在等待老师人工复核。
+复核完成后我们会再次通知您最终得分。
+{{- else -}}
+{{.StudentName}}的「{{.Subject}}」试卷批改失败，请检查上传的图片后重新提交。
+{{- if .Feedback}}
+
+失败原因：{{.Feedback}}
+{{- end}}
+{{- end}}
+
+查看详情：{{.Link}}
+
+—— 智能改卷系统
+如不想再收到此类邮件，可在个人设置中关闭邮件通知。
+`))
+
+type gradingEmail struct {
+	Name        string
+	StudentName string
+	Subject     string
+	Score       int
+	TotalScore  int
+	Feedback    string
+	Completed   bool
+	NeedsReview bool
+	Reviewed    bool
+	Link        string
+}
+
+// resultLink 拼接前端结果页地址
+func resultLink(id string) string {
+	base := strings.TrimRight(appConfig.Server.BaseURL, "/")
+	return base + "/result/" + id
+}
+
+func truncateRunes(s string, limit int) string {
+	r := []rune(strings.TrimSpace(s))
+	if len(r) <= limit {
+		return string(r)
+	}
+	return string(r[:limit]) + "…"
+}
+
+// dispatchGradingEmail 监听改卷完成、失败与进入人工复核的事件，按家长的通知偏好发送邮件；
+// 复核通过或改分后的完成事件同样会通知
+func dispatchGradingEmail(topic string, e events.Event) {
+	kind, id := events.ParseTopic(topic)
+	if kind != "grading" || !mailer.Enabled() {
+		return
+	}
+	switch e.Type {
+	case events.StageCompleted, events.StageFailed, events.StageNeedsReview:
+	default:
+		return
+	}
+	go func() {
+		ctx, cancel := backgroundContext()
+		defer cancel()
+		logger := slog.With("grading_id", id)
+		item, err := gradingStore.get(ctx, id)
+		if err != nil {
+			logger.Error("failed to load grading for email", "err", err)
+			return
+		}
+		var student *Student
+		if item.StudentID != 0 {
+			st, err := studentStore.byID(ctx, item.StudentID)
+			if err != nil && !errors.Is(err, errStudentNotFound) {
+				logger.Error("failed to load student for email", "err", err)
+				return
+			}
+			if err == nil {
+				student = &st
+			}
+		}
+		username, ok := notifyParent(item, student)
+		if !ok {
+			return
+		}
+		user, err := userStore.Get(ctx, username, "parent")
+		if err != nil {
+			if !errors.Is(err, errUserNotFound) {
+				logger.Error("failed to load parent for email", "err", err)
+			}
+			return
+		}
+		if user.Email == "" {
+			return
+		}
+		// 等待复核视为完成通知的一部分
+		if (e.Type == events.StageFailed && !user.EmailOnFailure) || (e.Type != events.StageFailed && !user.EmailOnComplete) {
+			return
+		}
+		// 关联了孩子的，邮件中使用该孩子的姓名
+		if student != nil {
+			user.StudentName = student.Name
+		}
+		if err := sendGradingEmail(user, item, e.Type); err != nil {
+			logger.Error("failed to send email", "err", err)
+		}
+	}()
+}
+
+// notifyParent 返回应接收通知的家长账号：评分关联了有家长的孩子时通知该家长（包括教师代交的评分），
+// 否则只在提交者是家长时通知提交者
+func notifyParent(item *GradingRequest, student *Student) (string, bool) {
+	if student != nil && student.OwnerRole == "parent" {
+		return student.OwnerUsername, true
+	}
+	if item.OwnerRole == "parent" {
+		return item.OwnerUsername, true
+	}
+	return "", false
+}
+
+// sendGradingEmail 按事件阶段（completed、failed、needs_review）发送通知邮件
+func sendGradingEmail(user User, item *GradingRequest, stage string) error {
+	data := gradingEmail{
+		Name:        firstNonEmpty(user.Name, user.Username),
+		StudentName: firstNonEmpty(user.StudentName, "孩子"),
+		Subject:     item.Subject,
+		Score:       item.Score,
+		TotalScore:  item.TotalScore,
+		Feedback:    truncateRunes(item.Feedback, emailFeedbackLimit),
+		Completed:   stage == events.StageCompleted,
+		NeedsReview: stage == events.StageNeedsReview,
+		Reviewed:    stage == events.StageCompleted && item.ReviewedBy != "",
+		Link:        resultLink(item.ID),
+	}
+	var body bytes.Buffer
+	if err := gradingEmailTemplate.Execute(&body, data); err != nil {
+		return err
+	}
+	subject := "【智能改卷】" + item.Subject + " 批改失败"
+	switch {
+	case data.Completed:
+		subject = "【智能改卷】" + item.Subject + " 批改完成"
+	case data.NeedsReview:
+		subject = "【智能改卷】" + item.Subject + " 等待老师复核"
+	}
+	return mailer.Send(user.Email, subject, body.String())
+}
+
+func getNotificationPrefs(c *fiber.Ctx) error {
+	user := currentUser(c)
+	return c.JSON(fiber.Map{
+		"email":           user.Email,
+		"emailOnComplete": user.EmailOnComplete,
+		"emailOnFailure":  user.EmailOnFailure,
+	})
+}
+
+func updateNotificationPrefs(c *fiber.Ctx) error {
+	user := currentUser(c)
+	type Req struct {
+		EmailOnComplete *bool `json:"emailOnComplete"`
+		EmailOnFailure  *bool `json:"emailOnFailure"`
+	}
+	var req Req
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	if req.EmailOnComplete != nil {
+		user.EmailOnComplete = *req.EmailOnComplete
+	}
+	if req.EmailOnFailure != nil {
+		user.EmailOnFailure = *req.EmailOnFailure
+	}
+	if err := userStore.Update(c.UserContext(), user); err != nil {
+		return storeError(c, "update notification prefs", err)
+	}
+	return c.JSON(fiber.Map{
+		"message":         "通知设置已更新",
+		"emailOnComplete": user.EmailOnComplete,
+		"emailOnFailure":  user.EmailOnFailure,
+	})
+}
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"auto-grad-backend/internal/events"
+	"auto-grad-backend/internal/services"
+	"bufio"
+	"mime"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+// smtpSink 是只接收一封邮件的本地 SMTP 服务器，返回监听端口与收到的原始邮件
+func smtpSink(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+		reply("220 localhost ESMTP sink")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			cmd := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250-localhost")
+				reply("250 8BITMIME")
+			case strings.HasPrefix(cmd, "DATA"):
+				reply("354 end with .")
+				var data strings.Builder
+				for {
+					l, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if l == ".\r\n" {
+						break
+					}
+					data.WriteString(strings.TrimPrefix(l, "."))
+				}
+				received <- data.String()
+				reply("250 queued")
+			case strings.HasPrefix(cmd, "QUIT"):
+				reply("221 bye")
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	return port, received
+}
+
+func TestSendGradingEmail(t *testing.T) {
+	appConfig.Server.BaseURL = "https://grade.example.com/"
+	user := User{Username: "123123", Name: "王女士", StudentName: "小明", Email: "parent@example.com"}
+	tests := []struct {
+		name        string
+		stage       string
+		reviewedBy  string
+		wantSubject string
+		wantBody    []string
+	}{
+		{"completed", events.StageCompleted, "", "【智能改卷】数学 批改完成", []string{"王女士，您好", "小明的「数学」试卷已批改完成。", "得分：92 / 100", "计算仔细"}},
+		{"reviewed", events.StageCompleted, "teacher1", "【智能改卷】数学 批改完成", []string{"已批改完成，并已由老师复核。", "得分：92 / 100"}},
+		{"needs review", events.StageNeedsReview, "", "【智能改卷】数学 等待老师复核", []string{"正在等待老师人工复核", "复核完成后我们会再次通知您"}},
+		{"failed", events.StageFailed, "", "【智能改卷】数学 批改失败", []string{"批改失败", "失败原因：计算仔细"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			port, received := smtpSink(t)
+			mailer = services.NewMailer("127.0.0.1", port, "", "", "noreply@example.com")
+			item := &GradingRequest{ID: "grading_1", Subject: "数学", Score: 92, TotalScore: 100, Feedback: "计算仔细", ReviewedBy: tt.reviewedBy}
+			if err := sendGradingEmail(user, item, tt.stage); err != nil {
+				t.Fatal(err)
+			}
+
+			msg, err := mail.ReadMessage(strings.NewReader(<-received))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := msg.Header.Get("To"); got != user.Email {
+				t.Fatalf("To = %q, want %q", got, user.Email)
+			}
+			subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if subject != tt.wantSubject {
+				t.Fatalf("Subject = %q, want %q", subject, tt.wantSubject)
+			}
+			var body strings.Builder
+			if _, err := bufio.NewReader(msg.Body).WriteTo(&body); err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range append(tt.wantBody, "https://grade.example.com/result/grading_1") {
+				if !strings.Contains(body.String(), want) {
+					t.Fatalf("body does not contain %q:\n%s", want, body.String())
+				}
+			}
+			if tt.reviewedBy == "" && strings.Contains(body.String(), "已由老师复核") {
+				t.Fatalf("unreviewed grading mentions review:\n%s", body.String())
+			}
+		})
+	}
+}
+
+func TestNotifyParent(t *testing.T) {
+	tests := []struct {
+		name    string
+		item    GradingRequest
+		student *Student
+		want    string
+		wantOK  bool
+	}{
+		{"parent submission", GradingRequest{OwnerUsername: "p1", OwnerRole: "parent"}, nil, "p1", true},
+		{"teacher submission for linked child", GradingRequest{OwnerUsername: "t1", OwnerRole: "teacher", StudentID: 7}, &Student{ID: 7, OwnerUsername: "p2", OwnerRole: "parent"}, "p2", true},
+		{"teacher submission for unclaimed student", GradingRequest{OwnerUsername: "t1", OwnerRole: "teacher", StudentID: 7}, &Student{ID: 7}, "", false},
+		{"teacher submission without student", GradingRequest{OwnerUsername: "t1", OwnerRole: "teacher"}, nil, "", false},
+		{"child's parent preferred", GradingRequest{OwnerUsername: "p1", OwnerRole: "parent", StudentID: 7}, &Student{ID: 7, OwnerUsername: "p1", OwnerRole: "parent"}, "p1", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := notifyParent(&tt.item, tt.student)
+			if got != tt.want || ok != tt.wantOK {
+				t.Fatalf("notifyParent = %q, %v; want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
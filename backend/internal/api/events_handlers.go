@@ -0,0 +1,168 @@
+package api
+
+import (
+	"auto-grad-backend/internal/events"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+	"time"
+)
+
+// SSE 心跳间隔，同时用于发现已断开的客户端
+const sseHeartbeat = 15 * time.Second
+
+// gradingStage 将改卷状态映射为事件阶段，用于连接建立时推送当前快照
+func gradingStage(status string) string {
+	switch status {
+	case "completed":
+		return events.StageCompleted
+	case "failed":
+		return events.StageFailed
+	case "needs_review":
+		return events.StageNeedsReview
+	case "cancelled":
+		return events.StageCancelled
+	case "quota_exceeded":
+		return events.StageQuotaExceeded
+	case "queued":
+		return events.StageQueued
+	}
+	return events.StageUploaded
+}
+
+func publishGrading(id, stage, message string, data map[string]interface{}) {
+	events.Default.Publish(events.GradingTopic(id), events.Event{
+		Type:    stage,
+		ID:      id,
+		Message: message,
+		Data:    data,
+	})
+}
+
+func streamGradingEvents(c *fiber.Ctx) error {
+	id := c.Params("id")
+	// 先订阅再读快照，避免两者之间的事件丢失
+	ch, cancel := events.Default.Subscribe(events.GradingTopic(id))
+	item, err := gradingStore.get(c.UserContext(), id)
+	if err != nil {
+		cancel()
+		return storeError(c, "get grading", err)
+	}
+	if ok, err := canAccessGrading(c.UserContext(), currentUser(c), item); err != nil || !ok {
+		cancel()
+		if err != nil {
+			return storeError(c, "check grading access", err)
+		}
+		return c.Status(403).JSON(fiber.Map{"error": "无权查看该评分"})
+	}
+	snapshot := events.Event{
+		Type: gradingStage(item.Status),
+		ID:   id,
+		Data: map[string]interface{}{
+			"status":     item.Status,
+			"score":      item.Score,
+			"confidence": item.Confidence,
+		},
+		Time: time.Now().Format(time.RFC3339),
+	}
+	return streamEvents(c, snapshot, ch, cancel)
+}
+
+func (h *TeacherTaskHandler) StreamTaskEvents(c *fiber.Ctx) error {
+	taskID := c.Params("id")
+	ch, cancel := events.Default.Subscribe(events.TaskTopic(taskID))
+
+	h.mu.Lock()
+	task := h.ownedTask(taskID, currentUser(c))
+	var snapshot events.Event
+	if task != nil {
+		snapshot = taskSnapshot(task)
+	}
+	h.mu.Unlock()
+
+	if task == nil {
+		cancel()
+		return c.Status(404).JSON(fiber.Map{"error": "Task not found"})
+	}
+	return streamEvents(c, snapshot, ch, cancel)
+}
+
+func taskSnapshot(task *TeacherTask) events.Event {
+	stage := events.StageProgress
+	switch task.Status {
+	case "completed":
+		stage = events.StageCompleted
+	case "paused":
+		stage = events.StagePaused
+	case "cancelled":
+		stage = events.StageCancelled
+	case "failed":
+		stage = events.StageFailed
+	}
+	return events.Event{
+		Type: stage,
+		ID:   task.ID,
+		Data: map[string]interface{}{
+			"status":          task.Status,
+			"totalPapers":     task.TotalPapers,
+			"completedPapers": task.CompletedPapers,
+			"failedPapers":    task.FailedPapers,
+			"averageScore":    task.AverageScore,
+		},
+		Time: time.Now().Format(time.RFC3339),
+	}
+}
+
+// streamEvents 以 text/event-stream 推送快照及后续事件，遇到终态事件或客户端断开时结束
+func streamEvents(c *fiber.Ctx, snapshot events.Event, ch <-chan events.Event, cancel func()) error {
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	conn := c.Context().Conn()
+	c.Context().SetBodyStreamWriter(fasthttp.StreamWriter(func(w *bufio.Writer) {
+		defer cancel()
+		heartbeat := time.NewTicker(sseHeartbeat)
+		defer heartbeat.Stop()
+
+		// 服务端的 WriteTimeout 是针对整个响应的，长连接需要逐次延长写超时
+		flush := func() bool {
+			_ = conn.SetWriteDeadline(time.Now().Add(2 * sseHeartbeat))
+			return w.Flush() == nil
+		}
+
+		fmt.Fprintf(w, "retry: 3000\n\n")
+		if !writeEvent(w, snapshot) || !flush() || snapshot.Terminal() {
+			return
+		}
+		for {
+			select {
+			case e, ok := <-ch:
+				if !ok {
+					return
+				}
+				if !writeEvent(w, e) || !flush() || e.Terminal() {
+					return
+				}
+			case <-heartbeat.C:
+				fmt.Fprintf(w, ": ping\n\n")
+				if !flush() {
+					return
+				}
+			}
+		}
+	}))
+	return nil
+}
+
+func writeEvent(w *bufio.Writer, e events.Event) bool {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return false
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+	return err == nil
+}
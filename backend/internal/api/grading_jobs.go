@@ -0,0 +1,224 @@
+package api
+
+import (
+	"auto-grad-backend/internal/events"
+	"auto-grad-backend/internal/logging"
+	"auto-grad-backend/internal/metrics"
+	"context"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// 各阶段超时来自配置，见 config.GradingConfig
+func dbTimeout() time.Duration      { return appConfig.Database.Timeout }
+func ocrTimeout() time.Duration     { return appConfig.Grading.OCRTimeout }
+func scoreTimeout() time.Duration   { return appConfig.Grading.ScoreTimeout }
+func gradingTimeout() time.Duration { return appConfig.Grading.Timeout }
+
+// withRequestTimeout 给每个 API 请求的 UserContext 加上数据库超时
+func withRequestTimeout(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.UserContext(), dbTimeout())
+	defer cancel()
+	c.SetUserContext(ctx)
+	return c.Next()
+}
+
+// backgroundContext 供事件监听等脱离请求的后台任务访问数据库
+func backgroundContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), dbTimeout())
+}
+
+// detachedContext 在父 context 已取消或超时后仍需落库时使用（如记录失败原因）
+func detachedContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), dbTimeout())
+}
+
+type gradingJob struct {
+	cancel context.CancelCauseFunc
+	done   chan struct{}
+}
+
+// errShuttingDown 是服务停止时取消流水线的原因，这类改卷会重新排队而不是标记失败
+var errShuttingDown = errors.New("server shutting down")
+
+// gradingJobRegistry 记录正在运行的改卷流水线，用于取消与停机时排空
+type gradingJobRegistry struct {
+	mu     sync.Mutex
+	jobs   map[string]*gradingJob
+	closed bool
+}
+
+var gradingJobs = &gradingJobRegistry{jobs: map[string]*gradingJob{}}
+
+// start 为改卷创建带总超时的 context；同一改卷已有流水线在跑时（如重新处理）先取消旧的。
+// 服务停止后不再接收新任务，返回 ok=false
+func (r *gradingJobRegistry) start(id string) (ctx context.Context, finish func(), ok bool) {
+	base, cancelCause := context.WithCancelCause(context.Background())
+	ctx, cancelTimeout := context.WithTimeout(base, gradingTimeout())
+	job := &gradingJob{cancel: cancelCause, done: make(chan struct{})}
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		cancelTimeout()
+		cancelCause(errShuttingDown)
+		return nil, nil, false
+	}
+	if old := r.jobs[id]; old != nil {
+		old.cancel(context.Canceled)
+	}
+	r.jobs[id] = job
+	r.mu.Unlock()
+	return ctx, func() {
+		r.mu.Lock()
+		if r.jobs[id] == job {
+			delete(r.jobs, id)
+		}
+		r.mu.Unlock()
+		cancelTimeout()
+		cancelCause(context.Canceled)
+		close(job.done)
+	}, true
+}
+
+func (r *gradingJobRegistry) cancel(id string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job := r.jobs[id]
+	if job == nil {
+		return false
+	}
+	job.cancel(context.Canceled)
+	delete(r.jobs, id)
+	return true
+}
+
+// drain 停止接收新任务并等待运行中的流水线结束；ctx 到期后以 errShuttingDown 取消剩余的，
+// 等它们退出后返回被中断的改卷 ID
+func (r *gradingJobRegistry) drain(ctx context.Context) []string {
+	r.mu.Lock()
+	r.closed = true
+	r.mu.Unlock()
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+wait:
+	for r.running() > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			break wait
+		}
+	}
+
+	r.mu.Lock()
+	interrupted := make(map[string]*gradingJob, len(r.jobs))
+	for id, job := range r.jobs {
+		job.cancel(errShuttingDown)
+		interrupted[id] = job
+	}
+	r.mu.Unlock()
+
+	ids := make([]string, 0, len(interrupted))
+	for id, job := range interrupted {
+		// 取消后流水线只剩收尾，正常情况下很快退出；不无限等待
+		select {
+		case <-job.done:
+		case <-time.After(5 * time.Second):
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// running 返回本进程内正在运行的流水线数量
+func (r *gradingJobRegistry) running() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.jobs)
+}
+
+const queuedFeedback = "服务重启中，稍后自动继续处理"
+
+// requeueGradings 把仍在处理中的改卷改为排队状态，返回实际排队的数量
+func requeueGradings(ctx context.Context, ids []string) int {
+	n := 0
+	for _, id := range ids {
+		ok, err := gradingStore.transition(ctx, id, "processing", "queued", queuedFeedback)
+		if err != nil {
+			slog.Error("failed to requeue grading", "grading_id", id, "err", err)
+			continue
+		}
+		if ok {
+			n++
+			publishGrading(id, events.StageQueued, queuedFeedback, nil)
+		}
+	}
+	return n
+}
+
+// DrainGradings 在停机时调用：等待运行中的改卷在 ctx 到期前完成，未完成的重新排队，返回排队数量
+func DrainGradings(ctx context.Context) int {
+	ids := gradingJobs.drain(ctx)
+	if len(ids) == 0 {
+		return 0
+	}
+	// ctx 此时已到期，排队写库使用新的超时
+	wctx, cancel := context.WithTimeout(context.Background(), dbTimeout())
+	defer cancel()
+	return requeueGradings(wctx, ids)
+}
+
+// ResumeQueuedGradings 在启动时认领排队中的改卷并重新执行，返回恢复的数量
+func ResumeQueuedGradings(ctx context.Context) (int, error) {
+	items, err := gradingStore.byStatus(ctx, "queued")
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, item := range items {
+		ok, err := gradingStore.transition(ctx, item.ID, "queued", "processing", "")
+		if err != nil {
+			return n, err
+		}
+		if ok {
+			startGradingPipeline(ctx, item.ID)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func cancelGrading(c *fiber.Ctx) error {
+	user := currentUser(c)
+	id := c.Params("id")
+	item, err := gradingStore.get(c.UserContext(), id)
+	if err != nil {
+		return storeError(c, "get grading", err)
+	}
+	if ok, err := canEditGrading(c.UserContext(), user, item); err != nil {
+		return storeError(c, "check grading access", err)
+	} else if !ok {
+		return c.Status(403).JSON(fiber.Map{"error": "无权取消该评分"})
+	}
+	if item.Status != "processing" && item.Status != "queued" {
+		return c.Status(409).JSON(fiber.Map{"error": "评分不在处理中，无法取消"})
+	}
+
+	// 先取消流水线，其后续的写库会因 context 取消而失败，不会覆盖 cancelled 状态
+	running := gradingJobs.cancel(id)
+	updated, err := gradingStore.update(c.UserContext(), id, func(r *GradingRequest) {
+		r.Status = "cancelled"
+		r.Feedback = "已取消"
+		r.CompleteTime = time.Now().Format(time.RFC3339)
+	})
+	if err != nil {
+		return storeError(c, "cancel grading", err)
+	}
+	publishGrading(id, events.StageCancelled, "已取消", nil)
+	metrics.GradingsFinished.WithLabelValues("cancelled").Inc()
+	logging.FromContext(c.UserContext()).Info("grading cancelled", "grading_id", id, "role", user.Role, "username", user.Username, "running", running)
+	return c.JSON(updated)
+}
@@ -0,0 +1,266 @@
+package api
+
+import (
+	"auto-grad-backend/internal/services"
+	"context"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// 组件状态：down 的关键组件会让就绪检查返回 503，degraded 只提示不影响就绪
+const (
+	healthOK       = "ok"
+	healthDegraded = "degraded"
+	healthDown     = "down"
+)
+
+const healthCheckTimeout = 5 * time.Second
+
+var startedAt = time.Now()
+
+// componentHealth 是单个组件的检查结果
+type componentHealth struct {
+	Status    string      `json:"status"`
+	Critical  bool        `json:"critical"`
+	Message   string      `json:"message,omitempty"`
+	LatencyMs int64       `json:"latencyMs"`
+	CheckedAt string      `json:"checkedAt"`
+	Details   interface{} `json:"details,omitempty"`
+}
+
+// providerProbe 缓存外部服务的连通性探测结果，避免探针频繁调用付费接口
+type providerProbe struct {
+	probe func(ctx context.Context) error
+
+	mu      sync.Mutex
+	result  componentHealth
+	expires time.Time
+}
+
+func newProviderProbe(probe func(ctx context.Context) error) *providerProbe {
+	return &providerProbe{probe: probe}
+}
+
+// check 缓存未过期时直接返回上次结果，并发调用只会触发一次探测
+func (p *providerProbe) check(ctx context.Context) componentHealth {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if time.Now().Before(p.expires) {
+		return p.result
+	}
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+	p.result = componentHealth{Status: healthOK}
+	ttl := appConfig.Health.ProbeTTL
+	if err := p.probe(ctx); err != nil {
+		p.result = componentHealth{Status: healthDegraded, Message: err.Error()}
+		// 失败结果缓存得短一些，服务恢复后尽快反映出来
+		ttl /= 4
+	}
+	p.result.LatencyMs = time.Since(start).Milliseconds()
+	p.result.CheckedAt = start.Format(time.RFC3339)
+	p.expires = time.Now().Add(ttl)
+	return p.result
+}
+
+var (
+	baiduProbe    = newProviderProbe(probeBaidu)
+	deepSeekProbe = newProviderProbe(probeDeepSeek)
+)
+
+// probeBaidu 获取 access token，同时验证鉴权服务可达与密钥有效；token 已缓存时不发请求
+func probeBaidu(ctx context.Context) error {
+	if !baiduTokens.Configured() {
+		return fmt.Errorf("缺少 BAIDU_API_KEY/BAIDU_SECRET_KEY")
+	}
+	_, err := baiduTokens.Token(ctx)
+	return err
+}
+
+// probeDeepSeek 请求模型列表，不消耗 token
+func probeDeepSeek(ctx context.Context) error {
+	apiKey := appConfig.DeepSeek.APIKey
+	if apiKey == "" {
+		return fmt.Errorf("缺少 DEEPSEEK_API_KEY")
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", appConfig.DeepSeek.BaseURL+"/models", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("deepseek 返回 HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func timedCheck(critical bool, fn func() (interface{}, error)) componentHealth {
+	start := time.Now()
+	details, err := fn()
+	h := componentHealth{Status: healthOK, Critical: critical, Details: details}
+	if err != nil {
+		h.Message = err.Error()
+		h.Status = healthDegraded
+		if critical {
+			h.Status = healthDown
+		}
+	}
+	h.LatencyMs = time.Since(start).Milliseconds()
+	h.CheckedAt = start.Format(time.RFC3339)
+	return h
+}
+
+func checkDatabase(ctx context.Context) componentHealth {
+	return timedCheck(true, func() (interface{}, error) {
+		if err := pgPool.Ping(ctx); err != nil {
+			return nil, err
+		}
+		stat := pgPool.Stat()
+		return fiber.Map{
+			"totalConns":    stat.TotalConns(),
+			"idleConns":     stat.IdleConns(),
+			"acquiredConns": stat.AcquiredConns(),
+			"maxConns":      stat.MaxConns(),
+		}, nil
+	})
+}
+
+// checkStorage 在上传目录实际写入并删除一个临时文件
+func checkStorage() componentHealth {
+	return timedCheck(true, func() (interface{}, error) {
+		dir := filepath.Join(appConfig.Storage.UploadDir, "papers")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+		f, err := os.CreateTemp(dir, ".health-*")
+		if err != nil {
+			return nil, err
+		}
+		name := f.Name()
+		_, err = f.WriteString("ok")
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		os.Remove(name)
+		return fiber.Map{"path": dir}, err
+	})
+}
+
+// checkCredentials 只检查是否配置，不输出密钥内容
+func checkCredentials() componentHealth {
+	return timedCheck(false, func() (interface{}, error) {
+		present := fiber.Map{
+			"baiduOcr": baiduTokens.Configured(),
+			"deepseek": appConfig.DeepSeek.APIKey != "",
+		}
+		var missing []string
+		if !baiduTokens.Configured() {
+			missing = append(missing, "BAIDU_API_KEY/BAIDU_SECRET_KEY")
+		}
+		if appConfig.DeepSeek.APIKey == "" {
+			missing = append(missing, "DEEPSEEK_API_KEY")
+		}
+		if len(missing) > 0 {
+			return present, fmt.Errorf("缺少 %v", missing)
+		}
+		return present, nil
+	})
+}
+
+// checkProvider 合并缓存的连通性探测与熔断器状态，熔断打开时视为降级
+func checkProvider(ctx context.Context, gate *providerGate, probe *providerProbe) componentHealth {
+	h := probe.check(ctx)
+	breaker := gate.breaker.Snapshot()
+	h.Details = fiber.Map{"breaker": breaker}
+	if breaker.State == services.BreakerOpen && h.Status == healthOK {
+		h.Status = healthDegraded
+		h.Message = "熔断器已打开: " + breaker.LastError
+	}
+	return h
+}
+
+// checkBacklog 统计处理中的改卷数，超过配置的上限视为积压
+func checkBacklog(ctx context.Context) componentHealth {
+	limit := appConfig.Health.MaxBacklog
+	return timedCheck(false, func() (interface{}, error) {
+		processing, err := gradingStore.countByStatus(ctx, "processing")
+		details := fiber.Map{"processing": processing, "running": gradingJobs.running(), "maxBacklog": limit}
+		if err != nil {
+			return details, err
+		}
+		if limit > 0 && processing > limit {
+			return details, fmt.Errorf("处理中的改卷 %d 份，超过上限 %d", processing, limit)
+		}
+		return details, nil
+	})
+}
+
+// healthLive 存活探针：进程能响应即可，不依赖外部组件
+func healthLive(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"status":     healthOK,
+		"uptime":     time.Since(startedAt).Round(time.Second).String(),
+		"goroutines": runtime.NumGoroutine(),
+	})
+}
+
+// healthReady 就绪探针：并行检查各组件，关键组件 down 时返回 503
+func healthReady(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.UserContext(), healthCheckTimeout)
+	defer cancel()
+
+	checks := map[string]func() componentHealth{
+		"database":    func() componentHealth { return checkDatabase(ctx) },
+		"storage":     checkStorage,
+		"credentials": checkCredentials,
+		"baiduOcr":    func() componentHealth { return checkProvider(ctx, baiduGate, baiduProbe) },
+		"deepseek":    func() componentHealth { return checkProvider(ctx, deepSeekGate, deepSeekProbe) },
+		"jobQueue":    func() componentHealth { return checkBacklog(ctx) },
+	}
+	components := make(map[string]componentHealth, len(checks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, fn := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h := fn()
+			mu.Lock()
+			components[name] = h
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	status := healthOK
+	for _, h := range components {
+		switch {
+		case h.Status == healthDown:
+			status = healthDown
+		case h.Status != healthOK && status == healthOK:
+			status = healthDegraded
+		}
+	}
+	code := fiber.StatusOK
+	if status == healthDown {
+		code = fiber.StatusServiceUnavailable
+	}
+	return c.Status(code).JSON(fiber.Map{
+		"status":     status,
+		"version":    "1.0.0",
+		"checkedAt":  time.Now().Format(time.RFC3339),
+		"components": components,
+	})
+}
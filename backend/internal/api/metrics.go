@@ -0,0 +1,66 @@
+package api
+
+import (
+	"auto-grad-backend/internal/metrics"
+	"auto-grad-backend/internal/services"
+	"context"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"strconv"
+	"time"
+)
+
+// metricsHandler 以 Prometheus 文本格式输出默认注册表中的全部指标
+var metricsHandler = adaptor.HTTPHandler(promhttp.Handler())
+
+// httpMetrics 按路由模板统计请求数与耗时；未匹配任何路由的请求归到中间件自身的路由 "/"
+func httpMetrics(c *fiber.Ctx) error {
+	start := time.Now()
+	err := c.Next()
+	route := c.Route().Path
+	metrics.HTTPRequests.WithLabelValues(c.Method(), route, strconv.Itoa(responseStatus(c, err))).Inc()
+	metrics.HTTPDuration.WithLabelValues(c.Method(), route).Observe(time.Since(start).Seconds())
+	return err
+}
+
+// responseStatus 返回响应状态码；处理函数返回错误时由全局 ErrorHandler 稍后写入响应，按错误推算
+func responseStatus(c *fiber.Ctx, err error) int {
+	if err == nil {
+		return c.Response().StatusCode()
+	}
+	var ferr *fiber.Error
+	if errors.As(err, &ferr) {
+		return ferr.Code
+	}
+	return fiber.StatusInternalServerError
+}
+
+// providerErrorCode 把外部调用错误归类为有限的标签值
+func providerErrorCode(err error) string {
+	var perr *services.ProviderError
+	switch {
+	case errors.Is(err, errQuotaExceeded):
+		return "quota_exceeded"
+	case errors.Is(err, services.ErrCircuitOpen):
+		return "circuit_open"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.As(err, &perr) && perr.Code != 0:
+		return strconv.Itoa(perr.Code)
+	case errors.As(err, &perr) && perr.StatusCode != 0:
+		return "http_" + strconv.Itoa(perr.StatusCode)
+	case services.IsRetryable(err):
+		return "network"
+	}
+	return "other"
+}
+
+func recordProviderError(provider string, err error) {
+	if err != nil {
+		metrics.ProviderErrors.WithLabelValues(provider, providerErrorCode(err)).Inc()
+	}
+}
@@ -0,0 +1,324 @@
+package api
+
+import (
+	"auto-grad-backend/internal/logging"
+	"auto-grad-backend/internal/services"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"log/slog"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+)
+
+const minPasswordLength = 8
+
+// 按账号限流：窗口内达到次数上限后拒绝，窗口滑动后自动恢复
+const (
+	eventPasswordChangeFailed = "password_change_failed"
+	eventPasswordResetRequest = "password_reset_requested"
+
+	passwordChangeLimit  = 5
+	passwordChangeWindow = 15 * time.Minute
+	resetRequestLimit    = 3
+	resetRequestWindow   = time.Hour
+)
+
+var errResetTokenInvalid = errors.New("reset token is invalid, used or expired")
+
+// newAuthService 未配置 JWT_SECRET 时（仅开发环境允许）使用随机密钥，重启后需要重新登录
+func newAuthService(secret string, accessTTL time.Duration) *services.AuthService {
+	if secret == "" {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			panic(err)
+		}
+		secret = hex.EncodeToString(b)
+		slog.Warn("JWT_SECRET not set, using a random key; tokens will not survive a restart")
+	}
+	return services.NewAuthService(secret, accessTTL)
+}
+
+func validatePassword(password string) error {
+	if utf8.RuneCountInString(password) < minPasswordLength {
+		return fmt.Errorf("密码至少需要 %d 位", minPasswordLength)
+	}
+	return nil
+}
+
+// AuthEventStore 记录按账号限流所需的认证事件
+type AuthEventStore struct {
+	pool *pgxpool.Pool
+}
+
+func NewAuthEventStore(pool *pgxpool.Pool) *AuthEventStore {
+	return &AuthEventStore{pool: pool}
+}
+
+func (s *AuthEventStore) record(ctx context.Context, username, role, kind, ip string) error {
+	_, err := s.pool.Exec(ctx, `INSERT INTO auth_events (username, role, kind, ip) VALUES ($1,$2,$3,$4)`, username, role, kind, ip)
+	if err != nil {
+		return fmt.Errorf("record auth event: %w", err)
+	}
+	return nil
+}
+
+func (s *AuthEventStore) count(ctx context.Context, username, role, kind string, window time.Duration) (int, error) {
+	var n int
+	err := s.pool.QueryRow(ctx, `
+SELECT count(*) FROM auth_events
+WHERE username=$1 AND role=$2 AND kind=$3 AND created_at > now() - make_interval(secs => $4)`,
+		username, role, kind, window.Seconds()).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("count auth events: %w", err)
+	}
+	return n, nil
+}
+
+// PasswordResetStore 保存找回密码令牌；库中只存 SHA-256 摘要，令牌原文只出现在邮件里
+type PasswordResetStore struct {
+	pool *pgxpool.Pool
+}
+
+func NewPasswordResetStore(pool *pgxpool.Pool) *PasswordResetStore {
+	return &PasswordResetStore{pool: pool}
+}
+
+// hashToken 返回令牌的 SHA-256 摘要，库中只保存摘要
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// create 生成新的重置令牌并返回原文
+func (s *PasswordResetStore) create(ctx context.Context, username, role string, ttl time.Duration) (string, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	_, err = s.pool.Exec(ctx, `
+INSERT INTO password_resets (username, role, token_hash, expires_at) VALUES ($1,$2,$3,$4)`,
+		username, role, hashToken(token), time.Now().Add(ttl))
+	if err != nil {
+		return "", fmt.Errorf("create password reset: %w", err)
+	}
+	return token, nil
+}
+
+// consume 在同一事务中作废令牌并设置新密码，同一账号其他未使用的令牌一并作废；
+// 令牌不存在、已使用或已过期时返回 errResetTokenInvalid
+func (s *PasswordResetStore) consume(ctx context.Context, token, newPassword string) (username, role string, err error) {
+	hash, err := hashPassword(newPassword)
+	if err != nil {
+		return "", "", err
+	}
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return "", "", fmt.Errorf("reset password: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx, `
+UPDATE password_resets SET used_at=now()
+WHERE token_hash=$1 AND used_at IS NULL AND expires_at > now()
+RETURNING username, role`, hashToken(token)).Scan(&username, &role)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", "", errResetTokenInvalid
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("reset password: %w", err)
+	}
+	tag, err := tx.Exec(ctx, `
+UPDATE users SET password=$3, session_version=session_version+1
+WHERE username=$1 AND role=$2 AND disabled_at IS NULL`, username, role, hash)
+	if err != nil {
+		return "", "", fmt.Errorf("reset password: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return "", "", errResetTokenInvalid
+	}
+	if _, err := tx.Exec(ctx, `
+UPDATE password_resets SET used_at=now() WHERE username=$1 AND role=$2 AND used_at IS NULL`, username, role); err != nil {
+		return "", "", fmt.Errorf("reset password: %w", err)
+	}
+	if _, err := tx.Exec(ctx, revokeAccountSessions, username, role, revokePasswordReset); err != nil {
+		return "", "", fmt.Errorf("reset password: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return "", "", fmt.Errorf("reset password: %w", err)
+	}
+	return username, role, nil
+}
+
+// limited 判断窗口内的事件数是否已达上限；计数失败时放行，避免数据库抖动把所有人挡在外面
+func limited(c *fiber.Ctx, username, role, kind string, limit int, window time.Duration) bool {
+	ctx := c.UserContext()
+	n, err := authEvents.count(ctx, username, role, kind, window)
+	if err != nil {
+		logging.FromContext(ctx).Error("store operation failed", "op", "auth-rate-limit", "err", err)
+		return false
+	}
+	return n >= limit
+}
+
+func tooManyAttempts(c *fiber.Ctx, wait time.Duration) error {
+	return c.Status(429).JSON(fiber.Map{"error": fmt.Sprintf("尝试次数过多，请 %d 分钟后再试", retryAfter(c, wait))})
+}
+
+// retryAfter 设置 Retry-After 响应头，返回向上取整的等待分钟数用于提示
+func retryAfter(c *fiber.Ctx, wait time.Duration) int {
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	return int(math.Ceil(wait.Minutes()))
+}
+
+// changePassword 校验原密码后设置新密码；所有会话随之失效，当前设备换发新会话的令牌
+func changePassword(c *fiber.Ctx) error {
+	var req struct {
+		OldPassword string `json:"oldPassword"`
+		NewPassword string `json:"newPassword"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request format"})
+	}
+	user := currentUser(c)
+	if limited(c, user.Username, user.Role, eventPasswordChangeFailed, passwordChangeLimit, passwordChangeWindow) {
+		return tooManyAttempts(c, passwordChangeWindow)
+	}
+	if !passwordMatches(user.Password, req.OldPassword) {
+		if err := authEvents.record(c.UserContext(), user.Username, user.Role, eventPasswordChangeFailed, c.IP()); err != nil {
+			logging.FromContext(c.UserContext()).Error("store operation failed", "op", "record-auth-event", "err", err)
+		}
+		return c.Status(403).JSON(fiber.Map{"error": "原密码错误"})
+	}
+	if err := validatePassword(req.NewPassword); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if req.NewPassword == req.OldPassword {
+		return c.Status(400).JSON(fiber.Map{"error": "新密码不能与原密码相同"})
+	}
+
+	version, err := userStore.setPassword(c.UserContext(), user.Username, user.Role, req.NewPassword)
+	if err != nil {
+		return storeError(c, "change password", err)
+	}
+	logging.FromContext(c.UserContext()).Info("password changed", "role", user.Role, "username", user.Username)
+	user.SessionVersion = version
+	resp, err := startSession(c, user)
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("failed to start session", "err", err)
+		return c.Status(500).JSON(fiber.Map{"error": "密码已修改，请重新登录"})
+	}
+	resp["message"] = "密码已修改，其他设备需要重新登录"
+	return c.JSON(resp)
+}
+
+var resetEmailTemplate = template.Must(template.New("reset").Parse(`{{.Name}}，您好：
+
+我们收到了重置您账号（{{.Username}}）密码的请求。请在 {{.TTL}} 分钟内打开以下链接设置新密码：
+
+{{.Link}}
+
+链接只能使用一次。如果这不是您本人的操作，请忽略此邮件，您的密码不会改变。
+
+—— 智能改卷系统
+`))
+
+// forgotPassword 向账号绑定的邮箱发送重置链接；无论账号是否存在都返回相同结果，避免被用来探测账号
+func forgotPassword(c *fiber.Ctx) error {
+	var req struct {
+		Username string `json:"username"`
+		Role     string `json:"role"`
+	}
+	if err := c.BodyParser(&req); err != nil || req.Username == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "请输入账号"})
+	}
+	if req.Role == "" {
+		req.Role = "parent"
+	}
+	ctx := c.UserContext()
+	logger := logging.FromContext(ctx)
+	accepted := fiber.Map{"message": "如果账号存在且绑定了邮箱，重置链接已发送，请查收"}
+
+	// 不论账号是否存在都计数，限流结果不会暴露账号是否存在
+	if limited(c, req.Username, req.Role, eventPasswordResetRequest, resetRequestLimit, resetRequestWindow) {
+		return tooManyAttempts(c, resetRequestWindow)
+	}
+	if err := authEvents.record(ctx, req.Username, req.Role, eventPasswordResetRequest, c.IP()); err != nil {
+		logger.Error("store operation failed", "op", "record-auth-event", "err", err)
+	}
+
+	user, err := userStore.Get(ctx, req.Username, req.Role)
+	if err != nil {
+		if !errors.Is(err, errUserNotFound) {
+			logger.Error("store operation failed", "op", "forgot-password", "err", err)
+		}
+		return c.JSON(accepted)
+	}
+	if user.Disabled || user.Email == "" {
+		return c.JSON(accepted)
+	}
+	if !mailer.Enabled() {
+		logger.Warn("password reset requested but SMTP is not configured", "role", user.Role, "username", user.Username)
+		return c.JSON(accepted)
+	}
+
+	ttl := appConfig.Auth.ResetTokenTTL
+	token, err := passwordResets.create(ctx, user.Username, user.Role, ttl)
+	if err != nil {
+		// 与账号不存在时的响应一致，失败只记日志
+		logger.Error("store operation failed", "op", "create password reset", "err", err)
+		return c.JSON(accepted)
+	}
+	var body bytes.Buffer
+	if err := resetEmailTemplate.Execute(&body, map[string]interface{}{
+		"Name":     firstNonEmpty(user.Name, user.Username),
+		"Username": user.Username,
+		"TTL":      int(ttl.Minutes()),
+		"Link":     strings.TrimRight(appConfig.Server.BaseURL, "/") + "/reset-password?token=" + url.QueryEscape(token),
+	}); err != nil {
+		logger.Error("failed to render reset email", "err", err)
+		return c.JSON(accepted)
+	}
+	// 异步发送：响应时间不随账号是否存在而变化
+	go func() {
+		if err := mailer.Send(user.Email, "重置密码", body.String()); err != nil {
+			logger.Error("failed to send reset email", "role", user.Role, "username", user.Username, "err", err)
+		}
+	}()
+	return c.JSON(accepted)
+}
+
+// resetPassword 用邮件中的令牌设置新密码，成功后该账号所有已登录的会话失效
+func resetPassword(c *fiber.Ctx) error {
+	var req struct {
+		Token       string `json:"token"`
+		NewPassword string `json:"newPassword"`
+	}
+	if err := c.BodyParser(&req); err != nil || req.Token == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request format"})
+	}
+	if err := validatePassword(req.NewPassword); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	username, role, err := passwordResets.consume(c.UserContext(), req.Token, req.NewPassword)
+	if errors.Is(err, errResetTokenInvalid) {
+		return c.Status(400).JSON(fiber.Map{"error": "重置链接无效或已过期，请重新申请"})
+	}
+	if err != nil {
+		return storeError(c, "reset password", err)
+	}
+	logging.FromContext(c.UserContext()).Info("password reset", "role", role, "username", username)
+	return c.JSON(fiber.Map{"message": "密码已重置，请使用新密码登录"})
+}
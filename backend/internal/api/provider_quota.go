@@ -0,0 +1,172 @@
+package api
+
+import (
+	"auto-grad-backend/internal/config"
+	"auto-grad-backend/internal/metrics"
+	"auto-grad-backend/internal/services"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"time"
+)
+
+// 外部服务名称，同时作为 provider_usage 表中的 provider 值
+const (
+	providerBaiduOCR = services.ProviderBaiduOCR
+	providerDeepSeek = services.ProviderDeepSeek
+)
+
+var errQuotaExceeded = errors.New("provider daily quota exceeded")
+
+// quotaError 说明是哪个服务的额度用完，errors.Is(err, errQuotaExceeded) 为真
+type quotaError struct {
+	Provider string
+	Limit    int
+}
+
+func (e *quotaError) Error() string {
+	return fmt.Sprintf("%s 今日调用额度已用完（%d 次），请明天再试", e.Provider, e.Limit)
+}
+
+func (e *quotaError) Is(target error) bool { return target == errQuotaExceeded }
+
+type QuotaStore struct {
+	pool *pgxpool.Pool
+}
+
+func NewQuotaStore(pool *pgxpool.Pool) *QuotaStore {
+	return &QuotaStore{pool: pool}
+}
+
+// quotaDay 按服务器本地时区划分自然日
+func quotaDay(t time.Time) string {
+	return t.Format("2006-01-02")
+}
+
+// consume 原子地把当日调用次数加一；limit>0 且已达上限时不计数并返回 false
+func (s *QuotaStore) consume(ctx context.Context, provider string, limit int) (bool, error) {
+	var calls int
+	err := s.pool.QueryRow(ctx, `
+INSERT INTO provider_usage (provider, day, calls) VALUES ($1, $2, 1)
+ON CONFLICT (provider, day) DO UPDATE SET calls = provider_usage.calls + 1, updated_at = now()
+WHERE $3 <= 0 OR provider_usage.calls < $3
+RETURNING calls`, provider, quotaDay(time.Now()), limit).Scan(&calls)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("consume quota %s: %w", provider, err)
+	}
+	return true, nil
+}
+
+func (s *QuotaStore) calls(ctx context.Context, provider, day string) (int, error) {
+	var calls int
+	err := s.pool.QueryRow(ctx, `SELECT calls FROM provider_usage WHERE provider=$1 AND day=$2`, provider, day).Scan(&calls)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	return calls, err
+}
+
+// providerGate 是调用某个外部服务前必须通过的关口：熔断、限速限并发、扣减当日额度，失败时按策略重试
+type providerGate struct {
+	name       string
+	qps        float64
+	burst      int
+	concurrent int
+	dailyQuota int
+	limiter    *services.ProviderLimiter
+	breaker    *services.CircuitBreaker
+	retry      services.RetryPolicy
+}
+
+// newProviderGate 按服务的限速与额度配置以及共用的重试、熔断配置创建调用关口
+func newProviderGate(name string, limits config.ProviderLimits) *providerGate {
+	res := appConfig.Resilience
+	return &providerGate{
+		name:       name,
+		qps:        limits.QPS,
+		burst:      limits.Burst,
+		concurrent: limits.Concurrency,
+		dailyQuota: limits.DailyQuota,
+		limiter:    services.NewProviderLimiter(limits.QPS, limits.Burst, limits.Concurrency),
+		breaker:    services.NewCircuitBreaker(res.BreakerThreshold, res.BreakerCooldown),
+		retry: services.RetryPolicy{
+			MaxAttempts: res.MaxAttempts,
+			BaseDelay:   res.RetryBaseDelay,
+			MaxDelay:    res.RetryMaxDelay,
+		},
+	}
+}
+
+// call 经熔断与重试执行一次外部调用，每次尝试都重新申请调用名额
+func (g *providerGate) call(ctx context.Context, fn func(ctx context.Context) error) error {
+	err := g.retry.Do(ctx, g.breaker, func(ctx context.Context) error {
+		release, err := g.acquire(ctx)
+		if err != nil {
+			return err
+		}
+		defer release()
+		err = fn(ctx)
+		recordProviderError(g.name, err)
+		return err
+	})
+	// 名额与额度错误不经过上面的 fn，在这里统一计数
+	if errors.Is(err, errQuotaExceeded) || errors.Is(err, services.ErrCircuitOpen) {
+		recordProviderError(g.name, err)
+	}
+	return err
+}
+
+// acquire 等待调用名额；额度用完时返回 *quotaError。成功后调用方须在请求结束时调用 release
+func (g *providerGate) acquire(ctx context.Context) (func(), error) {
+	queued := metrics.QueueDepth.WithLabelValues(g.name)
+	queued.Inc()
+	release, err := g.limiter.Acquire(ctx)
+	queued.Dec()
+	if err != nil {
+		return nil, err
+	}
+	ok, err := quotaStore.consume(ctx, g.name, g.dailyQuota)
+	if err != nil {
+		release()
+		// 不保留底层错误链，避免数据库的网络故障被当成服务商故障而重试或触发熔断
+		return nil, fmt.Errorf("check quota: %v", err)
+	}
+	if !ok {
+		release()
+		return nil, &quotaError{Provider: g.name, Limit: g.dailyQuota}
+	}
+	inflight := metrics.ProviderInflight.WithLabelValues(g.name)
+	inflight.Inc()
+	return func() {
+		inflight.Dec()
+		release()
+	}, nil
+}
+
+func getProviderUsage(c *fiber.Ctx) error {
+	if _, ok := requireTeacher(c); !ok {
+		return c.Status(403).JSON(fiber.Map{"error": "仅教师可以查看调用额度"})
+	}
+	day := quotaDay(time.Now())
+	providers := []fiber.Map{}
+	for _, g := range []*providerGate{baiduGate, deepSeekGate} {
+		calls, err := quotaStore.calls(c.UserContext(), g.name, day)
+		if err != nil {
+			return storeError(c, "get provider usage", err)
+		}
+		providers = append(providers, fiber.Map{
+			"provider":    g.name,
+			"calls":       calls,
+			"dailyQuota":  g.dailyQuota,
+			"qps":         g.qps,
+			"concurrency": g.concurrent,
+		})
+	}
+	return c.JSON(fiber.Map{"day": day, "providers": providers})
+}
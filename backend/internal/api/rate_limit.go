@@ -0,0 +1,199 @@
+package api
+
+import (
+	"auto-grad-backend/internal/logging"
+	"auto-grad-backend/internal/metrics"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"strconv"
+	"time"
+)
+
+// RateLimitStore 保存登录失败锁定与接口限流的计数，存在 Postgres 中以便多个实例共享
+type RateLimitStore struct {
+	pool *pgxpool.Pool
+}
+
+func NewRateLimitStore(pool *pgxpool.Pool) *RateLimitStore {
+	return &RateLimitStore{pool: pool}
+}
+
+// lockedFor 返回 keys 中最晚解除的锁定还剩多久，均未锁定时为 0
+func (s *RateLimitStore) lockedFor(ctx context.Context, keys ...string) (time.Duration, error) {
+	var seconds float64
+	err := s.pool.QueryRow(ctx, `
+SELECT coalesce(extract(epoch FROM max(locked_until) - now()), 0)::float8
+FROM login_throttle WHERE key = ANY($1) AND locked_until > now()`, keys).Scan(&seconds)
+	if err != nil {
+		return 0, fmt.Errorf("check login lockout: %w", err)
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// recordFailure 记一次登录失败，距上次失败超过 window 时重新计数；
+// 达到 threshold 后锁定，返回本次的锁定时长，未锁定时为 0
+func (s *RateLimitStore) recordFailure(ctx context.Context, key string, threshold int, window, base, max time.Duration) (time.Duration, error) {
+	var failures int
+	err := s.pool.QueryRow(ctx, `
+INSERT INTO login_throttle (key, failures) VALUES ($1, 1)
+ON CONFLICT (key) DO UPDATE SET
+  failures = CASE WHEN login_throttle.last_failure_at < now() - make_interval(secs => $2) THEN 1 ELSE login_throttle.failures + 1 END,
+  last_failure_at = now()
+RETURNING failures`, key, window.Seconds()).Scan(&failures)
+	if err != nil {
+		return 0, fmt.Errorf("record login failure: %w", err)
+	}
+	lock := lockoutFor(failures, threshold, base, max)
+	if lock <= 0 {
+		return 0, nil
+	}
+	if _, err := s.pool.Exec(ctx, `UPDATE login_throttle SET locked_until = now() + make_interval(secs => $2) WHERE key=$1`, key, lock.Seconds()); err != nil {
+		return 0, fmt.Errorf("lock login: %w", err)
+	}
+	return lock, nil
+}
+
+// lockoutFor 计算第 failures 次失败后的锁定时长：达到 threshold 时锁定 base，此后每次加倍，最长 max
+func lockoutFor(failures, threshold int, base, max time.Duration) time.Duration {
+	if failures < threshold {
+		return 0
+	}
+	d := base
+	for i := threshold; i < failures && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
+
+// reset 清除 key 的失败计数与锁定
+func (s *RateLimitStore) reset(ctx context.Context, key string) error {
+	if _, err := s.pool.Exec(ctx, `DELETE FROM login_throttle WHERE key=$1`, key); err != nil {
+		return fmt.Errorf("reset login failures: %w", err)
+	}
+	return nil
+}
+
+// hit 在 key 的当前固定窗口内计数一次并返回剩余次数；已达 limit 时不计数，返回 false 与距窗口结束的时间
+func (s *RateLimitStore) hit(ctx context.Context, key string, limit int, window time.Duration) (int, time.Duration, bool, error) {
+	start, retry := fixedWindow(time.Now(), window)
+	var count int
+	err := s.pool.QueryRow(ctx, `
+INSERT INTO rate_limit_counters (key, window_start, count) VALUES ($1, $2, 1)
+ON CONFLICT (key) DO UPDATE SET
+  count = CASE WHEN rate_limit_counters.window_start = $2 THEN rate_limit_counters.count + 1 ELSE 1 END,
+  window_start = $2
+WHERE rate_limit_counters.window_start <> $2 OR rate_limit_counters.count < $3
+RETURNING count`, key, start, limit).Scan(&count)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, retry, false, nil
+	}
+	if err != nil {
+		return 0, 0, false, fmt.Errorf("rate limit %s: %w", key, err)
+	}
+	return limit - count, 0, true, nil
+}
+
+// fixedWindow 返回 now 所在固定窗口的起点与距窗口结束的时间；窗口按 Unix 零点对齐，各实例一致
+func fixedWindow(now time.Time, window time.Duration) (time.Time, time.Duration) {
+	start := now.Truncate(window)
+	return start, start.Add(window).Sub(now)
+}
+
+// UnlockLogin 清除账号的登录失败计数与锁定，供管理员在用户确认身份后解锁
+func (s *RateLimitStore) UnlockLogin(ctx context.Context, username, role string) error {
+	return s.reset(ctx, loginAccountKey(username, role))
+}
+
+func loginAccountKey(username, role string) string {
+	return "account:" + role + ":" + username
+}
+
+func loginIPKey(ip string) string {
+	return "ip:" + ip
+}
+
+// loginLockedFor 返回账号的剩余锁定时间，在校验密码之前检查；来源 IP 的锁定由 loginFailed 处理
+func loginLockedFor(c *fiber.Ctx, username, role string) time.Duration {
+	return lockedFor(c, loginAccountKey(username, role))
+}
+
+// lockedFor 查询失败时放行，与 limitSubmissions 一致
+func lockedFor(c *fiber.Ctx, key string) time.Duration {
+	ctx := c.UserContext()
+	wait, err := rateLimits.lockedFor(ctx, key)
+	if err != nil {
+		logging.FromContext(ctx).Error("store operation failed", "op", "login-lockout", "err", err)
+		return 0
+	}
+	return wait
+}
+
+// loginFailed 为账号与来源 IP 各记一次失败，返回应拒绝的锁定时长。
+// 账号不存在时同样计数，锁定行为不暴露账号是否存在。
+// 来源 IP 已锁定时只计账号失败并返回 IP 的剩余锁定时长：IP 锁定只拒绝错误的密码，
+// 学校等共享出口后的用户仍可用正确的密码登录
+func loginFailed(c *fiber.Ctx, username, role string) time.Duration {
+	ctx := c.UserContext()
+	rl := appConfig.RateLimit
+	type limiter struct {
+		name, key string
+		threshold int
+	}
+	limiters := []limiter{{"login_account", loginAccountKey(username, role), rl.LoginAccountFailures}}
+	lock := lockedFor(c, loginIPKey(c.IP()))
+	if lock == 0 {
+		limiters = append(limiters, limiter{"login_ip", loginIPKey(c.IP()), rl.LoginIPFailures})
+	}
+	for _, l := range limiters {
+		d, err := rateLimits.recordFailure(ctx, l.key, l.threshold, rl.LoginWindow, rl.LoginLockout, rl.LoginMaxLockout)
+		if err != nil {
+			logging.FromContext(ctx).Error("store operation failed", "op", "login-failure", "err", err)
+			continue
+		}
+		if d > 0 {
+			logging.FromContext(ctx).Warn("login locked", "limiter", l.name, "role", role, "username", username, "ip", c.IP(), "lockout", d.String())
+		}
+		if d > lock {
+			lock = d
+		}
+	}
+	return lock
+}
+
+// loginSucceeded 清除账号的失败计数；来源 IP 的计数保留，避免用一个已知账号为猜测其他账号解锁
+func loginSucceeded(c *fiber.Ctx, username, role string) {
+	if err := rateLimits.reset(c.UserContext(), loginAccountKey(username, role)); err != nil {
+		logging.FromContext(c.UserContext()).Error("store operation failed", "op", "login-reset", "err", err)
+	}
+}
+
+// limitSubmissions 限制每个用户提交改卷的频率，这些请求会调用按次计费的 OCR 与大模型。
+// 放在 requireAuth 之后；计数失败时放行
+func limitSubmissions(c *fiber.Ctx) error {
+	rl := appConfig.RateLimit
+	if rl.SubmitLimit <= 0 {
+		return c.Next()
+	}
+	user := currentUser(c)
+	key := "submit:user:" + user.Role + ":" + user.Username
+	ctx := c.UserContext()
+	remaining, wait, ok, err := rateLimits.hit(ctx, key, rl.SubmitLimit, rl.SubmitWindow)
+	if err != nil {
+		logging.FromContext(ctx).Error("store operation failed", "op", "submit-rate-limit", "err", err)
+		return c.Next()
+	}
+	c.Set("X-RateLimit-Limit", strconv.Itoa(rl.SubmitLimit))
+	c.Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+	if !ok {
+		metrics.RateLimited.WithLabelValues("submit").Inc()
+		return c.Status(429).JSON(fiber.Map{"error": fmt.Sprintf("提交过于频繁，请 %d 分钟后再试", retryAfter(c, wait))})
+	}
+	return c.Next()
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockoutFor(t *testing.T) {
+	const base, max = time.Minute, 10 * time.Minute
+	tests := []struct {
+		failures, threshold int
+		want                time.Duration
+	}{
+		{0, 5, 0},
+		{4, 5, 0},
+		{5, 5, time.Minute},
+		{6, 5, 2 * time.Minute},
+		{7, 5, 4 * time.Minute},
+		{8, 5, 8 * time.Minute},
+		{9, 5, max},
+		{100, 5, max},
+		{1, 1, time.Minute},
+	}
+	for _, tt := range tests {
+		if got := lockoutFor(tt.failures, tt.threshold, base, max); got != tt.want {
+			t.Errorf("lockoutFor(%d, %d) = %v, want %v", tt.failures, tt.threshold, got, tt.want)
+		}
+	}
+	// base 超过 max 时以 max 为准
+	if got := lockoutFor(5, 5, time.Hour, max); got != max {
+		t.Errorf("lockoutFor with base > max = %v, want %v", got, max)
+	}
+}
+
+func TestFixedWindow(t *testing.T) {
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		now       time.Time
+		window    time.Duration
+		wantStart time.Time
+		wantRetry time.Duration
+	}{
+		{"window start", day.Add(10 * time.Minute), time.Minute, day.Add(10 * time.Minute), time.Minute},
+		{"inside window", day.Add(10*time.Minute + 15*time.Second), time.Minute, day.Add(10 * time.Minute), 45 * time.Second},
+		{"just before end", day.Add(time.Hour - time.Millisecond), time.Hour, day, time.Millisecond},
+		{"daily window", day.Add(13 * time.Hour), 24 * time.Hour, day, 11 * time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, retry := fixedWindow(tt.now, tt.window)
+			if !start.Equal(tt.wantStart) || retry != tt.wantRetry {
+				t.Fatalf("fixedWindow = %v, %v; want %v, %v", start, retry, tt.wantStart, tt.wantRetry)
+			}
+		})
+	}
+	// 同一窗口内的两次请求得到相同的起点，跨窗口时起点不同
+	a, _ := fixedWindow(day.Add(5*time.Second), time.Minute)
+	b, _ := fixedWindow(day.Add(59*time.Second), time.Minute)
+	c, _ := fixedWindow(day.Add(61*time.Second), time.Minute)
+	if !a.Equal(b) || a.Equal(c) {
+		t.Fatalf("window starts %v, %v, %v", a, b, c)
+	}
+}
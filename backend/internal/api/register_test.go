@@ -0,0 +1,38 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// 这些请求在写库之前就被拒绝，不需要数据库
+func TestUserRegisterRejectsInvalidInput(t *testing.T) {
+	app := fiber.New()
+	app.Post("/register", userRegister)
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"admin role", `{"openId":"mallory","password":"long-enough-pw","confirmPassword":"long-enough-pw","userRole":"admin"}`},
+		{"unknown role", `{"openId":"mallory","password":"long-enough-pw","confirmPassword":"long-enough-pw","userRole":"root"}`},
+		{"missing fields", `{"openId":"mallory"}`},
+		{"password too short", `{"openId":"mallory","password":"short","confirmPassword":"short"}`},
+		{"passwords differ", `{"openId":"mallory","password":"long-enough-pw","confirmPassword":"other-password"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/register", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != 400 {
+				t.Fatalf("status = %d, want 400", resp.StatusCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"auto-grad-backend/internal/logging"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// 只接受上游传入的简单 ID，避免日志注入
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// requestLogger 为每个请求分配 request ID（沿用上游的 X-Request-ID），
+// 把带 request_id 的 logger 放进 UserContext，并在请求结束时输出一条访问日志
+func requestLogger(c *fiber.Ctx) error {
+	id := c.Get(requestIDHeader)
+	if !validRequestID.MatchString(id) {
+		id = utils.UUIDv4()
+	}
+	c.Set(requestIDHeader, id)
+	ctx, logger := logging.With(c.UserContext(), "request_id", id)
+	c.SetUserContext(ctx)
+
+	start := time.Now()
+	err := c.Next()
+	status := responseStatus(c, err)
+	level := slog.LevelInfo
+	switch {
+	case status >= 500:
+		level = slog.LevelError
+	case strings.HasPrefix(c.Path(), "/health") || c.Path() == "/metrics":
+		// 探针请求频繁，默认级别下不输出
+		level = slog.LevelDebug
+	}
+	logger.LogAttrs(ctx, level, "http request",
+		slog.String("method", c.Method()),
+		slog.String("route", c.Route().Path),
+		slog.String("path", c.Path()),
+		slog.Int("status", status),
+		slog.Int64("duration_ms", time.Since(start).Milliseconds()),
+		slog.String("ip", c.IP()),
+	)
+	return err
+}
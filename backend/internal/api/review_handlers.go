@@ -0,0 +1,305 @@
+package api
+
+import (
+	"auto-grad-backend/internal/events"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"time"
+)
+
+// ReviewEntry 是复核审计记录：系统标记、教师确认或改分都会留痕
+type ReviewEntry struct {
+	ID            int64   `json:"id"`
+	GradingID     string  `json:"gradingId"`
+	Action        string  `json:"action"` // flagged, approved, overridden
+	AiScore       int     `json:"aiScore"`
+	ReviewerScore *int    `json:"reviewerScore,omitempty"`
+	Confidence    float64 `json:"confidence"`
+	ActorUsername string  `json:"actorUsername,omitempty"`
+	ActorRole     string  `json:"actorRole,omitempty"`
+	Note          string  `json:"note,omitempty"`
+	CreatedAt     string  `json:"createdAt"`
+}
+
+type ReviewStore struct {
+	pool *pgxpool.Pool
+}
+
+func NewReviewStore(pool *pgxpool.Pool) *ReviewStore {
+	return &ReviewStore{pool: pool}
+}
+
+// errNotInReview 表示评分已不在复核队列中，通常是被其他教师抢先处理
+var errNotInReview = errors.New("该评分不在复核队列中")
+
+func (s *ReviewStore) record(ctx context.Context, e ReviewEntry) error {
+	return insertReview(ctx, s.pool, e)
+}
+
+func insertReview(ctx context.Context, db execer, e ReviewEntry) error {
+	_, err := db.Exec(ctx, `
+INSERT INTO grading_reviews (grading_id, action, ai_score, reviewer_score, confidence, actor_username, actor_role, note)
+VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
+`, e.GradingID, e.Action, e.AiScore, e.ReviewerScore, e.Confidence, e.ActorUsername, e.ActorRole, e.Note)
+	return err
+}
+
+// reviewQueue 列出教师可以复核的评分：自己提交的以及所带班级学生的，先提交的在前
+func (s *GradingStore) reviewQueue(ctx context.Context, username, role string) ([]GradingRequest, error) {
+	return s.query(ctx, `SELECT `+gradingColumns+` FROM gradings
+WHERE status='needs_review' AND (
+  (owner_username=$1 AND owner_role=$2)
+  OR student_id IN (
+    SELECT e.student_id FROM class_enrollments e JOIN classes c ON c.id = e.class_id
+    WHERE c.owner_username=$1 AND c.owner_role=$2))
+ORDER BY submit_time ASC`, username, role)
+}
+
+// review 锁定仍在复核队列中的评分，在同一事务中应用 fn 并写入 entry 生成的复核记录，
+// rev 非 nil 时一并写入修订记录；评分已离开复核队列时返回 errNotInReview
+func (s *GradingStore) review(ctx context.Context, id string, fn func(*GradingRequest), entry func(*GradingRequest) ReviewEntry, rev func(*GradingRequest) GradingRevision) (*GradingRequest, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("review grading %s: %w", id, err)
+	}
+	defer tx.Rollback(ctx)
+	var item GradingRequest
+	if err := scanGrading(tx.QueryRow(ctx, `SELECT `+gradingColumns+` FROM gradings WHERE id=$1 FOR UPDATE`, id), &item); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errGradingNotFound
+		}
+		return nil, fmt.Errorf("review grading %s: %w", id, err)
+	}
+	if item.Status != "needs_review" {
+		return nil, errNotInReview
+	}
+	fn(&item)
+	if err := saveGrading(ctx, tx, &item); err != nil {
+		return nil, err
+	}
+	if rev != nil {
+		if err := insertRevision(ctx, tx, rev(&item)); err != nil {
+			return nil, fmt.Errorf("review grading %s: record revision: %w", id, err)
+		}
+	}
+	if err := insertReview(ctx, tx, entry(&item)); err != nil {
+		return nil, fmt.Errorf("review grading %s: record review entry: %w", id, err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("review grading %s: %w", id, err)
+	}
+	return &item, nil
+}
+
+func (s *ReviewStore) list(ctx context.Context, gradingID string) ([]ReviewEntry, error) {
+	rows, err := s.pool.Query(ctx, `
+SELECT id, grading_id, action, ai_score, reviewer_score, confidence, actor_username, actor_role, note, created_at
+FROM grading_reviews WHERE grading_id=$1 ORDER BY created_at ASC, id ASC`, gradingID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	entries := []ReviewEntry{}
+	for rows.Next() {
+		var e ReviewEntry
+		var created time.Time
+		if err := rows.Scan(&e.ID, &e.GradingID, &e.Action, &e.AiScore, &e.ReviewerScore, &e.Confidence, &e.ActorUsername, &e.ActorRole, &e.Note, &created); err != nil {
+			return nil, err
+		}
+		e.CreatedAt = created.Format(time.RFC3339)
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// reviewThreshold 综合置信度低于该值的评分进入人工复核
+func reviewThreshold() float64 {
+	return appConfig.Grading.ReviewThreshold
+}
+
+// doublePassEnabled 开启后每份试卷评分两次，用两次分差衡量一致性
+func doublePassEnabled() bool {
+	return appConfig.Grading.DoublePass
+}
+
+func requireTeacher(c *fiber.Ctx) (User, bool) {
+	user := currentUser(c)
+	return user, user.Role == "teacher"
+}
+
+// ownsGrading 报告评分是否由 user 提交
+func ownsGrading(user User, item *GradingRequest) bool {
+	return item.OwnerUsername == user.Username && item.OwnerRole == user.Role
+}
+
+// publishReviewed 复核使评分离开 needs_review 时补发完成事件，邮件与 Webhook 据此通知；
+// 对已完成的评分再次改分不重复通知
+func publishReviewed(before, after *GradingRequest) {
+	if before.Status != "needs_review" || after.Status != "completed" {
+		return
+	}
+	publishGrading(after.ID, events.StageCompleted, "", map[string]interface{}{
+		"status":     after.Status,
+		"score":      after.Score,
+		"confidence": after.Confidence,
+		"reviewedBy": after.ReviewedBy,
+	})
+}
+
+func listReviewQueue(c *fiber.Ctx) error {
+	user, ok := requireTeacher(c)
+	if !ok {
+		return c.Status(403).JSON(fiber.Map{"error": "仅教师可以复核评分"})
+	}
+	items, err := gradingStore.reviewQueue(c.UserContext(), user.Username, user.Role)
+	if err != nil {
+		return storeError(c, "list review queue", err)
+	}
+	return c.JSON(fiber.Map{
+		"items":     items,
+		"total":     len(items),
+		"threshold": reviewThreshold(),
+	})
+}
+
+// getReviewAudit 可以查看该评分的用户（提交者、班级教师、孩子的家长）可以查看复核记录
+func getReviewAudit(c *fiber.Ctx) error {
+	id := c.Params("id")
+	item, err := gradingStore.get(c.UserContext(), id)
+	if err != nil {
+		return storeError(c, "get grading", err)
+	}
+	if ok, err := canAccessGrading(c.UserContext(), currentUser(c), item); err != nil {
+		return storeError(c, "check grading access", err)
+	} else if !ok {
+		return c.Status(403).JSON(fiber.Map{"error": "无权查看该评分"})
+	}
+	entries, err := reviewStore.list(c.UserContext(), id)
+	if err != nil {
+		return storeError(c, "list review entries", err)
+	}
+	return c.JSON(fiber.Map{
+		"gradingId": id,
+		"entries":   entries,
+	})
+}
+
+// reviewableGrading 读取评分并确认当前教师可以复核；不可复核时已写好响应，返回 nil
+func reviewableGrading(c *fiber.Ctx) (User, *GradingRequest, error) {
+	user, ok := requireTeacher(c)
+	if !ok {
+		return user, nil, c.Status(403).JSON(fiber.Map{"error": "仅教师可以复核评分"})
+	}
+	item, err := gradingStore.get(c.UserContext(), c.Params("id"))
+	if err != nil {
+		return user, nil, storeError(c, "get grading", err)
+	}
+	if ok, err := canEditGrading(c.UserContext(), user, item); err != nil {
+		return user, nil, storeError(c, "check grading access", err)
+	} else if !ok {
+		return user, nil, c.Status(403).JSON(fiber.Map{"error": "无权复核该评分"})
+	}
+	// 已完成的评分改分须经 PUT /api/grading/:id/score 并填写原因
+	if item.Status != "needs_review" {
+		return user, nil, c.Status(409).JSON(fiber.Map{"error": errNotInReview.Error()})
+	}
+	return user, item, nil
+}
+
+func approveReview(c *fiber.Ctx) error {
+	type Req struct {
+		Note string `json:"note"`
+	}
+	var req Req
+	_ = c.BodyParser(&req)
+
+	user, item, err := reviewableGrading(c)
+	if item == nil {
+		return err
+	}
+	updated, err := gradingStore.review(c.UserContext(), item.ID, func(r *GradingRequest) {
+		r.Status = "completed"
+		r.ReviewedBy = user.Username
+		r.ReviewedAt = time.Now().Format(time.RFC3339)
+		r.ReviewNote = req.Note
+	}, func(r *GradingRequest) ReviewEntry {
+		reviewerScore := r.Score
+		return ReviewEntry{
+			GradingID:     r.ID,
+			Action:        "approved",
+			AiScore:       r.AiScore,
+			ReviewerScore: &reviewerScore,
+			Confidence:    r.Confidence,
+			ActorUsername: user.Username,
+			ActorRole:     user.Role,
+			Note:          req.Note,
+		}
+	}, nil)
+	if err != nil {
+		return storeError(c, "approve review", err)
+	}
+	publishReviewed(item, updated)
+	return c.JSON(updated)
+}
+
+func overrideReview(c *fiber.Ctx) error {
+	type Req struct {
+		Score    *int   `json:"score"`
+		Feedback string `json:"feedback"`
+		Note     string `json:"note"`
+	}
+	var req Req
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+	}
+
+	user, item, err := reviewableGrading(c)
+	if item == nil {
+		return err
+	}
+	if req.Score == nil || *req.Score < 0 || *req.Score > item.TotalScore {
+		return c.Status(400).JSON(fiber.Map{"error": "分数超出范围"})
+	}
+
+	updated, err := gradingStore.review(c.UserContext(), item.ID, func(r *GradingRequest) {
+		r.Status = "completed"
+		r.Score = *req.Score
+		if req.Feedback != "" {
+			r.Feedback = req.Feedback
+		}
+		r.ReviewedBy = user.Username
+		r.ReviewedAt = time.Now().Format(time.RFC3339)
+		r.ReviewNote = req.Note
+	}, func(r *GradingRequest) ReviewEntry {
+		return ReviewEntry{
+			GradingID:     r.ID,
+			Action:        "overridden",
+			AiScore:       r.AiScore,
+			ReviewerScore: req.Score,
+			Confidence:    r.Confidence,
+			ActorUsername: user.Username,
+			ActorRole:     user.Role,
+			Note:          req.Note,
+		}
+	}, func(r *GradingRequest) GradingRevision {
+		return GradingRevision{
+			GradingID:     r.ID,
+			Kind:          "review",
+			Score:         r.Score,
+			AiScore:       r.AiScore,
+			Feedback:      r.Feedback,
+			ActorUsername: user.Username,
+			ActorRole:     user.Role,
+			Reason:        req.Note,
+		}
+	})
+	if err != nil {
+		return storeError(c, "override review", err)
+	}
+	publishReviewed(item, updated)
+	return c.JSON(updated)
+}
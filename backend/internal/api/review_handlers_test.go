@@ -0,0 +1,109 @@
+package api
+
+import (
+	"auto-grad-backend/internal/events"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPublishReviewed(t *testing.T) {
+	tests := []struct {
+		name          string
+		before, after string
+		want          bool
+	}{
+		{"approved from review queue", "needs_review", "completed", true},
+		{"override of completed grading", "completed", "completed", false},
+		{"still under review", "needs_review", "needs_review", false},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id := "review_test_" + string(rune('a'+i))
+			ch, cancel := events.Default.Subscribe(events.GradingTopic(id))
+			defer cancel()
+
+			publishReviewed(&GradingRequest{ID: id, Status: tt.before}, &GradingRequest{ID: id, Status: tt.after, Score: 88, ReviewedBy: "t"})
+			select {
+			case e := <-ch:
+				if !tt.want {
+					t.Fatalf("unexpected event %+v", e)
+				}
+				if e.Type != events.StageCompleted || e.Data["score"] != 88 {
+					t.Fatalf("event = %+v, want completed with score 88", e)
+				}
+			case <-time.After(100 * time.Millisecond):
+				if tt.want {
+					t.Fatal("no completion event published")
+				}
+			}
+		})
+	}
+}
+
+func TestOwnsGrading(t *testing.T) {
+	item := &GradingRequest{OwnerUsername: "p1", OwnerRole: "parent"}
+	tests := []struct {
+		user User
+		want bool
+	}{
+		{User{Username: "p1", Role: "parent"}, true},
+		{User{Username: "p1", Role: "teacher"}, false},
+		{User{Username: "p2", Role: "parent"}, false},
+	}
+	for _, tt := range tests {
+		if got := ownsGrading(tt.user, item); got != tt.want {
+			t.Errorf("ownsGrading(%s/%s) = %v, want %v", tt.user.Role, tt.user.Username, got, tt.want)
+		}
+	}
+}
+
+// 非教师在读库之前就被拒绝，不需要数据库
+func TestReviewHandlersRequireTeacher(t *testing.T) {
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals(localUser, User{Username: "p1", Role: "parent"})
+		return c.Next()
+	})
+	app.Get("/queue", listReviewQueue)
+	app.Post("/:id/approve", approveReview)
+	app.Post("/:id/override", overrideReview)
+
+	tests := []struct {
+		method, path string
+	}{
+		{"GET", "/queue"},
+		{"POST", "/grading_1/approve"},
+		{"POST", "/grading_1/override"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(`{"score":80}`))
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != 403 {
+				t.Fatalf("status = %d, want 403", resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestStoreErrorReviewConflict(t *testing.T) {
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error {
+		return storeError(c, "approve review", fmt.Errorf("review grading g1: %w", errNotInReview))
+	})
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 409 {
+		t.Fatalf("status = %d, want 409", resp.StatusCode)
+	}
+}
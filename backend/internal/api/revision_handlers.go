@@ -0,0 +1,157 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"strings"
+	"time"
+)
+
+// GradingRevision 记录一次评分结果：每次 AI 评分和每次人工改分各一条
+type GradingRevision struct {
+	ID            int64  `json:"id"`
+	GradingID     string `json:"gradingId"`
+	Kind          string `json:"kind"` // ai, manual, review
+	Score         int    `json:"score"`
+	AiScore       int    `json:"aiScore"`
+	Feedback      string `json:"feedback,omitempty"`
+	Model         string `json:"model,omitempty"`
+	PromptVersion string `json:"promptVersion,omitempty"`
+	ActorUsername string `json:"actorUsername,omitempty"`
+	ActorRole     string `json:"actorRole,omitempty"`
+	Reason        string `json:"reason,omitempty"`
+	CreatedAt     string `json:"createdAt"`
+}
+
+type RevisionStore struct {
+	pool *pgxpool.Pool
+}
+
+func NewRevisionStore(pool *pgxpool.Pool) *RevisionStore {
+	return &RevisionStore{pool: pool}
+}
+
+func (s *RevisionStore) add(ctx context.Context, r GradingRevision) error {
+	return insertRevision(ctx, s.pool, r)
+}
+
+func insertRevision(ctx context.Context, db execer, r GradingRevision) error {
+	_, err := db.Exec(ctx, `
+INSERT INTO grading_revisions (grading_id, kind, score, ai_score, feedback, model, prompt_version, actor_username, actor_role, reason)
+VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)
+`, r.GradingID, r.Kind, r.Score, r.AiScore, r.Feedback, r.Model, r.PromptVersion, r.ActorUsername, r.ActorRole, r.Reason)
+	return err
+}
+
+func (s *RevisionStore) list(ctx context.Context, gradingID string) ([]GradingRevision, error) {
+	rows, err := s.pool.Query(ctx, `
+SELECT id, grading_id, kind, score, ai_score, feedback, model, prompt_version, actor_username, actor_role, reason, created_at
+FROM grading_revisions WHERE grading_id=$1 ORDER BY created_at ASC, id ASC`, gradingID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	revisions := []GradingRevision{}
+	for rows.Next() {
+		var r GradingRevision
+		var created time.Time
+		if err := rows.Scan(&r.ID, &r.GradingID, &r.Kind, &r.Score, &r.AiScore, &r.Feedback, &r.Model, &r.PromptVersion, &r.ActorUsername, &r.ActorRole, &r.Reason, &created); err != nil {
+			return nil, err
+		}
+		r.CreatedAt = created.Format(time.RFC3339)
+		revisions = append(revisions, r)
+	}
+	return revisions, rows.Err()
+}
+
+// canEditGrading 提交者可以修改自己的评分；教师还可以修改其班级名单中学生的评分
+func canEditGrading(ctx context.Context, user User, item *GradingRequest) (bool, error) {
+	if ownsGrading(user, item) {
+		return true, nil
+	}
+	if user.Role != "teacher" || item.StudentID == 0 {
+		return false, nil
+	}
+	_, err := classStore.teacherStudent(ctx, item.StudentID, user.Username, user.Role)
+	if errors.Is(err, errStudentNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// canAccessGrading 可修改评分的用户以及该学生的家长可以查看评分
+func canAccessGrading(ctx context.Context, user User, item *GradingRequest) (bool, error) {
+	if ok, err := canEditGrading(ctx, user, item); ok || err != nil {
+		return ok, err
+	}
+	if item.StudentID == 0 {
+		return false, nil
+	}
+	_, err := studentStore.get(ctx, item.StudentID, user.Username, user.Role)
+	if errors.Is(err, errStudentNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func updateGradingScore(c *fiber.Ctx) error {
+	type Req struct {
+		Score    *int   `json:"score"`
+		Feedback string `json:"feedback"`
+		Reason   string `json:"reason"`
+	}
+	var req Req
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "请填写改分原因"})
+	}
+
+	user := currentUser(c)
+	id := c.Params("id")
+	item, err := gradingStore.get(c.UserContext(), id)
+	if err != nil {
+		return storeError(c, "get grading", err)
+	}
+	if ok, err := canEditGrading(c.UserContext(), user, item); err != nil {
+		return storeError(c, "check grading access", err)
+	} else if !ok {
+		return c.Status(403).JSON(fiber.Map{"error": "无权修改该评分"})
+	}
+	if req.Score == nil || *req.Score < 0 || *req.Score > item.TotalScore {
+		return c.Status(400).JSON(fiber.Map{"error": "分数超出范围"})
+	}
+	// 复核队列中的评分须经 /api/review/:id/override 改分，保留复核记录
+	if item.Status == "needs_review" {
+		return c.Status(409).JSON(fiber.Map{"error": "该评分正在等待复核，请通过复核改分", "override": "/api/review/" + id + "/override"})
+	}
+	if item.Status != "completed" {
+		return c.Status(409).JSON(fiber.Map{"error": "评分尚未完成，无法改分"})
+	}
+
+	updated, err := gradingStore.updateWithRevision(c.UserContext(), id, func(r *GradingRequest) {
+		r.Score = *req.Score
+		if req.Feedback != "" {
+			r.Feedback = req.Feedback
+		}
+	}, func(r *GradingRequest) GradingRevision {
+		return GradingRevision{
+			GradingID:     id,
+			Kind:          "manual",
+			Score:         r.Score,
+			AiScore:       r.AiScore,
+			Feedback:      r.Feedback,
+			ActorUsername: user.Username,
+			ActorRole:     user.Role,
+			Reason:        req.Reason,
+		}
+	})
+	if err != nil {
+		return storeError(c, "update grading score", err)
+	}
+	return c.JSON(updated)
+}
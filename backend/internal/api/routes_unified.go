@@ -1,18 +1,20 @@
 package api
 
 import (
-	"bytes"
+	"auto-grad-backend/internal/config"
+	"auto-grad-backend/internal/events"
+	"auto-grad-backend/internal/logging"
+	"auto-grad-backend/internal/metrics"
+	"auto-grad-backend/internal/services"
 	"context"
-	"encoding/base64"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
-	"io"
-	"log"
-	"net/http"
-	"net/url"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
@@ -20,10 +22,31 @@ import (
 )
 
 // 统一系统路由设置 - 支持家长端和教师端
-var teacherHandler = &TeacherTaskHandler{}
+var teacherHandler = NewTeacherTaskHandler()
 var gradingStore *GradingStore
 var userStore *UserStore
 var pgPool *pgxpool.Pool
+var reviewStore *ReviewStore
+var revisionStore *RevisionStore
+var webhookStore *WebhookStore
+var mailer *services.Mailer
+var baiduTokens *services.BaiduTokenCache
+var ocrService *services.BaiduOCRService
+var scorer *services.DeepSeekService
+var quotaStore *QuotaStore
+var baiduGate, deepSeekGate *providerGate
+var usageStore *UsageStore
+var authService *services.AuthService
+var authEvents *AuthEventStore
+var passwordResets *PasswordResetStore
+var sessionStore *SessionStore
+var rateLimits *RateLimitStore
+var studentStore *StudentStore
+var classStore *ClassStore
+var llmPrices = services.DefaultPriceTable()
+
+// appConfig 是启动时加载并校验过的配置，未调用 SetupUnifiedRoutes 时为默认配置
+var appConfig = config.Default()
 
 type GradingRequest struct {
 	ID            string   `json:"id"`
@@ -43,6 +66,12 @@ type GradingRequest struct {
 	OcrResult     string   `json:"ocrResult,omitempty"`
 	OwnerUsername string   `json:"ownerUsername,omitempty"`
 	OwnerRole     string   `json:"ownerRole,omitempty"`
+	Confidence    float64  `json:"confidence"`
+	ReviewedBy    string   `json:"reviewedBy,omitempty"`
+	ReviewedAt    string   `json:"reviewedAt,omitempty"`
+	ReviewNote    string   `json:"reviewNote,omitempty"`
+	// 家长提交时所属的孩子，0 表示未指定
+	StudentID int64 `json:"studentId,omitempty"`
 }
 
 type GradingStore struct {
@@ -50,14 +79,23 @@ type GradingStore struct {
 }
 
 type User struct {
-	Username    string `json:"username"`
-	Password    string `json:"password"`
+	Username string `json:"username"`
+	// bcrypt 哈希（早期数据可能是明文），不随接口返回
+	Password    string `json:"-"`
 	Role        string `json:"role"`
 	Name        string `json:"name"`
 	Email       string `json:"email"`
 	StudentName string `json:"studentName,omitempty"`
 	Class       string `json:"class,omitempty"`
 	School      string `json:"school,omitempty"`
+	// 邮件通知偏好，新用户默认开启
+	EmailOnComplete bool `json:"emailOnComplete"`
+	EmailOnFailure  bool `json:"emailOnFailure"`
+	// 被管理员停用的账号不能登录
+	Disabled  bool   `json:"disabled"`
+	CreatedAt string `json:"createdAt,omitempty"`
+	// 改密后递增，用于作废之前签发的令牌
+	SessionVersion int `json:"-"`
 }
 
 type UserStore struct {
@@ -76,51 +114,73 @@ func (u *UserStore) key(username, role string) string {
 	return fmt.Sprintf("%s:%s", role, username)
 }
 
-func (u *UserStore) Get(username, role string) (User, bool) {
-	row := u.pool.QueryRow(context.Background(), `SELECT username, password, role, name, email, student_name, class, school FROM users WHERE username=$1 AND role=$2`, username, role)
+var (
+	errGradingNotFound = errors.New("grading not found")
+	errUserNotFound    = errors.New("user not found")
+	errUserExists      = errors.New("用户已存在")
+)
+
+func (u *UserStore) Get(ctx context.Context, username, role string) (User, error) {
+	row := u.pool.QueryRow(ctx, `SELECT username, password, role, name, email, student_name, class, school, email_on_complete, email_on_failure, disabled_at IS NOT NULL, created_at, session_version FROM users WHERE username=$1 AND role=$2`, username, role)
 	var usr User
-	if err := row.Scan(&usr.Username, &usr.Password, &usr.Role, &usr.Name, &usr.Email, &usr.StudentName, &usr.Class, &usr.School); err != nil {
-		return User{}, false
+	var created *time.Time
+	if err := row.Scan(&usr.Username, &usr.Password, &usr.Role, &usr.Name, &usr.Email, &usr.StudentName, &usr.Class, &usr.School, &usr.EmailOnComplete, &usr.EmailOnFailure, &usr.Disabled, &created, &usr.SessionVersion); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return User{}, errUserNotFound
+		}
+		return User{}, fmt.Errorf("get user %s/%s: %w", role, username, err)
 	}
-	return usr, true
+	usr.CreatedAt = formatTime(created)
+	return usr, nil
 }
 
-func (u *UserStore) Create(user User) error {
-	_, err := u.pool.Exec(context.Background(), `
+// Create 新建用户，user.Password 为明文，入库前哈希；用户已存在时返回 errUserExists
+func (u *UserStore) Create(ctx context.Context, user User) error {
+	hash, err := hashPassword(user.Password)
+	if err != nil {
+		return err
+	}
+	tag, err := u.pool.Exec(ctx, `
 INSERT INTO users (username, role, password, name, email, student_name, class, school)
 VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
 ON CONFLICT (username, role) DO NOTHING
-`, user.Username, user.Role, user.Password, user.Name, user.Email, user.StudentName, user.Class, user.School)
+`, user.Username, user.Role, hash, user.Name, user.Email, user.StudentName, user.Class, user.School)
 	if err != nil {
-		return err
+		return fmt.Errorf("create user %s/%s: %w", user.Role, user.Username, err)
 	}
-	// check if inserted
-	_, ok := u.Get(user.Username, user.Role)
-	if ok {
-		return nil
+	if tag.RowsAffected() == 0 {
+		return errUserExists
 	}
-	return fmt.Errorf("用户已存在")
+	return nil
 }
 
-func (u *UserStore) Update(user User) {
-	_, _ = u.pool.Exec(context.Background(), `
-INSERT INTO users (username, role, password, name, email, student_name, class, school)
-VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
+func (u *UserStore) Update(ctx context.Context, user User) error {
+	_, err := u.pool.Exec(ctx, `
+INSERT INTO users (username, role, password, name, email, student_name, class, school, email_on_complete, email_on_failure)
+VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)
 ON CONFLICT (username, role) DO UPDATE SET
  password=EXCLUDED.password,
  name=EXCLUDED.name,
  email=EXCLUDED.email,
  student_name=EXCLUDED.student_name,
  class=EXCLUDED.class,
- school=EXCLUDED.school;
-`, user.Username, user.Role, user.Password, user.Name, user.Email, user.StudentName, user.Class, user.School)
+ school=EXCLUDED.school,
+ email_on_complete=EXCLUDED.email_on_complete,
+ email_on_failure=EXCLUDED.email_on_failure;
+`, user.Username, user.Role, user.Password, user.Name, user.Email, user.StudentName, user.Class, user.School, user.EmailOnComplete, user.EmailOnFailure)
+	if err != nil {
+		return fmt.Errorf("update user %s/%s: %w", user.Role, user.Username, err)
+	}
+	return nil
 }
 
-func (s *GradingStore) add(req GradingRequest) {
-	_, _ = s.pool.Exec(context.Background(), `
+const gradingColumns = `id, subject, paper_image, answer_image, description, status, score, ai_score, total_score, submit_time, created_at, complete_time, feedback, ocr_result, owner_username, owner_role, confidence, reviewed_by, reviewed_at, review_note, student_id`
+
+func (s *GradingStore) add(ctx context.Context, req GradingRequest) error {
+	_, err := s.pool.Exec(ctx, `
 INSERT INTO gradings 
-  (id, subject, paper_image, answer_image, description, status, score, ai_score, total_score, submit_time, created_at, complete_time, feedback, ocr_result, owner_username, owner_role)
-VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16)
+  (`+gradingColumns+`)
+VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17,$18,$19,$20,$21)
 ON CONFLICT (id) DO UPDATE SET
   subject=excluded.subject,
   paper_image=excluded.paper_image,
@@ -136,63 +196,202 @@ ON CONFLICT (id) DO UPDATE SET
   feedback=excluded.feedback,
   ocr_result=excluded.ocr_result,
   owner_username=excluded.owner_username,
-  owner_role=excluded.owner_role;
-`, req.ID, req.Subject, req.PaperImage, req.AnswerImage, req.Description, req.Status, req.Score, req.AiScore, req.TotalScore, parseTime(req.SubmitTime), parseTime(req.CreatedAt), parseTime(req.CompleteTime), req.Feedback, req.OcrResult, req.OwnerUsername, req.OwnerRole)
+  owner_role=excluded.owner_role,
+  confidence=excluded.confidence,
+  reviewed_by=excluded.reviewed_by,
+  reviewed_at=excluded.reviewed_at,
+  review_note=excluded.review_note,
+  student_id=excluded.student_id;
+`, req.ID, req.Subject, req.PaperImage, req.AnswerImage, req.Description, req.Status, req.Score, req.AiScore, req.TotalScore, parseTime(req.SubmitTime), parseTime(req.CreatedAt), parseTime(req.CompleteTime), req.Feedback, req.OcrResult, req.OwnerUsername, req.OwnerRole, req.Confidence, req.ReviewedBy, parseTime(req.ReviewedAt), req.ReviewNote, nullID(req.StudentID))
+	if err != nil {
+		return fmt.Errorf("insert grading %s: %w", req.ID, err)
+	}
+	return nil
 }
 
-func (s *GradingStore) update(id string, fn func(*GradingRequest)) *GradingRequest {
-	item := s.get(id)
-	if item == nil {
-		return nil
+// update 读取记录、应用 fn 后写回；记录不存在时返回 errGradingNotFound
+func (s *GradingStore) update(ctx context.Context, id string, fn func(*GradingRequest)) (*GradingRequest, error) {
+	item, err := s.get(ctx, id)
+	if err != nil {
+		return nil, err
 	}
 	fn(item)
-	_, _ = s.pool.Exec(context.Background(), `
+	if err := saveGrading(ctx, s.pool, item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// execer 由 *pgxpool.Pool 与 pgx.Tx 实现，同一条写入语句可以在事务内外复用
+type execer interface {
+	Exec(ctx context.Context, sql string, arguments ...interface{}) (pgconn.CommandTag, error)
+}
+
+func saveGrading(ctx context.Context, db execer, item *GradingRequest) error {
+	_, err := db.Exec(ctx, `
 UPDATE gradings SET 
-  subject=$2, paper_image=$3, answer_image=$4, description=$5, status=$6, score=$7, ai_score=$8, total_score=$9, submit_time=$10, created_at=$11, complete_time=$12, feedback=$13, ocr_result=$14, owner_username=$15, owner_role=$16
+  subject=$2, paper_image=$3, answer_image=$4, description=$5, status=$6, score=$7, ai_score=$8, total_score=$9, submit_time=$10, created_at=$11, complete_time=$12, feedback=$13, ocr_result=$14, owner_username=$15, owner_role=$16, confidence=$17, reviewed_by=$18, reviewed_at=$19, review_note=$20, student_id=$21
 WHERE id=$1
-`, item.ID, item.Subject, item.PaperImage, item.AnswerImage, item.Description, item.Status, item.Score, item.AiScore, item.TotalScore, parseTime(item.SubmitTime), parseTime(item.CreatedAt), parseTime(item.CompleteTime), item.Feedback, item.OcrResult, item.OwnerUsername, item.OwnerRole)
-	return item
+`, item.ID, item.Subject, item.PaperImage, item.AnswerImage, item.Description, item.Status, item.Score, item.AiScore, item.TotalScore, parseTime(item.SubmitTime), parseTime(item.CreatedAt), parseTime(item.CompleteTime), item.Feedback, item.OcrResult, item.OwnerUsername, item.OwnerRole, item.Confidence, item.ReviewedBy, parseTime(item.ReviewedAt), item.ReviewNote, nullID(item.StudentID))
+	if err != nil {
+		return fmt.Errorf("update grading %s: %w", item.ID, err)
+	}
+	return nil
 }
 
-func (s *GradingStore) getAll() []GradingRequest {
-	rows, err := s.pool.Query(context.Background(), `SELECT id, subject, paper_image, answer_image, description, status, score, ai_score, total_score, submit_time, created_at, complete_time, feedback, ocr_result, owner_username, owner_role FROM gradings ORDER BY submit_time DESC`)
+// updateWithRevision 在同一事务中修改评分并写入 rev 生成的修订记录，两者要么都写入要么都不写入
+func (s *GradingStore) updateWithRevision(ctx context.Context, id string, fn func(*GradingRequest), rev func(*GradingRequest) GradingRevision) (*GradingRequest, error) {
+	tx, err := s.pool.Begin(ctx)
 	if err != nil {
-		return []GradingRequest{}
+		return nil, fmt.Errorf("update grading %s: %w", id, err)
+	}
+	defer tx.Rollback(ctx)
+	var item GradingRequest
+	if err := scanGrading(tx.QueryRow(ctx, `SELECT `+gradingColumns+` FROM gradings WHERE id=$1 FOR UPDATE`, id), &item); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errGradingNotFound
+		}
+		return nil, fmt.Errorf("update grading %s: %w", id, err)
+	}
+	fn(&item)
+	if err := saveGrading(ctx, tx, &item); err != nil {
+		return nil, err
+	}
+	if err := insertRevision(ctx, tx, rev(&item)); err != nil {
+		return nil, fmt.Errorf("update grading %s: record revision: %w", id, err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("update grading %s: %w", id, err)
+	}
+	return &item, nil
+}
+
+// visibleTo 列出账号可以查看的改卷：自己提交的、名下孩子的以及所带班级学生的，按提交时间倒序
+func (s *GradingStore) visibleTo(ctx context.Context, username, role string) ([]GradingRequest, error) {
+	return s.query(ctx, `SELECT `+gradingColumns+` FROM gradings
+WHERE (owner_username=$1 AND owner_role=$2)
+  OR student_id IN (SELECT id FROM students WHERE owner_username=$1 AND owner_role=$2)
+  OR student_id IN (
+    SELECT e.student_id FROM class_enrollments e JOIN classes c ON c.id = e.class_id
+    WHERE c.owner_username=$1 AND c.owner_role=$2)
+ORDER BY submit_time DESC`, username, role)
+}
+
+// byStudent 列出某个孩子的改卷，按提交时间倒序
+func (s *GradingStore) byStudent(ctx context.Context, studentID int64) ([]GradingRequest, error) {
+	return s.query(ctx, `SELECT `+gradingColumns+` FROM gradings WHERE student_id=$1 ORDER BY submit_time DESC`, studentID)
+}
+
+// byStatus 按状态筛选，按提交时间先后排序（先提交的先处理）
+func (s *GradingStore) byStatus(ctx context.Context, status string) ([]GradingRequest, error) {
+	return s.query(ctx, `SELECT `+gradingColumns+` FROM gradings WHERE status=$1 ORDER BY submit_time ASC`, status)
+}
+
+func (s *GradingStore) countByStatus(ctx context.Context, status string) (int, error) {
+	var n int
+	if err := s.pool.QueryRow(ctx, `SELECT count(*) FROM gradings WHERE status=$1`, status).Scan(&n); err != nil {
+		return 0, fmt.Errorf("count gradings: %w", err)
+	}
+	return n, nil
+}
+
+// transition 仅当当前状态为 from 时改为 to，用于排队与认领，避免多个实例重复处理同一份改卷
+func (s *GradingStore) transition(ctx context.Context, id, from, to, feedback string) (bool, error) {
+	tag, err := s.pool.Exec(ctx, `UPDATE gradings SET status=$3, feedback=$4 WHERE id=$1 AND status=$2`, id, from, to, feedback)
+	if err != nil {
+		return false, fmt.Errorf("transition grading %s: %w", id, err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (s *GradingStore) query(ctx context.Context, sql string, args ...interface{}) ([]GradingRequest, error) {
+	rows, err := s.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query gradings: %w", err)
 	}
 	defer rows.Close()
-	var res []GradingRequest
+	res := []GradingRequest{}
 	for rows.Next() {
 		var g GradingRequest
-		var submit, created, complete *time.Time
-		_ = rows.Scan(&g.ID, &g.Subject, &g.PaperImage, &g.AnswerImage, &g.Description, &g.Status, &g.Score, &g.AiScore, &g.TotalScore, &submit, &created, &complete, &g.Feedback, &g.OcrResult, &g.OwnerUsername, &g.OwnerRole)
-		g.SubmitTime = formatTime(submit)
-		g.CreatedAt = formatTime(created)
-		g.CompleteTime = formatTime(complete)
+		if err := scanGrading(rows, &g); err != nil {
+			return nil, fmt.Errorf("scan grading: %w", err)
+		}
 		res = append(res, g)
 	}
-	return res
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query gradings: %w", err)
+	}
+	return res, nil
 }
 
-func (s *GradingStore) get(id string) *GradingRequest {
-	row := s.pool.QueryRow(context.Background(), `SELECT id, subject, paper_image, answer_image, description, status, score, ai_score, total_score, submit_time, created_at, complete_time, feedback, ocr_result, owner_username, owner_role FROM gradings WHERE id=$1`, id)
+// get 读取单条记录；不存在时返回 errGradingNotFound
+func (s *GradingStore) get(ctx context.Context, id string) (*GradingRequest, error) {
+	row := s.pool.QueryRow(ctx, `SELECT `+gradingColumns+` FROM gradings WHERE id=$1`, id)
 	var g GradingRequest
-	var submit, created, complete *time.Time
-	if err := row.Scan(&g.ID, &g.Subject, &g.PaperImage, &g.AnswerImage, &g.Description, &g.Status, &g.Score, &g.AiScore, &g.TotalScore, &submit, &created, &complete, &g.Feedback, &g.OcrResult, &g.OwnerUsername, &g.OwnerRole); err != nil {
-		return nil
+	if err := scanGrading(row, &g); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, errGradingNotFound
+		}
+		return nil, fmt.Errorf("get grading %s: %w", id, err)
+	}
+	return &g, nil
+}
+
+func scanGrading(row pgx.Row, g *GradingRequest) error {
+	var submit, created, complete, reviewed *time.Time
+	var studentID *int64
+	if err := row.Scan(&g.ID, &g.Subject, &g.PaperImage, &g.AnswerImage, &g.Description, &g.Status, &g.Score, &g.AiScore, &g.TotalScore, &submit, &created, &complete, &g.Feedback, &g.OcrResult, &g.OwnerUsername, &g.OwnerRole, &g.Confidence, &g.ReviewedBy, &reviewed, &g.ReviewNote, &studentID); err != nil {
+		return err
+	}
+	if studentID != nil {
+		g.StudentID = *studentID
 	}
 	g.SubmitTime = formatTime(submit)
 	g.CreatedAt = formatTime(created)
 	g.CompleteTime = formatTime(complete)
-	return &g
+	g.ReviewedAt = formatTime(reviewed)
+	return nil
 }
 
-func SetupUnifiedRoutes(app *fiber.App, pool *pgxpool.Pool) {
+func SetupUnifiedRoutes(app *fiber.App, pool *pgxpool.Pool, cfg *config.Config) {
+	appConfig = cfg
 	pgPool = pool
 	gradingStore = NewGradingStore(pool)
 	userStore = NewUserStore(pool)
-	ensureDefaultUsers()
-	ensureDefaultUsers()
+	reviewStore = NewReviewStore(pool)
+	revisionStore = NewRevisionStore(pool)
+	webhookStore = NewWebhookStore(pool)
+	quotaStore = NewQuotaStore(pool)
+	usageStore = NewUsageStore(pool)
+	if prices, err := services.ParsePriceTable(cfg.DeepSeek.Prices); err != nil {
+		slog.Warn("LLM_PRICES ignored", "err", err)
+	} else {
+		llmPrices = prices
+	}
+	events.Default.Listen(dispatchWebhooks)
+	baiduTokens = services.NewBaiduTokenCache(cfg.Baidu.APIKey, cfg.Baidu.SecretKey)
+	ocrService = services.NewBaiduOCRService(baiduTokens)
+	scorer = services.NewDeepSeekService(cfg.DeepSeek.APIKey, cfg.DeepSeek.BaseURL)
+	baiduGate = newProviderGate(providerBaiduOCR, cfg.Baidu.Limits)
+	deepSeekGate = newProviderGate(providerDeepSeek, cfg.DeepSeek.Limits)
+	authService = newAuthService(cfg.Auth.JWTSecret, cfg.Auth.AccessTokenTTL)
+	sessionStore = NewSessionStore(pool)
+	rateLimits = NewRateLimitStore(pool)
+	studentStore = NewStudentStore(pool)
+	classStore = NewClassStore(pool)
+	authEvents = NewAuthEventStore(pool)
+	passwordResets = NewPasswordResetStore(pool)
+	mailer = services.NewMailer(cfg.SMTP.Host, cfg.SMTP.Port, cfg.SMTP.Username, cfg.SMTP.Password, cfg.SMTP.From)
+	events.Default.Listen(dispatchGradingEmail)
+	if cfg.Auth.SeedDemoUsers {
+		ensureDefaultUsers()
+	}
+	metrics.RegisterGaugeFunc("grading_active_workers", "本进程内正在运行的改卷流水线数", func() float64 {
+		return float64(gradingJobs.running())
+	})
 	// 中间件
+	app.Use(requestLogger)
+	app.Use(httpMetrics)
 	app.Use(cors.New(cors.Config{
 		// 允许本地调试来源避免开发时的跨域限制
 		AllowOrigins:     "*",
@@ -207,18 +406,36 @@ func SetupUnifiedRoutes(app *fiber.App, pool *pgxpool.Pool) {
 			"status":  "ok",
 			"message": "智能改卷系统运行正常",
 			"version": "1.0.0",
+			"providers": fiber.Map{
+				baiduGate.name:    baiduGate.breaker.Snapshot(),
+				deepSeekGate.name: deepSeekGate.breaker.Snapshot(),
+			},
 		})
 	})
 
+	app.Get("/health/live", healthLive)
+	app.Get("/health/ready", healthReady)
+	app.Get("/metrics", metricsHandler)
+
 	// API路由组
-	api := app.Group("/api")
+	api := app.Group("/api", withRequestTimeout)
 
-	// 用户认证相关路由
+	// 无需登录的认证接口；退出登录自行校验令牌，访问令牌过期时也能凭刷新令牌退出
 	auth := api.Group("/auth")
-	auth.Get("/me", getUserInfo)
 	auth.Post("/login", userLogin)
 	auth.Post("/register", userRegister)
 	auth.Post("/logout", userLogout)
+	auth.Post("/refresh", refreshSession)
+	auth.Post("/password/forgot", forgotPassword)
+	auth.Post("/password/reset", resetPassword)
+
+	// 此后注册的 /api 路由都要求登录；Fiber 按注册顺序匹配，上面的路由不经过该中间件
+	api.Use(requireAuth)
+	auth.Get("/me", getUserInfo)
+	auth.Get("/sessions", listSessions)
+	auth.Delete("/sessions", revokeOtherSessions)
+	auth.Delete("/sessions/:id", revokeSession)
+	auth.Post("/password", changePassword)
 
 	// 文件上传
 	api.Post("/upload", handleFileUpload)
@@ -226,40 +443,85 @@ func SetupUnifiedRoutes(app *fiber.App, pool *pgxpool.Pool) {
 	// 改卷流程
 	grading := api.Group("/grading")
 	grading.Get("/", listGradingRequests)
-	grading.Post("/", createGradingRequest)
+	grading.Post("/", limitSubmissions, createGradingRequest)
 	grading.Get("/:id", getGradingDetail)
-	grading.Post("/:id/process", processGradingRequest)
+	grading.Post("/:id/process", limitSubmissions, processGradingRequest)
+	grading.Post("/:id/cancel", cancelGrading)
+	grading.Put("/:id/score", updateGradingScore)
+	grading.Get("/:id/events", streamGradingEvents)
+
+	// 人工复核
+	review := api.Group("/review")
+	review.Get("/queue", listReviewQueue)
+	review.Get("/:id/audit", getReviewAudit)
+	review.Post("/:id/approve", approveReview)
+	review.Post("/:id/override", overrideReview)
+
+	// 外部服务调用额度
+	api.Get("/providers/usage", getProviderUsage)
+
+	// Webhook 通知
+	webhooks := api.Group("/webhooks")
+	webhooks.Get("/", listWebhooks)
+	webhooks.Post("/", createWebhook)
+	webhooks.Delete("/:id", deleteWebhook)
+	webhooks.Get("/:id/deliveries", listWebhookDeliveries)
+	webhooks.Post("/:id/test", testWebhook)
 
 	// 家长端路由
 	parent := api.Group("/parent")
 	parent.Get("/dashboard", getParentDashboard)
-	parent.Post("/submit", submitGradingRequest)
+	parent.Post("/submit", limitSubmissions, submitGradingRequest)
 	parent.Get("/results", getParentResults)
 	parent.Get("/result/:id", getParentResultDetail)
 	parent.Get("/history", getParentHistory)
+	parent.Get("/students", listStudents)
+	parent.Post("/students", createStudent)
+	parent.Put("/students/:id", updateStudent)
+	parent.Delete("/students/:id", deleteStudent)
+	parent.Post("/students/:id/join", joinClass)
 
 	// 教师端路由
-	teacher := api.Group("/teacher")
+	teacher := api.Group("/teacher", teacherOnly)
 	teacher.Get("/dashboard", getTeacherDashboard)
 	teacher.Post("/tasks", teacherHandler.CreateTeacherTask)
 	teacher.Get("/tasks", teacherHandler.GetTeacherTasks)
 	teacher.Get("/tasks/:id", teacherHandler.GetTeacherTask)
-	teacher.Post("/tasks/:id/execute", teacherHandler.ExecuteTeacherTask)
+	teacher.Post("/tasks/:id/execute", limitSubmissions, teacherHandler.ExecuteTeacherTask)
 	teacher.Post("/tasks/:id/cancel", teacherHandler.CancelTeacherTask)
+	teacher.Post("/tasks/:id/pause", teacherHandler.PauseTeacherTask)
+	teacher.Post("/tasks/:id/resume", teacherHandler.ResumeTeacherTask)
+	teacher.Post("/tasks/:id/skip", teacherHandler.SkipTaskPaper)
 	teacher.Get("/tasks/:id/status", teacherHandler.GetTaskStatus)
+	teacher.Get("/tasks/:id/events", teacherHandler.StreamTaskEvents)
+	teacher.Get("/tasks/:id/ws", teacherHandler.RequireTaskSocket, teacherHandler.TaskSocket())
 	teacher.Get("/tasks/:id/statistics", teacherHandler.GetTaskStatistics)
 	teacher.Get("/tasks/:id/analytics", teacherHandler.GetTaskAnalytics)
 	teacher.Delete("/tasks/:id", teacherHandler.DeleteTeacherTask)
 	teacher.Get("/history", getTeacherHistory)
 
+	// 班级与名单
+	classes := teacher.Group("/classes")
+	classes.Get("/", listClasses)
+	classes.Post("/", createClass)
+	classes.Put("/:id", updateClass)
+	classes.Delete("/:id", deleteClass)
+	classes.Get("/:id/students", getClassRoster)
+	classes.Post("/:id/students", addRosterStudents)
+	classes.Delete("/:id/students/:studentId", removeRosterStudent)
+	classes.Get("/:id/analytics", getClassAnalytics)
+
 	// 管理员路由
-	admin := api.Group("/admin")
+	admin := api.Group("/admin", requireAdmin)
 	admin.Get("/users", getAllUsers)
 	admin.Get("/tasks", getAllTasks)
 	admin.Get("/statistics", getSystemStatistics)
+	admin.Get("/usage", getUsageReport)
 
 	// 用户资料
 	auth.Put("/profile", updateProfile)
+	auth.Get("/notifications", getNotificationPrefs)
+	auth.Put("/notifications", updateNotificationPrefs)
 
 	// 学生信息
 	parent.Get("/student", getStudentInfo)
@@ -299,25 +561,48 @@ func userLogin(c *fiber.Ctx) error {
 		role = "parent"
 	}
 
-	user, ok := userStore.Get(req.Username, role)
-	if !ok || user.Password != req.Password {
+	// 账号锁定期间不校验密码也不计数，猜测不会延长锁定
+	if wait := loginLockedFor(c, req.Username, role); wait > 0 {
+		metrics.RateLimited.WithLabelValues("login").Inc()
+		return c.Status(429).JSON(fiber.Map{"error": fmt.Sprintf("登录失败次数过多，请 %d 分钟后再试", retryAfter(c, wait))})
+	}
+	user, err := userStore.Get(c.UserContext(), req.Username, role)
+	if err != nil && !errors.Is(err, errUserNotFound) {
+		return storeError(c, "get user", err)
+	}
+	if err != nil || !passwordMatches(user.Password, req.Password) {
+		if lock := loginFailed(c, req.Username, role); lock > 0 {
+			metrics.RateLimited.WithLabelValues("login").Inc()
+			return c.Status(429).JSON(fiber.Map{"error": fmt.Sprintf("登录失败次数过多，请 %d 分钟后再试", retryAfter(c, lock))})
+		}
 		return c.Status(401).JSON(fiber.Map{"error": "用户名或密码错误"})
 	}
+	loginSucceeded(c, user.Username, user.Role)
+	if user.Disabled {
+		return c.Status(403).JSON(fiber.Map{"error": "账号已停用，请联系管理员"})
+	}
+	if !isPasswordHash(user.Password) {
+		if err := userStore.upgradePassword(c.UserContext(), user, req.Password); err != nil {
+			logging.FromContext(c.UserContext()).Warn("failed to upgrade password hash", "role", user.Role, "username", user.Username, "err", err)
+		}
+	}
 
-	token := "mock_token_" + user.Username + "_" + user.Role
-	return c.JSON(fiber.Map{
-		"token": token,
-		"user": fiber.Map{
-			"userId":      1,
-			"username":    user.Name,
-			"role":        user.Role,
-			"userRole":    user.Role,
-			"studentName": user.StudentName,
-			"class":       user.Class,
-			"school":      user.School,
-			"email":       user.Email,
-		},
-	})
+	resp, err := startSession(c, user)
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("failed to start session", "err", err)
+		return c.Status(500).JSON(fiber.Map{"error": "登录失败，请稍后再试"})
+	}
+	resp["user"] = fiber.Map{
+		"userId":      1,
+		"username":    user.Name,
+		"role":        user.Role,
+		"userRole":    user.Role,
+		"studentName": user.StudentName,
+		"class":       user.Class,
+		"school":      user.School,
+		"email":       user.Email,
+	}
+	return c.JSON(resp)
 }
 
 func userRegister(c *fiber.Ctx) error {
@@ -328,6 +613,10 @@ func userRegister(c *fiber.Ctx) error {
 		Password        string `json:"password"`
 		ConfirmPassword string `json:"confirmPassword"`
 		UserRole        string `json:"userRole"`
+		// 家长注册时可以同时登记第一个孩子，之后在 /api/parent/students 中增删
+		StudentName string `json:"studentName"`
+		Class       string `json:"class"`
+		School      string `json:"school"`
 	}
 
 	var req RegisterRequest
@@ -342,11 +631,18 @@ func userRegister(c *fiber.Ctx) error {
 	if req.Password != req.ConfirmPassword {
 		return c.Status(400).JSON(fiber.Map{"error": "Passwords do not match"})
 	}
+	if err := validatePassword(req.Password); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
 
+	// 自助注册只能是家长或教师，管理员账号通过 admin 子命令创建
 	role := req.UserRole
 	if role == "" {
 		role = "parent"
 	}
+	if role != "parent" && role != "teacher" {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid user role"})
+	}
 
 	newUser := User{
 		Username:    req.OpenId,
@@ -354,14 +650,27 @@ func userRegister(c *fiber.Ctx) error {
 		Role:        role,
 		Name:        req.Name,
 		Email:       req.Email,
-		StudentName: req.Name + "的孩子",
+		StudentName: req.StudentName,
+		Class:       req.Class,
+		School:      req.School,
 	}
-	if err := userStore.Create(newUser); err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	if err := userStore.Create(c.UserContext(), newUser); err != nil {
+		return storeError(c, "create user", err)
+	}
+	if role == "parent" && strings.TrimSpace(req.StudentName) != "" {
+		st := Student{Name: strings.TrimSpace(req.StudentName), Class: req.Class, School: req.School, OwnerUsername: newUser.Username, OwnerRole: role}
+		if err := studentStore.create(c.UserContext(), &st); err != nil {
+			logging.FromContext(c.UserContext()).Error("store operation failed", "op", "create student", "err", err)
+		}
 	}
 
-	token := "mock_token_" + newUser.Username + "_" + newUser.Role
-	user := fiber.Map{
+	resp, err := startSession(c, newUser)
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("failed to start session", "err", err)
+		return c.Status(500).JSON(fiber.Map{"error": "注册成功，但登录失败，请重新登录"})
+	}
+	resp["message"] = "注册成功"
+	resp["user"] = fiber.Map{
 		"userId":      time.Now().Unix(),
 		"openId":      newUser.Username,
 		"username":    newUser.Name,
@@ -370,18 +679,7 @@ func userRegister(c *fiber.Ctx) error {
 		"userRole":    newUser.Role,
 		"studentName": newUser.StudentName,
 	}
-
-	return c.JSON(fiber.Map{
-		"message": "注册成功",
-		"token":   token,
-		"user":    user,
-	})
-}
-
-func userLogout(c *fiber.Ctx) error {
-	return c.JSON(fiber.Map{
-		"message": "退出登录成功",
-	})
+	return c.JSON(resp)
 }
 
 func handleFileUpload(c *fiber.Ctx) error {
@@ -395,7 +693,7 @@ func handleFileUpload(c *fiber.Ctx) error {
 		time.Now().Format("20060102150405"),
 		filepath.Ext(file.Filename),
 	)
-	saveDir := filepath.Join("uploads", "papers")
+	saveDir := filepath.Join(appConfig.Storage.UploadDir, "papers")
 	if err := os.MkdirAll(saveDir, 0755); err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "创建上传目录失败"})
 	}
@@ -415,7 +713,25 @@ func handleFileUpload(c *fiber.Ctx) error {
 // 家长端功能
 func getParentDashboard(c *fiber.Ctx) error {
 	user := currentUser(c)
-	results := gradingStore.getAll()
+	results, selected, err := parentGradings(c, user)
+	if err != nil {
+		return storeError(c, "list gradings", err)
+	}
+	students, err := studentStore.list(c.UserContext(), user.Username, user.Role)
+	if err != nil {
+		return storeError(c, "list students", err)
+	}
+	if selected == nil && len(students) > 0 {
+		selected = &students[0]
+	}
+	info := fiber.Map{
+		"name":   firstNonEmpty(user.StudentName, "李小明"),
+		"class":  firstNonEmpty(user.Class, "三年级一班"),
+		"school": firstNonEmpty(user.School, "示例小学"),
+	}
+	if selected != nil {
+		info = fiber.Map{"id": selected.ID, "name": selected.Name, "class": selected.Class, "school": selected.School}
+	}
 	recent := []fiber.Map{}
 	totalSubmissions := len(results)
 	completed := 0
@@ -433,6 +749,7 @@ func getParentDashboard(c *fiber.Ctx) error {
 				"totalScore": r.TotalScore,
 				"submitTime": r.SubmitTime,
 				"status":     r.Status,
+				"studentId":  r.StudentID,
 			})
 		}
 	}
@@ -443,11 +760,8 @@ func getParentDashboard(c *fiber.Ctx) error {
 	}
 
 	return c.JSON(fiber.Map{
-		"studentInfo": fiber.Map{
-			"name":   firstNonEmpty(user.StudentName, "李小明"),
-			"class":  firstNonEmpty(user.Class, "三年级一班"),
-			"school": firstNonEmpty(user.School, "示例小学"),
-		},
+		"studentInfo":   info,
+		"students":      students,
 		"recentResults": recent,
 		"statistics": fiber.Map{
 			"totalSubmissions": totalSubmissions,
@@ -463,6 +777,7 @@ func submitGradingRequest(c *fiber.Ctx) error {
 		Subject     string   `json:"subject"`
 		Images      []string `json:"images"`
 		Description string   `json:"description"`
+		StudentID   int64    `json:"studentId"`
 	}
 
 	var req SubmitRequest
@@ -470,11 +785,14 @@ func submitGradingRequest(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid request format"})
 	}
 
-	return createGradingInternal(c, req.Subject, req.Images, req.Description)
+	return createGradingInternal(c, req.Subject, req.Images, req.Description, req.StudentID)
 }
 
 func getParentResults(c *fiber.Ctx) error {
-	results := gradingStore.getAll()
+	results, _, err := parentGradings(c, currentUser(c))
+	if err != nil {
+		return storeError(c, "list gradings", err)
+	}
 	resp := []fiber.Map{}
 	for _, r := range results {
 		resp = append(resp, fiber.Map{
@@ -487,6 +805,7 @@ func getParentResults(c *fiber.Ctx) error {
 			"status":       r.Status,
 			"feedback":     r.Feedback,
 			"ocrResult":    r.OcrResult,
+			"studentId":    r.StudentID,
 		})
 	}
 
@@ -501,9 +820,18 @@ func getParentResults(c *fiber.Ctx) error {
 func getParentResultDetail(c *fiber.Ctx) error {
 	resultId := c.Params("id")
 
-	item := gradingStore.get(resultId)
-	if item == nil {
-		return c.Status(404).JSON(fiber.Map{"error": "Result not found"})
+	item, err := gradingStore.get(c.UserContext(), resultId)
+	if err != nil {
+		return storeError(c, "get grading", err)
+	}
+	if ok, err := canAccessGrading(c.UserContext(), currentUser(c), item); err != nil {
+		return storeError(c, "check grading access", err)
+	} else if !ok {
+		return c.Status(403).JSON(fiber.Map{"error": "无权查看该评分"})
+	}
+	revisions, err := revisionStore.list(c.UserContext(), resultId)
+	if err != nil {
+		return storeError(c, "list revisions", err)
 	}
 
 	return c.JSON(fiber.Map{
@@ -517,12 +845,17 @@ func getParentResultDetail(c *fiber.Ctx) error {
 		"feedback":     item.Feedback,
 		"ocrResult":    item.OcrResult,
 		"images":       item.Images,
+		"studentId":    item.StudentID,
 		"details":      []fiber.Map{},
+		"revisions":    revisions,
 	})
 }
 
 func getParentHistory(c *fiber.Ctx) error {
-	items := gradingStore.getAll()
+	items, _, err := parentGradings(c, currentUser(c))
+	if err != nil {
+		return storeError(c, "list gradings", err)
+	}
 	history := []fiber.Map{}
 	total := 0
 	scoreSum := 0
@@ -535,6 +868,7 @@ func getParentHistory(c *fiber.Ctx) error {
 			"status":    r.Status,
 			"feedback":  r.Feedback,
 			"ocrResult": r.OcrResult,
+			"studentId": r.StudentID,
 		})
 		if r.Status == "completed" {
 			scoreSum += r.Score
@@ -595,6 +929,15 @@ func getTeacherHistory(c *fiber.Ctx) error {
 }
 
 // 管理员功能
+
+// requireAdmin 限制 /api/admin 下的接口只对管理员开放
+func requireAdmin(c *fiber.Ctx) error {
+	if currentUser(c).Role != "admin" {
+		return c.Status(403).JSON(fiber.Map{"error": "仅管理员可以访问"})
+	}
+	return c.Next()
+}
+
 func getAllUsers(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{
 		"users": []fiber.Map{
@@ -673,8 +1016,15 @@ func DeleteTeacherTask(c *fiber.Ctx) error {
 }
 
 // 改卷统一处理
-func createGradingInternal(c *fiber.Ctx, subject string, images []string, desc string) error {
+func createGradingInternal(c *fiber.Ctx, subject string, images []string, desc string, studentID int64) error {
 	user := currentUser(c)
+	student, err := resolveStudent(c.UserContext(), user, studentID)
+	if errors.Is(err, errStudentNotFound) {
+		return c.Status(400).JSON(fiber.Map{"error": "孩子不存在"})
+	}
+	if err != nil {
+		return storeError(c, "get student", err)
+	}
 	if subject == "" {
 		subject = "未指定科目"
 	}
@@ -699,12 +1049,19 @@ func createGradingInternal(c *fiber.Ctx, subject string, images []string, desc s
 		OwnerUsername: user.Username,
 		OwnerRole:     user.Role,
 	}
-	gradingStore.add(item)
+	if student != nil {
+		item.StudentID = student.ID
+	}
+	if err := gradingStore.add(c.UserContext(), item); err != nil {
+		return storeError(c, "create grading", err)
+	}
+	publishGrading(id, events.StageUploaded, "", nil)
 
-	go runGradingPipeline(id)
+	startGradingPipeline(c.UserContext(), id)
 
 	return c.JSON(fiber.Map{
 		"id":            id,
+		"studentId":     item.StudentID,
 		"status":        item.Status,
 		"message":       "改卷请求已提交，正在处理",
 		"submitTime":    now,
@@ -713,7 +1070,11 @@ func createGradingInternal(c *fiber.Ctx, subject string, images []string, desc s
 }
 
 func listGradingRequests(c *fiber.Ctx) error {
-	items := gradingStore.getAll()
+	user := currentUser(c)
+	items, err := gradingStore.visibleTo(c.UserContext(), user.Username, user.Role)
+	if err != nil {
+		return storeError(c, "list gradings", err)
+	}
 	records := []fiber.Map{}
 	for _, it := range items {
 		records = append(records, fiber.Map{
@@ -741,6 +1102,10 @@ func createGradingRequest(c *fiber.Ctx) error {
 		Description string   `json:"description"`
 		PaperImage  string   `json:"paperImageUrl"`
 		AnswerImage string   `json:"answerImageUrl"`
+		StudentID   int64    `json:"studentId"`
+		// 教师可以不传 studentId，按班级与名单中的姓名或学号指定学生
+		ClassID     int64  `json:"classId"`
+		StudentName string `json:"studentName"`
 	}
 	var req Req
 	if err := c.BodyParser(&req); err != nil {
@@ -750,6 +1115,27 @@ func createGradingRequest(c *fiber.Ctx) error {
 		req.Images = append(req.Images, req.PaperImage)
 	}
 	user := currentUser(c)
+	var student *Student
+	var err error
+	if req.StudentID == 0 && strings.TrimSpace(req.StudentName) != "" && user.Role == "teacher" {
+		var st Student
+		st, err = classStore.rosterStudent(c.UserContext(), user.Username, user.Role, req.ClassID, strings.TrimSpace(req.StudentName))
+		student = &st
+	} else {
+		student, err = resolveStudent(c.UserContext(), user, req.StudentID)
+	}
+	if errors.Is(err, errStudentNotFound) {
+		if user.Role == "teacher" {
+			return c.Status(400).JSON(fiber.Map{"error": "班级名单中没有该学生"})
+		}
+		return c.Status(400).JSON(fiber.Map{"error": "孩子不存在"})
+	}
+	if errors.Is(err, errStudentAmbiguous) {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return storeError(c, "get student", err)
+	}
 	item := GradingRequest{
 		ID:            fmt.Sprintf("grading_%d", time.Now().UnixNano()),
 		Subject:       firstNonEmpty(req.Subject, "未指定科目"),
@@ -766,38 +1152,80 @@ func createGradingRequest(c *fiber.Ctx) error {
 		OwnerUsername: user.Username,
 		OwnerRole:     user.Role,
 	}
-	if user.Role == "parent" && user.StudentName != "" {
-		item.Description = firstNonEmpty(item.Description, user.StudentName)
+	if student != nil {
+		item.StudentID = student.ID
+		item.Description = firstNonEmpty(item.Description, student.Name)
+	}
+	if err := gradingStore.add(c.UserContext(), item); err != nil {
+		return storeError(c, "create grading", err)
 	}
-	gradingStore.add(item)
-	go runGradingPipeline(item.ID)
+	publishGrading(item.ID, events.StageUploaded, "", nil)
+	startGradingPipeline(c.UserContext(), item.ID)
 	return c.JSON(item)
 }
 
 func getGradingDetail(c *fiber.Ctx) error {
 	id := c.Params("id")
-	item := gradingStore.get(id)
-	if item == nil {
-		return c.Status(404).JSON(fiber.Map{"error": "Not found"})
+	item, err := gradingStore.get(c.UserContext(), id)
+	if err != nil {
+		return storeError(c, "get grading", err)
 	}
-	return c.JSON(item)
+	if ok, err := canAccessGrading(c.UserContext(), currentUser(c), item); err != nil {
+		return storeError(c, "check grading access", err)
+	} else if !ok {
+		return c.Status(403).JSON(fiber.Map{"error": "无权查看该评分"})
+	}
+	revisions, err := revisionStore.list(c.UserContext(), id)
+	if err != nil {
+		return storeError(c, "list revisions", err)
+	}
+	usage, err := usageStore.listByGrading(c.UserContext(), id)
+	if err != nil {
+		return storeError(c, "list usage", err)
+	}
+	return c.JSON(struct {
+		*GradingRequest
+		Revisions []GradingRevision `json:"revisions"`
+		Usage     []LLMUsage        `json:"usage"`
+	}{item, revisions, usage})
 }
 
 func processGradingRequest(c *fiber.Ctx) error {
 	id := c.Params("id")
-	updated := gradingStore.update(id, func(r *GradingRequest) {
+	item, err := gradingStore.get(c.UserContext(), id)
+	if err != nil {
+		return storeError(c, "get grading", err)
+	}
+	if ok, err := canEditGrading(c.UserContext(), currentUser(c), item); err != nil {
+		return storeError(c, "check grading access", err)
+	} else if !ok {
+		return c.Status(403).JSON(fiber.Map{"error": "无权重新处理该评分"})
+	}
+	updated, err := gradingStore.update(c.UserContext(), id, func(r *GradingRequest) {
 		r.Status = "processing"
 		r.AiScore = 0
 		r.CompleteTime = ""
 		r.Feedback = "已提交，等待真实评分处理"
 	})
-	if updated == nil {
-		return c.Status(404).JSON(fiber.Map{"error": "Not found"})
+	if err != nil {
+		return storeError(c, "reprocess grading", err)
 	}
-	go runGradingPipeline(id)
+	startGradingPipeline(c.UserContext(), id)
 	return c.JSON(updated)
 }
 
+// storeError 把存储层错误映射为 HTTP 响应：不存在 404、冲突 409，其余记录底层原因后返回 500
+func storeError(c *fiber.Ctx, op string, err error) error {
+	switch {
+	case errors.Is(err, errGradingNotFound), errors.Is(err, errUserNotFound), errors.Is(err, errStudentNotFound), errors.Is(err, errClassNotFound):
+		return c.Status(404).JSON(fiber.Map{"error": "Not found"})
+	case errors.Is(err, errUserExists), errors.Is(err, errClassExists), errors.Is(err, errNotInReview):
+		return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+	}
+	logging.FromContext(c.UserContext()).Error("store operation failed", "op", op, "method", c.Method(), "path", c.Path(), "err", err)
+	return c.Status(500).JSON(fiber.Map{"error": "数据库操作失败"})
+}
+
 func firstNonEmpty(values ...string) string {
 	for _, v := range values {
 		if v != "" {
@@ -807,25 +1235,77 @@ func firstNonEmpty(values ...string) string {
 	return ""
 }
 
-func runGradingPipeline(id string) {
-	req := gradingStore.get(id)
-	if req == nil {
+// startGradingPipeline 先同步登记任务再异步执行，保证返回后立即可以取消；
+// 流水线不随请求取消，但沿用请求的 logger，日志中带有发起请求的 request_id
+func startGradingPipeline(parent context.Context, id string) {
+	ctx, done, ok := gradingJobs.start(id)
+	if !ok {
+		// 服务正在停止，直接排队，重启后继续处理
+		rctx, cancel := detachedContext(parent)
+		defer cancel()
+		requeueGradings(rctx, []string{id})
+		return
+	}
+	ctx = logging.WithLogger(ctx, logging.FromContext(parent).With("grading_id", id))
+	go func() {
+		defer done()
+		runGradingPipeline(ctx, id)
+	}()
+}
+
+// stageFailure 区分熔断、超时与其他错误，便于用户理解失败原因
+func stageFailure(stage string, err error) string {
+	if errors.Is(err, services.ErrCircuitOpen) {
+		return stage + "失败: 服务暂不可用，请稍后重新提交"
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return stage + "超时"
+	}
+	// 网络错误会带上完整请求 URL，其中可能有百度 access_token
+	return stage + "失败: " + logging.Redact(err.Error())
+}
+
+func runGradingPipeline(ctx context.Context, id string) {
+	logger := logging.FromContext(ctx)
+	req, err := gradingStore.get(ctx, id)
+	if err != nil {
+		logger.Error("failed to load grading", "err", err)
 		return
 	}
 
 	// locate paper image path
 	imagePath := ""
 	if req.PaperImage != "" {
-		imagePath = filepath.Join("uploads", req.PaperImage)
+		imagePath = filepath.Join(appConfig.Storage.UploadDir, req.PaperImage)
 	} else if len(req.Images) > 0 {
-		imagePath = filepath.Join("uploads", req.Images[0])
+		imagePath = filepath.Join(appConfig.Storage.UploadDir, req.Images[0])
 	}
-	updateWithError := func(msg string) {
-		gradingStore.update(id, func(r *GradingRequest) {
-			r.Status = "failed"
+	stopWith := func(status, msg string) {
+		// 被取消时状态由取消接口写入，这里不再覆盖
+		if errors.Is(ctx.Err(), context.Canceled) {
+			logger.Info("pipeline stopped after cancel", "reason", msg)
+			return
+		}
+		wctx, cancel := detachedContext(ctx)
+		defer cancel()
+		if _, err := gradingStore.update(wctx, id, func(r *GradingRequest) {
+			r.Status = status
 			r.Feedback = msg
-		})
-		log.Printf("[grading:%s] failed: %s", id, msg)
+		}); err != nil {
+			logger.Error("failed to save grading status", "status", status, "err", err)
+		}
+		publishGrading(id, gradingStage(status), msg, nil)
+		metrics.GradingsFinished.WithLabelValues(status).Inc()
+		logger.Warn("pipeline stopped", "status", status, "reason", msg)
+	}
+	updateWithError := func(msg string) { stopWith("failed", msg) }
+	// 额度用完不算失败，单独标记，等额度恢复后可重新提交处理
+	stageError := func(stage string, err error) {
+		if errors.Is(err, errQuotaExceeded) {
+			stopWith("quota_exceeded", err.Error())
+			return
+		}
+		updateWithError(stageFailure(stage, err))
 	}
 
 	if imagePath == "" {
@@ -833,181 +1313,152 @@ func runGradingPipeline(id string) {
 		return
 	}
 
+	readStart := time.Now()
 	imgBytes, err := os.ReadFile(imagePath)
+	metrics.ObserveStage("read", readStart, err)
 	if err != nil {
 		updateWithError("读取试卷图片失败: " + err.Error())
 		return
 	}
 
-	imageBase64 := base64.StdEncoding.EncodeToString(imgBytes)
-
-	ocrText, err := callBaiduOCR(imageBase64)
+	publishGrading(id, events.StageOCRStarted, "", nil)
+	ocrCtx, cancelOCR := context.WithTimeout(ctx, ocrTimeout())
+	ocrStart := time.Now()
+	ocr, err := callBaiduOCR(ocrCtx, imgBytes)
+	metrics.ObserveStage("ocr", ocrStart, err)
+	cancelOCR()
 	if err != nil {
-		updateWithError("OCR 识别失败: " + err.Error())
+		stageError("OCR 识别", err)
 		return
 	}
-
-	score, feedback, err := callDeepSeekScore(ocrText, req.Subject)
+	ocrText, ocrConfidence := ocr.Text, ocr.Confidence
+	publishGrading(id, events.StageOCRDone, "", map[string]interface{}{"ocrConfidence": ocrConfidence})
+
+	publishGrading(id, events.StageGrading, "", nil)
+
+	// 已发生的调用即使随后被取消也要计费，因此用脱离取消的 context 记录
+	trackUsage := func(r services.ScoreResult) {
+		uctx, cancel := detachedContext(ctx)
+		defer cancel()
+		recordLLMUsage(uctx, LLMUsage{
+			Provider:      providerDeepSeek,
+			Model:         services.DeepSeekChatModel,
+			GradingID:     id,
+			OwnerUsername: req.OwnerUsername,
+			OwnerRole:     req.OwnerRole,
+		}, r.Usage)
+	}
+
+	scoreCtx, cancelScore := context.WithTimeout(ctx, scoreTimeout())
+	defer cancelScore()
+	llmStart := time.Now()
+	result, err := callDeepSeekScore(scoreCtx, ocrText, req.Subject)
+	metrics.ObserveStage("llm", llmStart, err)
 	if err != nil {
-		updateWithError("DeepSeek 评分失败: " + err.Error())
+		stageError("DeepSeek 评分", err)
 		return
 	}
+	trackUsage(result)
+
+	// 双次评分：两次结果分差过大说明模型自身也不确定
+	passConfidence := 1.0
+	if doublePassEnabled() {
+		llmStart = time.Now()
+		second, err := callDeepSeekScore(scoreCtx, ocrText, req.Subject)
+		metrics.ObserveStage("llm", llmStart, err)
+		if err != nil {
+			stageError("DeepSeek 评分", err)
+			return
+		}
+		trackUsage(second)
+		passConfidence = services.PassAgreement(result.Score, second.Score)
+	}
+
+	confidence := services.CombineConfidence(ocrConfidence, result.Confidence, passConfidence)
+	status := "completed"
+	if confidence < reviewThreshold() {
+		status = "needs_review"
+	}
 
-	gradingStore.update(id, func(r *GradingRequest) {
-		r.Status = "completed"
-		r.AiScore = score
-		r.Score = score
-		r.Feedback = feedback
+	if _, err := gradingStore.update(ctx, id, func(r *GradingRequest) {
+		r.Status = status
+		r.AiScore = result.Score
+		r.Score = result.Score
+		r.Feedback = result.Feedback
 		r.OcrResult = ocrText
+		r.Confidence = confidence
+		r.ReviewedBy = ""
+		r.ReviewedAt = ""
+		r.ReviewNote = ""
 		r.CompleteTime = time.Now().Format(time.RFC3339)
+	}); err != nil {
+		// 结果未能落库，不发布完成事件，避免通知与数据库状态不一致
+		logger.Error("failed to save result", "err", err)
+		return
+	}
+	if err := revisionStore.add(ctx, GradingRevision{
+		GradingID:     id,
+		Kind:          "ai",
+		Score:         result.Score,
+		AiScore:       result.Score,
+		Feedback:      result.Feedback,
+		Model:         services.DeepSeekChatModel,
+		PromptVersion: services.ScorePromptVersion,
+	}); err != nil {
+		logger.Error("failed to record revision", "err", err)
+	}
+	if status == "needs_review" {
+		if err := reviewStore.record(ctx, ReviewEntry{
+			GradingID:  id,
+			Action:     "flagged",
+			AiScore:    result.Score,
+			Confidence: confidence,
+			Note:       fmt.Sprintf("ocr=%.2f llm=%.2f passes=%.2f", ocrConfidence, result.Confidence, passConfidence),
+		}); err != nil {
+			logger.Error("failed to record review entry", "err", err)
+		}
+	}
+	publishGrading(id, gradingStage(status), "", map[string]interface{}{
+		"status":     status,
+		"score":      result.Score,
+		"confidence": confidence,
 	})
-	log.Printf("[grading:%s] completed. score=%d", id, score)
+	metrics.GradingsFinished.WithLabelValues(status).Inc()
+	logger.Info("pipeline finished", "status", status, "score", result.Score, "confidence", confidence)
 }
 
 // 用户工具
+// currentUser 返回 requireAuth 校验过的用户，只能在需要登录的路由中使用
 func currentUser(c *fiber.Ctx) User {
-	token := c.Get("Authorization")
-	if strings.HasPrefix(token, "Bearer ") {
-		token = strings.TrimPrefix(token, "Bearer ")
-	}
-	token = strings.TrimPrefix(token, "mock_token_")
-	parts := strings.Split(token, "_")
-	if len(parts) >= 2 {
-		username := strings.Join(parts[:len(parts)-1], "_")
-		role := parts[len(parts)-1]
-		if user, ok := userStore.Get(username, role); ok {
-			return user
-		}
-	}
-	// 默认家长
-	user, _ := userStore.Get("123123", "parent")
+	user, _ := c.Locals(localUser).(User)
 	return user
 }
 
-func callBaiduOCR(imageBase64 string) (string, error) {
-	apiKey := os.Getenv("BAIDU_API_KEY")
-	secretKey := os.Getenv("BAIDU_SECRET_KEY")
-	if apiKey == "" || secretKey == "" {
-		return "", fmt.Errorf("缺少 BAIDU_API_KEY/BAIDU_SECRET_KEY")
-	}
-
-	tokenURL := fmt.Sprintf("https://aip.baidubce.com/oauth/2.0/token?grant_type=client_credentials&client_id=%s&client_secret=%s", apiKey, secretKey)
-	resp, err := http.Post(tokenURL, "application/json", nil)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-	body, _ := io.ReadAll(resp.Body)
-	var tokenResp struct {
-		AccessToken string `json:"access_token"`
-	}
-	if err := json.Unmarshal(body, &tokenResp); err != nil || tokenResp.AccessToken == "" {
-		return "", fmt.Errorf("获取百度 token 失败: %s", string(body))
-	}
-
-	ocrURL := "https://aip.baidubce.com/rest/2.0/ocr/v1/accurate_basic?access_token=" + tokenResp.AccessToken
-	form := "image=" + urlEncode(imageBase64) + "&language_type=CHN_ENG"
-	ocrResp, err := http.Post(ocrURL, "application/x-www-form-urlencoded", strings.NewReader(form))
-	if err != nil {
-		return "", err
-	}
-	defer ocrResp.Body.Close()
-	ocrBody, _ := io.ReadAll(ocrResp.Body)
-
-	var ocrData struct {
-		WordsResult []struct {
-			Words string `json:"words"`
-		} `json:"words_result"`
-		ErrorMsg string `json:"error_msg"`
-	}
-	if err := json.Unmarshal(ocrBody, &ocrData); err != nil {
-		return "", fmt.Errorf("解析 OCR 响应失败: %s", err.Error())
-	}
-	if len(ocrData.WordsResult) == 0 {
-		if ocrData.ErrorMsg != "" {
-			return "", fmt.Errorf("%s", ocrData.ErrorMsg)
-		}
-		return "", fmt.Errorf("未识别到文本")
-	}
-
-	var lines []string
-	for _, w := range ocrData.WordsResult {
-		lines = append(lines, w.Words)
+// callBaiduOCR 返回识别文本以及各行识别置信度的平均值；服务波动或 token 失效时按重试策略重试
+func callBaiduOCR(ctx context.Context, imgBytes []byte) (services.OCRResult, error) {
+	if !ocrService.Configured() {
+		return services.OCRResult{}, fmt.Errorf("缺少 BAIDU_API_KEY/BAIDU_SECRET_KEY")
 	}
-	return strings.Join(lines, "\n"), nil
+	var result services.OCRResult
+	err := baiduGate.call(ctx, func(ctx context.Context) error {
+		var err error
+		result, err = ocrService.Recognize(ctx, imgBytes)
+		return err
+	})
+	return result, err
 }
 
-func callDeepSeekScore(text, subject string) (int, string, error) {
-	apiKey := os.Getenv("DEEPSEEK_API_KEY")
-	if apiKey == "" {
-		return 0, "", fmt.Errorf("缺少 DEEPSEEK_API_KEY")
-	}
-
-	prompt := fmt.Sprintf("你是一名阅卷老师，请根据学生答案给出0-100的分数并简要反馈。\n【科目】%s\n【学生答案】%s\n输出格式：分数（数字）+简短中文反馈。", subject, text)
-	payload := map[string]interface{}{
-		"model": "deepseek-chat",
-		"messages": []map[string]string{
-			{"role": "user", "content": prompt},
-		},
-		"temperature": 0.2,
-	}
-	bodyBytes, _ := json.Marshal(payload)
-	req, err := http.NewRequest("POST", "https://api.deepseek.com/chat/completions", bytes.NewReader(bodyBytes))
-	if err != nil {
-		return 0, "", err
-	}
-	req.Header.Set("Authorization", "Bearer "+apiKey)
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return 0, "", err
-	}
-	defer resp.Body.Close()
-	respBody, _ := io.ReadAll(resp.Body)
-
-	if resp.StatusCode >= 300 {
-		return 0, "", fmt.Errorf("DeepSeek API 返回错误: %s", string(respBody))
-	}
-
-	var dsResp struct {
-		Choices []struct {
-			Message struct {
-				Content string `json:"content"`
-			} `json:"message"`
-		} `json:"choices"`
-	}
-	if err := json.Unmarshal(respBody, &dsResp); err != nil {
-		return 0, "", fmt.Errorf("解析 DeepSeek 响应失败: %v", err)
-	}
-	if len(dsResp.Choices) == 0 {
-		return 0, "", fmt.Errorf("DeepSeek 无返回内容")
-	}
-	content := dsResp.Choices[0].Message.Content
-	score := extractFirstNumber(content)
-	feedback := content
-	return score, feedback, nil
-}
-
-func extractFirstNumber(s string) int {
-	num := 0
-	for i := 0; i < len(s); i++ {
-		if s[i] >= '0' && s[i] <= '9' {
-			num = num*10 + int(s[i]-'0')
-			// break after first contiguous number
-			j := i + 1
-			for j < len(s) && s[j] >= '0' && s[j] <= '9' {
-				num = num*10 + int(s[j]-'0')
-				j++
-			}
-			return num
-		}
+func callDeepSeekScore(ctx context.Context, text, subject string) (services.ScoreResult, error) {
+	if !scorer.Configured() {
+		return services.ScoreResult{}, fmt.Errorf("缺少 DEEPSEEK_API_KEY")
 	}
-	return 0
-}
-
-func urlEncode(s string) string {
-	return url.QueryEscape(s)
+	var result services.ScoreResult
+	err := deepSeekGate.call(ctx, func(ctx context.Context) error {
+		var err error
+		result, err = scorer.Score(ctx, subject, text, "")
+		return err
+	})
+	return result, err
 }
 
 func parseTime(t string) *time.Time {
@@ -1021,6 +1472,14 @@ func parseTime(t string) *time.Time {
 	return &tt
 }
 
+// nullID 把 0 写为 NULL，用于可选的外键列
+func nullID(id int64) *int64 {
+	if id == 0 {
+		return nil
+	}
+	return &id
+}
+
 func formatTime(t *time.Time) string {
 	if t == nil {
 		return ""
@@ -1028,8 +1487,9 @@ func formatTime(t *time.Time) string {
 	return t.Format(time.RFC3339)
 }
 
+// ensureDefaultUsers 创建演示用的家长与教师账号（密码 123123），仅在开启 SEED_DEMO_USERS 时调用
 func ensureDefaultUsers() {
-	_ = userStore.Create(User{
+	for _, user := range []User{{
 		Username:    "123123",
 		Password:    "123123",
 		Role:        "parent",
@@ -1038,15 +1498,27 @@ func ensureDefaultUsers() {
 		StudentName: "李小明",
 		Class:       "三年级一班",
 		School:      "示例小学",
-	})
-	_ = userStore.Create(User{
+	}, {
 		Username: "123123",
 		Password: "123123",
 		Role:     "teacher",
 		Name:     "张老师",
 		Email:    "teacher@example.com",
 		School:   "示例小学",
-	})
+	}} {
+		ctx, cancel := backgroundContext()
+		err := userStore.Create(ctx, user)
+		if err == nil && user.StudentName != "" {
+			err = studentStore.create(ctx, &Student{Name: user.StudentName, Class: user.Class, School: user.School, OwnerUsername: user.Username, OwnerRole: user.Role})
+		}
+		cancel()
+		switch {
+		case err == nil:
+			slog.Warn("seeded demo user", "role", user.Role, "username", user.Username)
+		case !errors.Is(err, errUserExists):
+			slog.Error("store operation failed", "op", "seed-user", "role", user.Role, "username", user.Username, "err", err)
+		}
+	}
 }
 
 // 资料与学生信息
@@ -1066,39 +1538,68 @@ func updateProfile(c *fiber.Ctx) error {
 	if req.Email != "" {
 		user.Email = req.Email
 	}
-	userStore.Update(user)
+	if err := userStore.Update(c.UserContext(), user); err != nil {
+		return storeError(c, "update profile", err)
+	}
 	return c.JSON(fiber.Map{"message": "资料已更新", "user": user})
 }
 
+// getStudentInfo 返回账号下的第一个孩子；多个孩子请使用 /api/parent/students
 func getStudentInfo(c *fiber.Ctx) error {
 	user := currentUser(c)
+	items, err := studentStore.list(c.UserContext(), user.Username, user.Role)
+	if err != nil {
+		return storeError(c, "list students", err)
+	}
+	if len(items) == 0 {
+		return c.JSON(fiber.Map{
+			"name":   user.StudentName,
+			"class":  user.Class,
+			"school": user.School,
+		})
+	}
 	return c.JSON(fiber.Map{
-		"name":   user.StudentName,
-		"class":  user.Class,
-		"school": user.School,
+		"id":     items[0].ID,
+		"name":   items[0].Name,
+		"class":  items[0].Class,
+		"school": items[0].School,
 	})
 }
 
+// updateStudentInfo 修改账号下的第一个孩子，还没有孩子时新建
 func updateStudentInfo(c *fiber.Ctx) error {
 	user := currentUser(c)
-	type Req struct {
-		Name   string `json:"name"`
-		Class  string `json:"class"`
-		School string `json:"school"`
-	}
-	var req Req
+	var req studentRequest
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
 	}
+	ctx := c.UserContext()
+	items, err := studentStore.list(ctx, user.Username, user.Role)
+	if err != nil {
+		return storeError(c, "list students", err)
+	}
+	if len(items) == 0 {
+		if req.Name == "" {
+			return c.Status(400).JSON(fiber.Map{"error": "请填写孩子姓名"})
+		}
+		st := Student{Name: req.Name, Class: req.Class, School: req.School, OwnerUsername: user.Username, OwnerRole: user.Role}
+		if err := studentStore.create(ctx, &st); err != nil {
+			return storeError(c, "create student", err)
+		}
+		return c.JSON(fiber.Map{"message": "学生信息已更新", "studentInfo": st})
+	}
+	st := items[0]
 	if req.Name != "" {
-		user.StudentName = req.Name
+		st.Name = req.Name
 	}
 	if req.Class != "" {
-		user.Class = req.Class
+		st.Class = req.Class
 	}
 	if req.School != "" {
-		user.School = req.School
+		st.School = req.School
+	}
+	if err := studentStore.update(ctx, st); err != nil {
+		return storeError(c, "update student info", err)
 	}
-	userStore.Update(user)
-	return c.JSON(fiber.Map{"message": "学生信息已更新", "studentInfo": req})
+	return c.JSON(fiber.Map{"message": "学生信息已更新", "studentInfo": st})
 }
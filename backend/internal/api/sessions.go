@@ -0,0 +1,425 @@
+package api
+
+import (
+	"auto-grad-backend/internal/logging"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"strings"
+	"time"
+)
+
+// 会话撤销原因，写入 sessions.revoke_reason 便于排查
+const (
+	revokeLogout        = "logout"
+	revokeByUser        = "revoked_by_user"
+	revokeRefreshReuse  = "refresh_token_reused"
+	revokeAccountClosed = "account_disabled"
+	revokePassword      = "password_changed"
+	revokePasswordReset = "password_reset"
+	revokeRoleChanged   = "role_changed"
+)
+
+// revokeAccountSessions 撤销账号（$1 用户名、$2 角色）的全部会话，$3 为撤销原因
+const revokeAccountSessions = `
+UPDATE sessions SET revoked_at=now(), revoke_reason=$3
+WHERE username=$1 AND role=$2 AND revoked_at IS NULL`
+
+var (
+	errSessionNotFound     = errors.New("session not found")
+	errRefreshTokenInvalid = errors.New("refresh token is invalid or expired")
+	errRefreshTokenReused  = errors.New("refresh token was already used")
+)
+
+// Session 是一次登录产生的会话，列表接口中展示给用户
+type Session struct {
+	ID         string `json:"id"`
+	UserAgent  string `json:"userAgent"`
+	IP         string `json:"ip"`
+	CreatedAt  string `json:"createdAt"`
+	LastUsedAt string `json:"lastUsedAt"`
+	ExpiresAt  string `json:"expiresAt"`
+	Current    bool   `json:"current"`
+}
+
+// SessionStore 保存登录会话与刷新令牌；刷新令牌只存 SHA-256 摘要
+type SessionStore struct {
+	pool *pgxpool.Pool
+}
+
+func NewSessionStore(pool *pgxpool.Pool) *SessionStore {
+	return &SessionStore{pool: pool}
+}
+
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// create 开始新会话，返回会话 id 与刷新令牌原文
+func (s *SessionStore) create(ctx context.Context, username, role, userAgent, ip string, ttl time.Duration) (string, string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	id := hex.EncodeToString(b)
+	token, err := randomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return "", "", fmt.Errorf("create session: %w", err)
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, `
+INSERT INTO sessions (id, username, role, user_agent, ip, expires_at) VALUES ($1,$2,$3,$4,$5,$6)`,
+		id, username, role, userAgent, ip, time.Now().Add(ttl)); err != nil {
+		return "", "", fmt.Errorf("create session: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `INSERT INTO refresh_tokens (token_hash, session_id) VALUES ($1,$2)`, hashToken(token), id); err != nil {
+		return "", "", fmt.Errorf("create session: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return "", "", fmt.Errorf("create session: %w", err)
+	}
+	return id, token, nil
+}
+
+// sessionRef 是刷新令牌对应的会话与账号
+type sessionRef struct {
+	ID       string
+	Username string
+	Role     string
+}
+
+// rotate 用刷新令牌换发新的刷新令牌并顺延会话有效期，旧令牌随即失效。
+// 已轮换过的令牌再次出现说明令牌可能被盗用，撤销整个会话并返回 errRefreshTokenReused
+func (s *SessionStore) rotate(ctx context.Context, token, userAgent, ip string, ttl time.Duration) (sessionRef, string, error) {
+	hash := hashToken(token)
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return sessionRef{}, "", fmt.Errorf("refresh session: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var ref sessionRef
+	var rotated, active bool
+	err = tx.QueryRow(ctx, `
+SELECT s.id, s.username, s.role, t.rotated_at IS NOT NULL, s.revoked_at IS NULL AND s.expires_at > now()
+FROM refresh_tokens t JOIN sessions s ON s.id = t.session_id
+WHERE t.token_hash=$1 FOR UPDATE`, hash).Scan(&ref.ID, &ref.Username, &ref.Role, &rotated, &active)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return sessionRef{}, "", errRefreshTokenInvalid
+	}
+	if err != nil {
+		return sessionRef{}, "", fmt.Errorf("refresh session: %w", err)
+	}
+	if rotated {
+		if active {
+			if _, err := tx.Exec(ctx, `UPDATE sessions SET revoked_at=now(), revoke_reason=$2 WHERE id=$1`, ref.ID, revokeRefreshReuse); err != nil {
+				return sessionRef{}, "", fmt.Errorf("refresh session: %w", err)
+			}
+			if err := tx.Commit(ctx); err != nil {
+				return sessionRef{}, "", fmt.Errorf("refresh session: %w", err)
+			}
+		}
+		return ref, "", errRefreshTokenReused
+	}
+	if !active {
+		return sessionRef{}, "", errRefreshTokenInvalid
+	}
+
+	next, err := randomToken(32)
+	if err != nil {
+		return sessionRef{}, "", err
+	}
+	if _, err := tx.Exec(ctx, `UPDATE refresh_tokens SET rotated_at=now() WHERE token_hash=$1`, hash); err != nil {
+		return sessionRef{}, "", fmt.Errorf("refresh session: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `INSERT INTO refresh_tokens (token_hash, session_id) VALUES ($1,$2)`, hashToken(next), ref.ID); err != nil {
+		return sessionRef{}, "", fmt.Errorf("refresh session: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `
+UPDATE sessions SET last_used_at=now(), expires_at=$2, user_agent=$3, ip=$4 WHERE id=$1`,
+		ref.ID, time.Now().Add(ttl), userAgent, ip); err != nil {
+		return sessionRef{}, "", fmt.Errorf("refresh session: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return sessionRef{}, "", fmt.Errorf("refresh session: %w", err)
+	}
+	return ref, next, nil
+}
+
+// active 判断会话是否属于该账号且未撤销、未过期
+func (s *SessionStore) active(ctx context.Context, id, username, role string) (bool, error) {
+	var ok bool
+	err := s.pool.QueryRow(ctx, `
+SELECT EXISTS (SELECT 1 FROM sessions
+WHERE id=$1 AND username=$2 AND role=$3 AND revoked_at IS NULL AND expires_at > now())`, id, username, role).Scan(&ok)
+	if err != nil {
+		return false, fmt.Errorf("check session: %w", err)
+	}
+	return ok, nil
+}
+
+// list 按最近使用时间列出账号的有效会话
+func (s *SessionStore) list(ctx context.Context, username, role string) ([]Session, error) {
+	rows, err := s.pool.Query(ctx, `
+SELECT id, user_agent, ip, created_at, last_used_at, expires_at FROM sessions
+WHERE username=$1 AND role=$2 AND revoked_at IS NULL AND expires_at > now()
+ORDER BY last_used_at DESC`, username, role)
+	if err != nil {
+		return nil, fmt.Errorf("list sessions: %w", err)
+	}
+	defer rows.Close()
+	items := []Session{}
+	for rows.Next() {
+		var item Session
+		var created, used, expires time.Time
+		if err := rows.Scan(&item.ID, &item.UserAgent, &item.IP, &created, &used, &expires); err != nil {
+			return nil, fmt.Errorf("list sessions: %w", err)
+		}
+		item.CreatedAt = formatTime(&created)
+		item.LastUsedAt = formatTime(&used)
+		item.ExpiresAt = formatTime(&expires)
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// revoke 撤销账号下的一个会话；会话不存在或已撤销时返回 errSessionNotFound
+func (s *SessionStore) revoke(ctx context.Context, username, role, id, reason string) error {
+	tag, err := s.pool.Exec(ctx, `
+UPDATE sessions SET revoked_at=now(), revoke_reason=$4
+WHERE id=$1 AND username=$2 AND role=$3 AND revoked_at IS NULL`, id, username, role, reason)
+	if err != nil {
+		return fmt.Errorf("revoke session: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return errSessionNotFound
+	}
+	return nil
+}
+
+// revokeOthers 撤销账号下除 keepID 以外的全部会话，返回撤销的数量
+func (s *SessionStore) revokeOthers(ctx context.Context, username, role, keepID, reason string) (int64, error) {
+	tag, err := s.pool.Exec(ctx, `
+UPDATE sessions SET revoked_at=now(), revoke_reason=$4
+WHERE username=$1 AND role=$2 AND id<>$3 AND revoked_at IS NULL`, username, role, keepID, reason)
+	if err != nil {
+		return 0, fmt.Errorf("revoke sessions: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// revokeByRefreshToken 撤销刷新令牌所属的会话，令牌无效时不做任何事
+func (s *SessionStore) revokeByRefreshToken(ctx context.Context, token, reason string) error {
+	_, err := s.pool.Exec(ctx, `
+UPDATE sessions SET revoked_at=now(), revoke_reason=$2
+WHERE revoked_at IS NULL AND id = (SELECT session_id FROM refresh_tokens WHERE token_hash=$1)`, hashToken(token), reason)
+	if err != nil {
+		return fmt.Errorf("revoke session: %w", err)
+	}
+	return nil
+}
+
+// startSession 为登录成功的用户开始新会话，返回访问令牌与刷新令牌
+func startSession(c *fiber.Ctx, user User) (fiber.Map, error) {
+	id, refresh, err := sessionStore.create(c.UserContext(), user.Username, user.Role, c.Get(fiber.HeaderUserAgent), c.IP(), appConfig.Auth.RefreshTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+	return tokenPair(user, id, refresh)
+}
+
+func tokenPair(user User, sessionID, refresh string) (fiber.Map, error) {
+	access, err := authService.GenerateUserToken(user.Username, user.Role, user.SessionVersion, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return fiber.Map{
+		"token":        access,
+		"refreshToken": refresh,
+		"expiresIn":    int(authService.AccessTTL().Seconds()),
+	}, nil
+}
+
+// Locals 中保存 requireAuth 校验结果的键
+const (
+	localUser      = "user"
+	localSessionID = "sessionID"
+)
+
+// bearerToken 读取 Authorization 头中的访问令牌。浏览器的 WebSocket 与 EventSource 无法设置请求头，
+// 这两类请求也接受 ?access_token= 查询参数
+func bearerToken(c *fiber.Ctx) string {
+	if token := strings.TrimPrefix(c.Get(fiber.HeaderAuthorization), "Bearer "); token != "" {
+		return token
+	}
+	if websocket.IsWebSocketUpgrade(c) || strings.Contains(c.Get(fiber.HeaderAccept), "text/event-stream") {
+		return c.Query("access_token")
+	}
+	return ""
+}
+
+// authenticatedSession 校验访问令牌并返回用户与会话 id；令牌无效或过期、会话已撤销、
+// 账号已停用、改密前签发的令牌都视为未登录
+func authenticatedSession(c *fiber.Ctx) (User, string, bool) {
+	token := bearerToken(c)
+	if token == "" {
+		return User{}, "", false
+	}
+	claims, err := authService.ValidateToken(token)
+	if err != nil || claims.SessionID == "" {
+		return User{}, "", false
+	}
+	ctx := c.UserContext()
+	user, err := userStore.Get(ctx, claims.OpenID, claims.Role)
+	if err != nil {
+		if !errors.Is(err, errUserNotFound) {
+			logging.FromContext(ctx).Error("store operation failed", "op", "current-user", "path", c.Path(), "err", err)
+		}
+		return User{}, "", false
+	}
+	if user.Disabled || user.SessionVersion != claims.Version {
+		return User{}, "", false
+	}
+	ok, err := sessionStore.active(ctx, claims.SessionID, user.Username, user.Role)
+	if err != nil {
+		logging.FromContext(ctx).Error("store operation failed", "op", "check-session", "path", c.Path(), "err", err)
+	}
+	if !ok {
+		return User{}, "", false
+	}
+	return user, claims.SessionID, true
+}
+
+// requireAuth 拒绝未登录的请求，校验通过的用户与会话存入 Locals，由 currentUser 与 currentSessionID 读取
+func requireAuth(c *fiber.Ctx) error {
+	user, sid, ok := authenticatedSession(c)
+	if !ok {
+		return c.Status(401).JSON(fiber.Map{"error": "请先登录"})
+	}
+	c.Locals(localUser, user)
+	c.Locals(localSessionID, sid)
+	return c.Next()
+}
+
+// currentSessionID 返回 requireAuth 校验过的会话 id
+func currentSessionID(c *fiber.Ctx) string {
+	sid, _ := c.Locals(localSessionID).(string)
+	return sid
+}
+
+// refreshSession 用刷新令牌换发访问令牌；刷新令牌同时轮换，客户端须保存新令牌
+func refreshSession(c *fiber.Ctx) error {
+	var req struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+	if err := c.BodyParser(&req); err != nil || req.RefreshToken == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request format"})
+	}
+	ctx := c.UserContext()
+	logger := logging.FromContext(ctx)
+	expired := fiber.Map{"error": "登录已过期，请重新登录"}
+
+	ref, refresh, err := sessionStore.rotate(ctx, req.RefreshToken, c.Get(fiber.HeaderUserAgent), c.IP(), appConfig.Auth.RefreshTokenTTL)
+	if errors.Is(err, errRefreshTokenReused) {
+		logger.Warn("refresh token reused, session revoked", "role", ref.Role, "username", ref.Username, "session", ref.ID, "ip", c.IP())
+		return c.Status(401).JSON(expired)
+	}
+	if errors.Is(err, errRefreshTokenInvalid) {
+		return c.Status(401).JSON(expired)
+	}
+	if err != nil {
+		return storeError(c, "refresh session", err)
+	}
+
+	user, err := userStore.Get(ctx, ref.Username, ref.Role)
+	if err != nil && !errors.Is(err, errUserNotFound) {
+		return storeError(c, "get user", err)
+	}
+	if err != nil || user.Disabled {
+		if err := sessionStore.revoke(ctx, ref.Username, ref.Role, ref.ID, revokeAccountClosed); err != nil && !errors.Is(err, errSessionNotFound) {
+			logger.Error("store operation failed", "op", "revoke-session", "err", err)
+		}
+		return c.Status(401).JSON(expired)
+	}
+	pair, err := tokenPair(user, ref.ID, refresh)
+	if err != nil {
+		logger.Error("failed to issue token", "err", err)
+		return c.Status(500).JSON(fiber.Map{"error": "刷新登录失败，请重新登录"})
+	}
+	return c.JSON(pair)
+}
+
+// userLogout 撤销当前会话；访问令牌已过期时可以只提交刷新令牌
+func userLogout(c *fiber.Ctx) error {
+	var req struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+	// 请求体可以为空
+	_ = c.BodyParser(&req)
+	ctx := c.UserContext()
+	if user, sid, ok := authenticatedSession(c); ok {
+		if err := sessionStore.revoke(ctx, user.Username, user.Role, sid, revokeLogout); err != nil && !errors.Is(err, errSessionNotFound) {
+			return storeError(c, "revoke session", err)
+		}
+	}
+	if req.RefreshToken != "" {
+		if err := sessionStore.revokeByRefreshToken(ctx, req.RefreshToken, revokeLogout); err != nil {
+			return storeError(c, "revoke session", err)
+		}
+	}
+	return c.JSON(fiber.Map{
+		"message": "退出登录成功",
+	})
+}
+
+// listSessions 列出当前账号的有效会话，标出发起请求的会话
+func listSessions(c *fiber.Ctx) error {
+	user, sid := currentUser(c), currentSessionID(c)
+	items, err := sessionStore.list(c.UserContext(), user.Username, user.Role)
+	if err != nil {
+		return storeError(c, "list sessions", err)
+	}
+	for i := range items {
+		items[i].Current = items[i].ID == sid
+	}
+	return c.JSON(fiber.Map{"sessions": items})
+}
+
+// revokeSession 撤销指定会话，该会话的访问令牌与刷新令牌立即失效
+func revokeSession(c *fiber.Ctx) error {
+	user := currentUser(c)
+	err := sessionStore.revoke(c.UserContext(), user.Username, user.Role, c.Params("id"), revokeByUser)
+	if errors.Is(err, errSessionNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "Not found"})
+	}
+	if err != nil {
+		return storeError(c, "revoke session", err)
+	}
+	return c.JSON(fiber.Map{"message": "会话已退出"})
+}
+
+// revokeOtherSessions 退出当前会话以外的所有登录
+func revokeOtherSessions(c *fiber.Ctx) error {
+	user, sid := currentUser(c), currentSessionID(c)
+	n, err := sessionStore.revokeOthers(c.UserContext(), user.Username, user.Role, sid, revokeByUser)
+	if err != nil {
+		return storeError(c, "revoke sessions", err)
+	}
+	return c.JSON(fiber.Map{"message": "其他设备已退出登录", "revoked": n})
+}
@@ -0,0 +1,98 @@
+package api
+
+import (
+	"auto-grad-backend/internal/services"
+	"github.com/gofiber/fiber/v2"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRequireAuthRejectsWithoutValidSession(t *testing.T) {
+	authService = services.NewAuthService("test-secret", time.Minute)
+	other := services.NewAuthService("other-secret", time.Minute)
+
+	// 旧版令牌没有会话 id，不能通过校验
+	legacy, err := authService.GenerateUserToken("123123", "parent", 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged, err := other.GenerateUserToken("123123", "parent", 0, "sid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := services.NewAuthService("test-secret", -time.Minute).GenerateUserToken("123123", "parent", 0, "sid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New()
+	app.Use(requireAuth)
+	app.Get("/private", func(c *fiber.Ctx) error { return c.SendString(currentUser(c).Username) })
+
+	tests := []struct {
+		name   string
+		header string
+		url    string
+	}{
+		{"no token", "", "/private"},
+		{"garbage", "Bearer not-a-jwt", "/private"},
+		{"without session", "Bearer " + legacy, "/private"},
+		{"wrong key", "Bearer " + forged, "/private"},
+		{"expired", "Bearer " + expired, "/private"},
+		// 查询参数只对 WebSocket 与 SSE 请求生效
+		{"query token on plain request", "", "/private?access_token=" + legacy},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.url, nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != 401 {
+				t.Fatalf("status = %d, want 401", resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	app := fiber.New()
+	app.Get("/", func(c *fiber.Ctx) error { return c.SendString(bearerToken(c)) })
+
+	tests := []struct {
+		name    string
+		url     string
+		headers map[string]string
+		want    string
+	}{
+		{"header", "/", map[string]string{"Authorization": "Bearer abc"}, "abc"},
+		{"header wins over query", "/?access_token=q", map[string]string{"Authorization": "Bearer abc", "Accept": "text/event-stream"}, "abc"},
+		{"event stream query", "/?access_token=q", map[string]string{"Accept": "text/event-stream"}, "q"},
+		{"plain query ignored", "/?access_token=q", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.url, nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(body); got != tt.want {
+				t.Fatalf("token = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,284 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errStudentNotFound = errors.New("student not found")
+
+// Student 是家长名下的一个孩子，改卷通过 student_id 归属到孩子；
+// 教师导入名单时建立的学生在家长认领前没有 owner
+type Student struct {
+	ID            int64  `json:"id"`
+	Name          string `json:"name"`
+	Class         string `json:"class"`
+	School        string `json:"school"`
+	StudentNumber string `json:"studentNumber,omitempty"`
+	CreatedAt     string `json:"createdAt,omitempty"`
+	// 已加入的班级，仅在列表接口中填充
+	Classes       []Class `json:"classes,omitempty"`
+	OwnerUsername string  `json:"-"`
+	OwnerRole     string  `json:"-"`
+}
+
+type StudentStore struct {
+	pool *pgxpool.Pool
+}
+
+func NewStudentStore(pool *pgxpool.Pool) *StudentStore {
+	return &StudentStore{pool: pool}
+}
+
+const studentColumns = `id, name, class, school, student_number, created_at, owner_username, owner_role`
+
+func scanStudent(row pgx.Row, st *Student) error {
+	var created time.Time
+	if err := row.Scan(&st.ID, &st.Name, &st.Class, &st.School, &st.StudentNumber, &created, &st.OwnerUsername, &st.OwnerRole); err != nil {
+		return err
+	}
+	st.CreatedAt = formatTime(&created)
+	return nil
+}
+
+// list 按添加顺序列出账号名下的孩子
+func (s *StudentStore) list(ctx context.Context, username, role string) ([]Student, error) {
+	return queryStudents(ctx, s.pool, `SELECT `+studentColumns+` FROM students WHERE owner_username=$1 AND owner_role=$2 ORDER BY id`, username, role)
+}
+
+func queryStudents(ctx context.Context, pool *pgxpool.Pool, sql string, args ...interface{}) ([]Student, error) {
+	rows, err := pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list students: %w", err)
+	}
+	defer rows.Close()
+	items := []Student{}
+	for rows.Next() {
+		var st Student
+		if err := scanStudent(rows, &st); err != nil {
+			return nil, fmt.Errorf("list students: %w", err)
+		}
+		items = append(items, st)
+	}
+	return items, rows.Err()
+}
+
+// get 读取账号名下的孩子；不存在或属于其他账号时返回 errStudentNotFound
+func (s *StudentStore) get(ctx context.Context, id int64, username, role string) (Student, error) {
+	var st Student
+	err := scanStudent(s.pool.QueryRow(ctx, `SELECT `+studentColumns+` FROM students WHERE id=$1 AND owner_username=$2 AND owner_role=$3`, id, username, role), &st)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Student{}, errStudentNotFound
+	}
+	if err != nil {
+		return Student{}, fmt.Errorf("get student %d: %w", id, err)
+	}
+	return st, nil
+}
+
+// byID 按 id 读取孩子，不校验归属，仅供系统内部（如发送通知）使用
+func (s *StudentStore) byID(ctx context.Context, id int64) (Student, error) {
+	var st Student
+	err := scanStudent(s.pool.QueryRow(ctx, `SELECT `+studentColumns+` FROM students WHERE id=$1`, id), &st)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Student{}, errStudentNotFound
+	}
+	if err != nil {
+		return Student{}, fmt.Errorf("get student %d: %w", id, err)
+	}
+	return st, nil
+}
+
+func (s *StudentStore) create(ctx context.Context, st *Student) error {
+	var created time.Time
+	err := s.pool.QueryRow(ctx, `
+INSERT INTO students (owner_username, owner_role, name, class, school, student_number) VALUES ($1,$2,$3,$4,$5,$6)
+RETURNING id, created_at`, st.OwnerUsername, st.OwnerRole, st.Name, st.Class, st.School, st.StudentNumber).Scan(&st.ID, &created)
+	if err != nil {
+		return fmt.Errorf("create student: %w", err)
+	}
+	st.CreatedAt = formatTime(&created)
+	return nil
+}
+
+func (s *StudentStore) update(ctx context.Context, st Student) error {
+	tag, err := s.pool.Exec(ctx, `
+UPDATE students SET name=$4, class=$5, school=$6 WHERE id=$1 AND owner_username=$2 AND owner_role=$3`,
+		st.ID, st.OwnerUsername, st.OwnerRole, st.Name, st.Class, st.School)
+	if err != nil {
+		return fmt.Errorf("update student %d: %w", st.ID, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return errStudentNotFound
+	}
+	return nil
+}
+
+// delete 删除孩子，已有的改卷保留并解除关联
+func (s *StudentStore) delete(ctx context.Context, id int64, username, role string) error {
+	tag, err := s.pool.Exec(ctx, `DELETE FROM students WHERE id=$1 AND owner_username=$2 AND owner_role=$3`, id, username, role)
+	if err != nil {
+		return fmt.Errorf("delete student %d: %w", id, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return errStudentNotFound
+	}
+	return nil
+}
+
+// resolveStudent 确定本次提交归属的孩子：指定 id 时校验属于当前账号，教师则校验在其班级名单中；
+// 未指定且账号下只有一个孩子时默认归到这个孩子，否则不归属
+func resolveStudent(ctx context.Context, user User, id int64) (*Student, error) {
+	if id != 0 && user.Role == "teacher" {
+		st, err := classStore.teacherStudent(ctx, id, user.Username, user.Role)
+		if err != nil {
+			return nil, err
+		}
+		return &st, nil
+	}
+	if id != 0 {
+		st, err := studentStore.get(ctx, id, user.Username, user.Role)
+		if err != nil {
+			return nil, err
+		}
+		return &st, nil
+	}
+	if user.Role != "parent" {
+		return nil, nil
+	}
+	items, err := studentStore.list(ctx, user.Username, user.Role)
+	if err != nil || len(items) != 1 {
+		return nil, err
+	}
+	return &items[0], nil
+}
+
+// studentFilter 读取 ?studentId= 查询参数；未提供时返回 nil，表示不按孩子筛选
+func studentFilter(c *fiber.Ctx, user User) (*Student, error) {
+	raw := c.Query("studentId")
+	if raw == "" {
+		return nil, nil
+	}
+	id, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || id <= 0 {
+		return nil, errStudentNotFound
+	}
+	st, err := studentStore.get(c.UserContext(), id, user.Username, user.Role)
+	if err != nil {
+		return nil, err
+	}
+	return &st, nil
+}
+
+// parentGradings 返回家长端列表使用的改卷记录：默认为自己提交的与名下孩子的，带 ?studentId= 时只返回该孩子的
+func parentGradings(c *fiber.Ctx, user User) ([]GradingRequest, *Student, error) {
+	st, err := studentFilter(c, user)
+	if err != nil {
+		return nil, nil, err
+	}
+	if st != nil {
+		items, err := gradingStore.byStudent(c.UserContext(), st.ID)
+		return items, st, err
+	}
+	items, err := gradingStore.visibleTo(c.UserContext(), user.Username, user.Role)
+	return items, nil, err
+}
+
+// idParam 读取正整数路径参数
+func idParam(c *fiber.Ctx, name string) (int64, bool) {
+	id, err := strconv.ParseInt(c.Params(name), 10, 64)
+	return id, err == nil && id > 0
+}
+
+type studentRequest struct {
+	Name   string `json:"name"`
+	Class  string `json:"class"`
+	School string `json:"school"`
+}
+
+func listStudents(c *fiber.Ctx) error {
+	user := currentUser(c)
+	items, err := studentStore.list(c.UserContext(), user.Username, user.Role)
+	if err != nil {
+		return storeError(c, "list students", err)
+	}
+	classes, err := classStore.forOwner(c.UserContext(), user.Username, user.Role)
+	if err != nil {
+		return storeError(c, "list student classes", err)
+	}
+	for i := range items {
+		items[i].Classes = classes[items[i].ID]
+	}
+	return c.JSON(fiber.Map{"students": items})
+}
+
+func createStudent(c *fiber.Ctx) error {
+	user := currentUser(c)
+	var req studentRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	st := Student{
+		Name:          strings.TrimSpace(req.Name),
+		Class:         strings.TrimSpace(req.Class),
+		School:        strings.TrimSpace(req.School),
+		OwnerUsername: user.Username,
+		OwnerRole:     user.Role,
+	}
+	if st.Name == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "请填写孩子姓名"})
+	}
+	if err := studentStore.create(c.UserContext(), &st); err != nil {
+		return storeError(c, "create student", err)
+	}
+	return c.Status(201).JSON(st)
+}
+
+// updateStudent 只修改请求中给出的字段
+func updateStudent(c *fiber.Ctx) error {
+	user := currentUser(c)
+	id, ok := idParam(c, "id")
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{"error": "Not found"})
+	}
+	var req studentRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	st, err := studentStore.get(c.UserContext(), id, user.Username, user.Role)
+	if err != nil {
+		return storeError(c, "get student", err)
+	}
+	if name := strings.TrimSpace(req.Name); name != "" {
+		st.Name = name
+	}
+	if req.Class != "" {
+		st.Class = strings.TrimSpace(req.Class)
+	}
+	if req.School != "" {
+		st.School = strings.TrimSpace(req.School)
+	}
+	if err := studentStore.update(c.UserContext(), st); err != nil {
+		return storeError(c, "update student", err)
+	}
+	return c.JSON(st)
+}
+
+func deleteStudent(c *fiber.Ctx) error {
+	user := currentUser(c)
+	id, ok := idParam(c, "id")
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{"error": "Not found"})
+	}
+	if err := studentStore.delete(c.UserContext(), id, user.Username, user.Role); err != nil {
+		return storeError(c, "delete student", err)
+	}
+	return c.JSON(fiber.Map{"message": "已删除，历史改卷记录保留"})
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"auto-grad-backend/internal/events"
+	"github.com/gofiber/contrib/websocket"
+	"github.com/gofiber/fiber/v2"
+	"time"
+)
+
+// 教师任务监控的 WebSocket 通道：服务端推送进度事件，客户端发送控制命令
+//
+//	客户端 -> 服务端: {"action": "pause" | "resume" | "cancel" | "skip-paper", "requestId": "可选"}
+//	服务端 -> 客户端: 与 SSE 相同的进度事件，以及 {"type": "ack" | "error", "action": ..., "requestId": ...}
+
+// 心跳间隔与读超时：超过 socketReadTimeout 未收到任何消息（含 pong）即视为断开
+const (
+	socketPingInterval = 20 * time.Second
+	socketReadTimeout  = 60 * time.Second
+)
+
+type taskCommand struct {
+	Action    string `json:"action"`
+	RequestID string `json:"requestId,omitempty"`
+}
+
+type taskCommandReply struct {
+	Type      string `json:"type"`
+	Action    string `json:"action"`
+	RequestID string `json:"requestId,omitempty"`
+	Status    string `json:"status,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// RequireTaskSocket 拒绝非 WebSocket 请求及不存在或不属于当前教师的任务，放在 TaskSocket 之前；
+// 校验过的用户经 Locals 传给连接
+func (h *TeacherTaskHandler) RequireTaskSocket(c *fiber.Ctx) error {
+	if !websocket.IsWebSocketUpgrade(c) {
+		return fiber.ErrUpgradeRequired
+	}
+	h.mu.Lock()
+	task := h.ownedTask(c.Params("id"), currentUser(c))
+	h.mu.Unlock()
+	if task == nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Task not found"})
+	}
+	return c.Next()
+}
+
+func (h *TeacherTaskHandler) TaskSocket() fiber.Handler {
+	return websocket.New(h.serveTaskSocket)
+}
+
+func (h *TeacherTaskHandler) serveTaskSocket(conn *websocket.Conn) {
+	taskID := conn.Params("id")
+	user, _ := conn.Locals(localUser).(User)
+	ch, cancel := events.Default.Subscribe(events.TaskTopic(taskID))
+	defer cancel()
+
+	h.mu.Lock()
+	task := h.ownedTask(taskID, user)
+	var snapshot events.Event
+	if task != nil {
+		snapshot = taskSnapshot(task)
+	}
+	h.mu.Unlock()
+	if task == nil {
+		return
+	}
+
+	// 读协程只负责解析命令，所有写操作都在当前协程完成
+	replies := make(chan taskCommandReply, 8)
+	done := make(chan struct{})
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(socketReadTimeout))
+	})
+	go func() {
+		defer close(done)
+		for {
+			_ = conn.SetReadDeadline(time.Now().Add(socketReadTimeout))
+			var cmd taskCommand
+			if err := conn.ReadJSON(&cmd); err != nil {
+				return
+			}
+			reply := taskCommandReply{Type: "ack", Action: cmd.Action, RequestID: cmd.RequestID}
+			if err := h.control(user, taskID, cmd.Action); err != nil {
+				reply.Type = "error"
+				reply.Error = err.Error()
+			}
+			h.mu.Lock()
+			reply.Status = statusOrPending(h.ownedTask(taskID, user))
+			h.mu.Unlock()
+			select {
+			case replies <- reply:
+			case <-time.After(socketReadTimeout):
+				return
+			}
+		}
+	}()
+
+	if err := conn.WriteJSON(snapshot); err != nil {
+		return
+	}
+	ping := time.NewTicker(socketPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case e, ok := <-ch:
+			if !ok {
+				return
+			}
+			if err := conn.WriteJSON(e); err != nil {
+				return
+			}
+		case reply := <-replies:
+			if err := conn.WriteJSON(reply); err != nil {
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(5*time.Second)); err != nil {
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
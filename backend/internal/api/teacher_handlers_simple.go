@@ -1,6 +1,9 @@
 package api
 
 import (
+	"auto-grad-backend/internal/services"
+	"context"
+	"errors"
 	"fmt"
 	"github.com/gofiber/fiber/v2"
 	"sync"
@@ -17,13 +20,41 @@ type TeacherTask struct {
 	CompletedPapers int     `json:"completedPapers"`
 	FailedPapers    int     `json:"failedPapers"`
 	AverageScore    float64 `json:"averageScore"`
-	CreatedAt       string  `json:"createdAt"`
-	UpdatedAt       string  `json:"updatedAt"`
+	PaperLimit      int     `json:"paperLimit"`
+	// 任务批改的班级，试卷中的学生姓名按该班名单匹配
+	ClassID          int64  `json:"classId,omitempty"`
+	NotifyOnComplete bool   `json:"notifyOnComplete"`
+	NotifyOnFailure  bool   `json:"notifyOnFailure"`
+	OwnerUsername    string `json:"ownerUsername,omitempty"`
+	OwnerRole        string `json:"ownerRole,omitempty"`
+	CreatedAt        string `json:"createdAt"`
+	UpdatedAt        string `json:"updatedAt"`
 }
 
+// 未指定试卷数量时每个任务处理的试卷数
+const defaultPaperLimit = 10
+
 type TeacherTaskHandler struct {
-	mu    sync.Mutex
-	tasks []TeacherTask
+	mu         sync.Mutex
+	tasks      []TeacherTask
+	automation *services.AutomationService
+}
+
+func NewTeacherTaskHandler() *TeacherTaskHandler {
+	h := &TeacherTaskHandler{automation: services.NewAutomationService()}
+	h.automation.SetUsageRecorder(h.recordUsage)
+	return h
+}
+
+// recordUsage 把任务批改试卷的大模型用量记到任务及其创建者名下
+func (h *TeacherTaskHandler) recordUsage(taskID string, result services.PaperResult) {
+	u := LLMUsage{Provider: result.Provider, Model: result.Model, TaskID: taskID}
+	h.mu.Lock()
+	if task := h.findTask(taskID); task != nil {
+		u.OwnerUsername, u.OwnerRole = task.OwnerUsername, task.OwnerRole
+	}
+	h.mu.Unlock()
+	recordLLMUsage(context.Background(), u, result.Usage)
 }
 
 func (h *TeacherTaskHandler) CreateTeacherTask(c *fiber.Ctx) error {
@@ -32,6 +63,10 @@ func (h *TeacherTaskHandler) CreateTeacherTask(c *fiber.Ctx) error {
 		Account    string `json:"account"`
 		Password   string `json:"password"`
 		PaperLimit int    `json:"paperLimit"`
+		ClassID    int64  `json:"classId"`
+		// 未传时默认开启通知
+		NotifyOnComplete *bool `json:"notifyOnComplete"`
+		NotifyOnFailure  *bool `json:"notifyOnFailure"`
 	}
 
 	var req CreateTaskRequest
@@ -40,19 +75,33 @@ func (h *TeacherTaskHandler) CreateTeacherTask(c *fiber.Ctx) error {
 		return c.JSON(fiber.Map{"error": "Invalid request format"})
 	}
 
+	user := currentUser(c)
+	if req.ClassID != 0 {
+		if _, err := classStore.get(c.UserContext(), req.ClassID, user.Username, user.Role); errors.Is(err, errClassNotFound) {
+			return c.Status(400).JSON(fiber.Map{"error": "班级不存在"})
+		} else if err != nil {
+			return storeError(c, "get class", err)
+		}
+	}
 	now := time.Now().Format("2006-01-02 15:04:05")
 	task := TeacherTask{
-		ID:              fmt.Sprintf("task_%d", time.Now().UnixNano()),
-		TargetURL:       req.TargetURL,
-		Account:         req.Account,
-		Password:        req.Password,
-		Status:          "pending",
-		TotalPapers:     0,
-		CompletedPapers: 0,
-		FailedPapers:    0,
-		AverageScore:    0,
-		CreatedAt:       now,
-		UpdatedAt:       now,
+		ID:               fmt.Sprintf("task_%d", time.Now().UnixNano()),
+		TargetURL:        req.TargetURL,
+		Account:          req.Account,
+		Password:         req.Password,
+		Status:           "pending",
+		TotalPapers:      0,
+		CompletedPapers:  0,
+		FailedPapers:     0,
+		AverageScore:     0,
+		PaperLimit:       req.PaperLimit,
+		ClassID:          req.ClassID,
+		NotifyOnComplete: req.NotifyOnComplete == nil || *req.NotifyOnComplete,
+		NotifyOnFailure:  req.NotifyOnFailure == nil || *req.NotifyOnFailure,
+		OwnerUsername:    user.Username,
+		OwnerRole:        user.Role,
+		CreatedAt:        now,
+		UpdatedAt:        now,
 	}
 
 	h.mu.Lock()
@@ -67,12 +116,21 @@ func (h *TeacherTaskHandler) CreateTeacherTask(c *fiber.Ctx) error {
 }
 
 func (h *TeacherTaskHandler) GetTeacherTasks(c *fiber.Ctx) error {
+	user := currentUser(c)
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
+	tasks := []TeacherTask{}
+	for i := range h.tasks {
+		if ownsTask(&h.tasks[i], user) {
+			h.refresh(&h.tasks[i])
+			tasks = append(tasks, h.tasks[i])
+		}
+	}
+
 	return c.JSON(fiber.Map{
-		"tasks": h.tasks,
-		"total": len(h.tasks),
+		"tasks": tasks,
+		"total": len(tasks),
 		"page":  1,
 		"limit": 10,
 	})
@@ -84,7 +142,7 @@ func (h *TeacherTaskHandler) GetTeacherTask(c *fiber.Ctx) error {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
-	task := h.findTask(taskID)
+	task := h.ownedTask(taskID, currentUser(c))
 	if task == nil {
 		return c.Status(404).JSON(fiber.Map{"error": "Task not found"})
 	}
@@ -110,10 +168,34 @@ func (h *TeacherTaskHandler) ExecuteTeacherTask(c *fiber.Ctx) error {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
-	if task := h.findTask(taskID); task != nil {
-		task.Status = "running"
-		task.UpdatedAt = time.Now().Format("2006-01-02 15:04:05")
+	task := h.ownedTask(taskID, currentUser(c))
+	if task == nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Task not found"})
+	}
+	// 暂停的任务仍占用原工作协程，只能恢复或取消
+	if task.Status == "running" || task.Status == "paused" {
+		return c.Status(409).JSON(fiber.Map{"error": "Task is already " + task.Status})
+	}
+	limit := task.PaperLimit
+	if limit <= 0 && task.ClassID != 0 {
+		// 绑定班级的任务默认每个学生一份试卷
+		cl, err := classStore.get(c.UserContext(), task.ClassID, task.OwnerUsername, task.OwnerRole)
+		if err != nil && !errors.Is(err, errClassNotFound) {
+			return storeError(c, "get class", err)
+		}
+		limit = cl.StudentCount
+	}
+	if limit <= 0 {
+		limit = defaultPaperLimit
 	}
+	if err := h.automation.StartTask(task.ID, limit, task.TargetURL, task.Account, task.Password); errors.Is(err, services.ErrTaskRunning) {
+		return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+	} else if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	task.Status = "running"
+	task.TotalPapers = limit
+	task.UpdatedAt = time.Now().Format("2006-01-02 15:04:05")
 
 	return c.JSON(fiber.Map{
 		"message": "Task execution started",
@@ -124,13 +206,8 @@ func (h *TeacherTaskHandler) ExecuteTeacherTask(c *fiber.Ctx) error {
 
 func (h *TeacherTaskHandler) CancelTeacherTask(c *fiber.Ctx) error {
 	taskID := c.Params("id")
-
-	h.mu.Lock()
-	defer h.mu.Unlock()
-
-	if task := h.findTask(taskID); task != nil {
-		task.Status = "cancelled"
-		task.UpdatedAt = time.Now().Format("2006-01-02 15:04:05")
+	if err := h.control(currentUser(c), taskID, "cancel"); err != nil {
+		return c.Status(controlErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
 	}
 
 	return c.JSON(fiber.Map{
@@ -140,13 +217,93 @@ func (h *TeacherTaskHandler) CancelTeacherTask(c *fiber.Ctx) error {
 	})
 }
 
+func (h *TeacherTaskHandler) PauseTeacherTask(c *fiber.Ctx) error {
+	return h.controlResponse(c, "pause")
+}
+
+func (h *TeacherTaskHandler) ResumeTeacherTask(c *fiber.Ctx) error {
+	return h.controlResponse(c, "resume")
+}
+
+func (h *TeacherTaskHandler) SkipTaskPaper(c *fiber.Ctx) error {
+	return h.controlResponse(c, "skip-paper")
+}
+
+func (h *TeacherTaskHandler) controlResponse(c *fiber.Ctx, action string) error {
+	taskID := c.Params("id")
+	user := currentUser(c)
+	if err := h.control(user, taskID, action); err != nil {
+		return c.Status(controlErrorStatus(err)).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return c.JSON(fiber.Map{
+		"message": "Task " + action + " accepted",
+		"taskId":  taskID,
+		"status":  statusOrPending(h.ownedTask(taskID, user)),
+	})
+}
+
+// control 执行任务控制命令（pause/resume/cancel/skip-paper），HTTP 与 WebSocket 共用；
+// 不属于 user 的任务按不存在处理
+func (h *TeacherTaskHandler) control(user User, taskID, action string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	task := h.ownedTask(taskID, user)
+	if task == nil {
+		return services.ErrTaskNotFound
+	}
+
+	var err error
+	switch action {
+	case "pause":
+		err = h.automation.PauseTask(taskID)
+	case "resume":
+		err = h.automation.ResumeTask(taskID)
+	case "skip-paper":
+		err = h.automation.SkipPaper(taskID)
+	case "cancel":
+		_ = h.automation.StopTask(taskID)
+		task.Status = "cancelled"
+	default:
+		return errUnknownAction
+	}
+	if err != nil {
+		return err
+	}
+	h.refresh(task)
+	task.UpdatedAt = time.Now().Format("2006-01-02 15:04:05")
+	return nil
+}
+
+var errUnknownAction = errors.New("unknown action")
+
+func controlErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrTaskNotFound):
+		return 404
+	case errors.Is(err, errUnknownAction):
+		return 400
+	}
+	return 409
+}
+
 func (h *TeacherTaskHandler) GetTaskStatus(c *fiber.Ctx) error {
 	taskID := c.Params("id")
 
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
-	task := h.findTask(taskID)
+	task := h.ownedTask(taskID, currentUser(c))
+	if task == nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Task not found"})
+	}
+	message := "任务执行中..."
+	if status, ok := h.automation.GetTaskStatus(taskID); ok && status.Message != "" {
+		message = status.Message
+	}
 
 	return c.JSON(fiber.Map{
 		"taskId":          taskID,
@@ -155,14 +312,24 @@ func (h *TeacherTaskHandler) GetTaskStatus(c *fiber.Ctx) error {
 		"completedPapers": intValue(task, func(t *TeacherTask) int { return t.CompletedPapers }),
 		"failedPapers":    intValue(task, func(t *TeacherTask) int { return t.FailedPapers }),
 		"averageScore":    floatValue(task, func(t *TeacherTask) float64 { return t.AverageScore }),
-		"progress":        "0%",
-		"message":         "任务执行中...",
+		"progress":        progressPercent(task),
+		"message":         message,
 		"timestamp":       time.Now().Format("2006-01-02 15:04:05"),
 	})
 }
 
 func (h *TeacherTaskHandler) GetTaskStatistics(c *fiber.Ctx) error {
 	taskID := c.Params("id")
+	h.mu.Lock()
+	owned := h.ownedTask(taskID, currentUser(c)) != nil
+	h.mu.Unlock()
+	if !owned {
+		return c.Status(404).JSON(fiber.Map{"error": "Task not found"})
+	}
+	usage, err := usageStore.totalsFor(c.UserContext(), "task_id", taskID)
+	if err != nil {
+		return storeError(c, "get task usage", err)
+	}
 
 	h.mu.Lock()
 	defer h.mu.Unlock()
@@ -176,6 +343,8 @@ func (h *TeacherTaskHandler) GetTaskStatistics(c *fiber.Ctx) error {
 		"failedPapers":    intValue(task, func(t *TeacherTask) int { return t.FailedPapers }),
 		"averageScore":    floatValue(task, func(t *TeacherTask) float64 { return t.AverageScore }),
 		"passRate":        0.0,
+		"usage":           usage,
+		"currency":        llmPrices.Currency,
 	})
 }
 
@@ -185,7 +354,10 @@ func (h *TeacherTaskHandler) GetTaskAnalytics(c *fiber.Ctx) error {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
-	task := h.findTask(taskID)
+	task := h.ownedTask(taskID, currentUser(c))
+	if task == nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Task not found"})
+	}
 
 	return c.JSON(fiber.Map{
 		"taskId": taskID,
@@ -198,12 +370,13 @@ func (h *TeacherTaskHandler) GetTaskAnalytics(c *fiber.Ctx) error {
 
 func (h *TeacherTaskHandler) DeleteTeacherTask(c *fiber.Ctx) error {
 	taskID := c.Params("id")
+	user := currentUser(c)
 
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
 	for i := range h.tasks {
-		if h.tasks[i].ID == taskID {
+		if h.tasks[i].ID == taskID && ownsTask(&h.tasks[i], user) {
 			h.tasks = append(h.tasks[:i], h.tasks[i+1:]...)
 			break
 		}
@@ -219,12 +392,40 @@ func (h *TeacherTaskHandler) DeleteTeacherTask(c *fiber.Ctx) error {
 func (h *TeacherTaskHandler) findTask(taskID string) *TeacherTask {
 	for i := range h.tasks {
 		if h.tasks[i].ID == taskID {
+			h.refresh(&h.tasks[i])
 			return &h.tasks[i]
 		}
 	}
 	return nil
 }
 
+// ownedTask 查找属于 user 的任务，其他教师的任务视为不存在；调用方需持有锁
+func (h *TeacherTaskHandler) ownedTask(taskID string, user User) *TeacherTask {
+	task := h.findTask(taskID)
+	if task == nil || !ownsTask(task, user) {
+		return nil
+	}
+	return task
+}
+
+func ownsTask(task *TeacherTask, user User) bool {
+	return task.OwnerUsername == user.Username && task.OwnerRole == user.Role
+}
+
+// refresh 用自动化服务中的执行进度更新任务，调用方需持有锁
+func (h *TeacherTaskHandler) refresh(task *TeacherTask) {
+	status, ok := h.automation.GetTaskStatus(task.ID)
+	if !ok {
+		return
+	}
+	task.Status = status.Status
+	task.TotalPapers = status.TotalPapers
+	task.CompletedPapers = status.CompletedPapers
+	task.FailedPapers = status.FailedPapers
+	task.AverageScore = status.AverageScore
+	task.UpdatedAt = status.LastUpdateTime.Format("2006-01-02 15:04:05")
+}
+
 func statusOrPending(t *TeacherTask) string {
 	if t == nil || t.Status == "" {
 		return "pending"
@@ -245,3 +446,10 @@ func floatValue(t *TeacherTask, f func(*TeacherTask) float64) float64 {
 	}
 	return f(t)
 }
+
+func progressPercent(t *TeacherTask) string {
+	if t == nil || t.TotalPapers == 0 {
+		return "0%"
+	}
+	return fmt.Sprintf("%d%%", (t.CompletedPapers+t.FailedPapers)*100/t.TotalPapers)
+}
@@ -0,0 +1,167 @@
+package api
+
+import (
+	"auto-grad-backend/internal/logging"
+	"auto-grad-backend/internal/services"
+	"context"
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"log/slog"
+	"time"
+)
+
+// LLMUsage 是一次大模型调用的 token 用量与费用，关联到改卷或教师任务
+type LLMUsage struct {
+	ID               int64   `json:"id"`
+	Provider         string  `json:"provider"`
+	Model            string  `json:"model"`
+	GradingID        string  `json:"gradingId,omitempty"`
+	TaskID           string  `json:"taskId,omitempty"`
+	OwnerUsername    string  `json:"ownerUsername"`
+	OwnerRole        string  `json:"ownerRole"`
+	PromptTokens     int     `json:"promptTokens"`
+	CompletionTokens int     `json:"completionTokens"`
+	TotalTokens      int     `json:"totalTokens"`
+	CacheHitTokens   int     `json:"cacheHitTokens"`
+	Cost             float64 `json:"cost"`
+	Currency         string  `json:"currency"`
+	CreatedAt        string  `json:"createdAt"`
+}
+
+// UsageTotals 是按某个维度汇总后的用量
+type UsageTotals struct {
+	Key              string  `json:"key"`
+	Calls            int     `json:"calls"`
+	PromptTokens     int     `json:"promptTokens"`
+	CompletionTokens int     `json:"completionTokens"`
+	TotalTokens      int     `json:"totalTokens"`
+	Cost             float64 `json:"cost"`
+}
+
+type UsageStore struct {
+	pool *pgxpool.Pool
+}
+
+func NewUsageStore(pool *pgxpool.Pool) *UsageStore {
+	return &UsageStore{pool: pool}
+}
+
+func (s *UsageStore) record(ctx context.Context, u LLMUsage) error {
+	_, err := s.pool.Exec(ctx, `
+INSERT INTO llm_usage (provider, model, grading_id, task_id, owner_username, owner_role, prompt_tokens, completion_tokens, total_tokens, cache_hit_tokens, cost, currency)
+VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12)
+`, u.Provider, u.Model, u.GradingID, u.TaskID, u.OwnerUsername, u.OwnerRole, u.PromptTokens, u.CompletionTokens, u.TotalTokens, u.CacheHitTokens, u.Cost, u.Currency)
+	return err
+}
+
+func (s *UsageStore) listByGrading(ctx context.Context, gradingID string) ([]LLMUsage, error) {
+	rows, err := s.pool.Query(ctx, `
+SELECT id, provider, model, grading_id, task_id, owner_username, owner_role, prompt_tokens, completion_tokens, total_tokens, cache_hit_tokens, cost::float8, currency, created_at
+FROM llm_usage WHERE grading_id=$1 ORDER BY id`, gradingID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []LLMUsage{}
+	for rows.Next() {
+		var u LLMUsage
+		var created time.Time
+		if err := rows.Scan(&u.ID, &u.Provider, &u.Model, &u.GradingID, &u.TaskID, &u.OwnerUsername, &u.OwnerRole, &u.PromptTokens, &u.CompletionTokens, &u.TotalTokens, &u.CacheHitTokens, &u.Cost, &u.Currency, &created); err != nil {
+			return nil, err
+		}
+		u.CreatedAt = created.Format(time.RFC3339)
+		list = append(list, u)
+	}
+	return list, rows.Err()
+}
+
+// 报表可用的汇总维度，值直接拼进 SQL，只能来自这里
+var usageDimensions = map[string]string{
+	"user":     `owner_role || ':' || owner_username`,
+	"day":      `to_char(created_at, 'YYYY-MM-DD')`,
+	"provider": `provider || '/' || model`,
+}
+
+// aggregate 按维度统计 [from, to) 时间范围内的用量
+func (s *UsageStore) aggregate(ctx context.Context, dimension string, from, to time.Time) ([]UsageTotals, error) {
+	key := usageDimensions[dimension]
+	rows, err := s.pool.Query(ctx, `
+SELECT `+key+` AS k, count(*), sum(prompt_tokens), sum(completion_tokens), sum(total_tokens), sum(cost)::float8
+FROM llm_usage WHERE created_at >= $1 AND created_at < $2
+GROUP BY k ORDER BY k`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []UsageTotals{}
+	for rows.Next() {
+		var t UsageTotals
+		if err := rows.Scan(&t.Key, &t.Calls, &t.PromptTokens, &t.CompletionTokens, &t.TotalTokens, &t.Cost); err != nil {
+			return nil, err
+		}
+		list = append(list, t)
+	}
+	return list, rows.Err()
+}
+
+// totalsFor 汇总某个改卷或教师任务的全部用量
+func (s *UsageStore) totalsFor(ctx context.Context, column, id string) (UsageTotals, error) {
+	t := UsageTotals{Key: id}
+	err := s.pool.QueryRow(ctx, `
+SELECT count(*), coalesce(sum(prompt_tokens), 0), coalesce(sum(completion_tokens), 0), coalesce(sum(total_tokens), 0), coalesce(sum(cost), 0)::float8
+FROM llm_usage WHERE `+column+`=$1`, id).Scan(&t.Calls, &t.PromptTokens, &t.CompletionTokens, &t.TotalTokens, &t.Cost)
+	return t, err
+}
+
+// recordLLMUsage 按价格表计算费用并落库；记录失败只打日志，不影响评分结果
+func recordLLMUsage(ctx context.Context, u LLMUsage, usage services.TokenUsage) {
+	u.PromptTokens = usage.PromptTokens
+	u.CompletionTokens = usage.CompletionTokens
+	u.TotalTokens = usage.TotalTokens
+	u.CacheHitTokens = usage.PromptCacheHitTokens
+	u.Currency = llmPrices.Currency
+	cost, ok := llmPrices.Cost(u.Model, usage)
+	if !ok {
+		slog.Warn("no price configured for model, cost recorded as 0", "model", u.Model)
+	}
+	u.Cost = cost
+	if err := usageStore.record(ctx, u); err != nil {
+		logging.FromContext(ctx).Error("failed to record usage", "grading_id", u.GradingID, "task_id", u.TaskID, "err", err)
+	}
+}
+
+// getUsageReport 管理员用量报表：按用户、按天、按服务商汇总，默认最近 30 天
+func getUsageReport(c *fiber.Ctx) error {
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	from, to := today.AddDate(0, 0, -29), today.AddDate(0, 0, 1)
+	if v := c.Query("from"); v != "" {
+		t, err := time.ParseInLocation("2006-01-02", v, time.Local)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "from 格式应为 YYYY-MM-DD"})
+		}
+		from = t
+	}
+	if v := c.Query("to"); v != "" {
+		t, err := time.ParseInLocation("2006-01-02", v, time.Local)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "to 格式应为 YYYY-MM-DD"})
+		}
+		// to 为包含当天的截止日期
+		to = t.AddDate(0, 0, 1)
+	}
+
+	report := fiber.Map{
+		"from":     from.Format("2006-01-02"),
+		"to":       to.AddDate(0, 0, -1).Format("2006-01-02"),
+		"currency": llmPrices.Currency,
+	}
+	for field, dim := range map[string]string{"byUser": "user", "byDay": "day", "byProvider": "provider"} {
+		totals, err := usageStore.aggregate(c.UserContext(), dim, from, to)
+		if err != nil {
+			return storeError(c, "aggregate usage", err)
+		}
+		report[field] = totals
+	}
+	return c.JSON(report)
+}
@@ -0,0 +1,264 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/crypto/bcrypt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// hashPassword 以 bcrypt 保存密码
+func hashPassword(plain string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(plain), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("hash password: %w", err)
+	}
+	return string(hash), nil
+}
+
+// isPasswordHash 区分 bcrypt 哈希与引入哈希前保存的明文密码
+func isPasswordHash(stored string) bool {
+	return strings.HasPrefix(stored, "$2a$") || strings.HasPrefix(stored, "$2b$") || strings.HasPrefix(stored, "$2y$")
+}
+
+// passwordMatches 校验密码；仍兼容旧的明文密码，登录成功后由调用方升级为哈希
+func passwordMatches(stored, plain string) bool {
+	if isPasswordHash(stored) {
+		return bcrypt.CompareHashAndPassword([]byte(stored), []byte(plain)) == nil
+	}
+	return stored != "" && subtle.ConstantTimeCompare([]byte(stored), []byte(plain)) == 1
+}
+
+// List 按角色与用户名排序列出用户，role 为空时列出全部
+func (u *UserStore) List(ctx context.Context, role string) ([]User, error) {
+	rows, err := u.pool.Query(ctx, `
+SELECT username, role, name, email, disabled_at IS NOT NULL, created_at
+FROM users WHERE $1 = '' OR role = $1
+ORDER BY role, username`, role)
+	if err != nil {
+		return nil, fmt.Errorf("list users: %w", err)
+	}
+	defer rows.Close()
+	users := []User{}
+	for rows.Next() {
+		var usr User
+		var created *time.Time
+		if err := rows.Scan(&usr.Username, &usr.Role, &usr.Name, &usr.Email, &usr.Disabled, &created); err != nil {
+			return nil, fmt.Errorf("list users: %w", err)
+		}
+		usr.CreatedAt = formatTime(created)
+		users = append(users, usr)
+	}
+	return users, rows.Err()
+}
+
+// SetPassword 以哈希形式保存新密码，并撤销该账号的全部会话；用户不存在时返回 errUserNotFound
+func (u *UserStore) SetPassword(ctx context.Context, username, role, plain string) error {
+	_, err := u.setPassword(ctx, username, role, plain)
+	return err
+}
+
+// setPassword 返回递增后的会话版本，供调用方为当前会话签发新令牌
+func (u *UserStore) setPassword(ctx context.Context, username, role, plain string) (int, error) {
+	hash, err := hashPassword(plain)
+	if err != nil {
+		return 0, err
+	}
+	var version int
+	err = u.pool.QueryRow(ctx, `
+WITH revoked AS (`+revokeAccountSessions+`)
+UPDATE users SET password=$4, session_version=session_version+1
+WHERE username=$1 AND role=$2 RETURNING session_version`, username, role, revokePassword, hash).Scan(&version)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, errUserNotFound
+	}
+	if err != nil {
+		return 0, fmt.Errorf("set password %s/%s: %w", role, username, err)
+	}
+	return version, nil
+}
+
+// upgradePassword 把旧的明文密码替换为哈希，不影响已签发的令牌；密码已被修改时不做任何事
+func (u *UserStore) upgradePassword(ctx context.Context, user User, plain string) error {
+	hash, err := hashPassword(plain)
+	if err != nil {
+		return err
+	}
+	_, err = u.pool.Exec(ctx, `UPDATE users SET password=$4 WHERE username=$1 AND role=$2 AND password=$3`, user.Username, user.Role, user.Password, hash)
+	if err != nil {
+		return fmt.Errorf("upgrade password %s/%s: %w", user.Role, user.Username, err)
+	}
+	return nil
+}
+
+// SetDisabled 停用或重新启用账号；停用的账号无法登录，已登录的会话一并撤销
+func (u *UserStore) SetDisabled(ctx context.Context, username, role string, disabled bool) error {
+	if disabled {
+		if _, err := u.pool.Exec(ctx, revokeAccountSessions, username, role, revokeAccountClosed); err != nil {
+			return fmt.Errorf("set disabled %s/%s: %w", role, username, err)
+		}
+	}
+	return u.exec(ctx, "set disabled", username, role, `
+UPDATE users SET disabled_at = CASE WHEN $3 THEN coalesce(disabled_at, now()) END
+WHERE username=$1 AND role=$2`, disabled)
+}
+
+// ChangeRole 修改用户角色，并把该用户名下的改卷、孩子、班级、Webhook 与用量记录一并转到新角色；
+// 复核与修订记录中的操作人保留原样，作为历史留存
+func (u *UserStore) ChangeRole(ctx context.Context, username, from, to string) error {
+	tx, err := u.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("change role %s/%s: %w", from, username, err)
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `
+UPDATE users SET role=$3 WHERE username=$1 AND role=$2
+AND NOT EXISTS (SELECT 1 FROM users WHERE username=$1 AND role=$3)`, username, from, to)
+	if err != nil {
+		return fmt.Errorf("change role %s/%s: %w", from, username, err)
+	}
+	if tag.RowsAffected() == 0 {
+		if _, err := u.Get(ctx, username, from); err != nil {
+			return err
+		}
+		return errUserExists
+	}
+	// 会话按用户名与角色登记，换角色后原有登录全部作废
+	if _, err := tx.Exec(ctx, revokeAccountSessions, username, from, revokeRoleChanged); err != nil {
+		return fmt.Errorf("change role %s/%s: %w", from, username, err)
+	}
+	for _, table := range []string{"gradings", "students", "classes", "webhooks", "llm_usage"} {
+		if _, err := tx.Exec(ctx, `UPDATE `+table+` SET owner_role=$3 WHERE owner_username=$1 AND owner_role=$2`, username, from, to); err != nil {
+			return fmt.Errorf("change role %s/%s: update %s: %w", from, username, table, err)
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("change role %s/%s: %w", from, username, err)
+	}
+	return nil
+}
+
+func (u *UserStore) exec(ctx context.Context, op, username, role, sql string, args ...interface{}) error {
+	tag, err := u.pool.Exec(ctx, sql, append([]interface{}{username, role}, args...)...)
+	if err != nil {
+		return fmt.Errorf("%s %s/%s: %w", op, role, username, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return errUserNotFound
+	}
+	return nil
+}
+
+// RequeueFeedback 是管理员重新排队时写入的说明
+const RequeueFeedback = "已由管理员重新排队，等待处理"
+
+// Requeue 把指定状态的改卷改为 queued，ids 为空时处理所有该状态的改卷；
+// 排队的改卷在服务启动时由 ResumeQueuedGradings 继续处理。返回被重新排队的 id
+func (s *GradingStore) Requeue(ctx context.Context, statuses, ids []string) ([]string, error) {
+	if len(statuses) == 0 {
+		return nil, errors.New("requeue: no statuses given")
+	}
+	if ids == nil {
+		// nil 切片会编码为 NULL，使下面的条件恒不成立
+		ids = []string{}
+	}
+	rows, err := s.pool.Query(ctx, `
+UPDATE gradings SET status='queued', feedback=$3
+WHERE status = ANY($1) AND (cardinality($2::text[]) = 0 OR id = ANY($2))
+RETURNING id`, statuses, ids, RequeueFeedback)
+	if err != nil {
+		return nil, fmt.Errorf("requeue gradings: %w", err)
+	}
+	requeued, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("requeue gradings: %w", err)
+	}
+	return requeued, nil
+}
+
+// PurgeFilter 选择要清理的改卷：提交时间早于 Before，且状态属于 Statuses（为空表示任意终态）
+type PurgeFilter struct {
+	Before   time.Time
+	Statuses []string
+	// DryRun 只返回会被清理的改卷，不做删除
+	DryRun bool
+}
+
+// purgeableStatuses 是允许清理的终态；处理中与排队中的改卷从不清理
+var purgeableStatuses = []string{"completed", "failed", "needs_review", "cancelled", "quota_exceeded"}
+
+// Purge 删除符合条件的改卷及其复核、修订记录，并删除上传目录中对应的图片；
+// 调用量与费用记录保留用于对账。返回被清理（或 DryRun 时将被清理）的改卷
+func (s *GradingStore) Purge(ctx context.Context, f PurgeFilter, uploadDir string) ([]GradingRequest, error) {
+	statuses := f.Statuses
+	if len(statuses) == 0 {
+		statuses = purgeableStatuses
+	}
+	for _, st := range statuses {
+		if st == "processing" || st == "queued" {
+			return nil, fmt.Errorf("purge: refusing to purge %s gradings", st)
+		}
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("purge gradings: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `SELECT `+gradingColumns+` FROM gradings WHERE submit_time < $1 AND status = ANY($2) ORDER BY submit_time ASC FOR UPDATE`, f.Before, statuses)
+	if err != nil {
+		return nil, fmt.Errorf("purge gradings: %w", err)
+	}
+	items := []GradingRequest{}
+	for rows.Next() {
+		var g GradingRequest
+		if err := scanGrading(rows, &g); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan grading: %w", err)
+		}
+		items = append(items, g)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("purge gradings: %w", err)
+	}
+	if f.DryRun || len(items) == 0 {
+		return items, nil
+	}
+	ids := make([]string, len(items))
+	for i, item := range items {
+		ids[i] = item.ID
+	}
+	for _, table := range []string{"grading_reviews", "grading_revisions"} {
+		if _, err := tx.Exec(ctx, `DELETE FROM `+table+` WHERE grading_id = ANY($1)`, ids); err != nil {
+			return nil, fmt.Errorf("purge gradings: delete %s: %w", table, err)
+		}
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM gradings WHERE id = ANY($1)`, ids); err != nil {
+		return nil, fmt.Errorf("purge gradings: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("purge gradings: %w", err)
+	}
+
+	// 记录已删除，图片删除失败只影响磁盘占用，不回滚
+	for _, item := range items {
+		for _, name := range []string{item.PaperImage, item.AnswerImage} {
+			if name == "" || filepath.IsAbs(name) || strings.Contains(name, "..") {
+				continue
+			}
+			if err := os.Remove(filepath.Join(uploadDir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return items, fmt.Errorf("purge gradings: remove image: %w", err)
+			}
+		}
+	}
+	return items, nil
+}
@@ -0,0 +1,614 @@
+package api
+
+import (
+	"auto-grad-backend/internal/events"
+	"auto-grad-backend/internal/logging"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"io"
+	"log/slog"
+	mathrand "math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// 可订阅的 Webhook 事件
+const (
+	WebhookGradingCompleted = "grading.completed"
+	WebhookGradingFailed    = "grading.failed"
+	WebhookTaskCompleted    = "task.completed"
+	WebhookTaskFailed       = "task.failed"
+	WebhookPing             = "ping"
+)
+
+var webhookEvents = []string{WebhookGradingCompleted, WebhookGradingFailed, WebhookTaskCompleted, WebhookTaskFailed}
+
+// 投递重试：最多 webhookMaxAttempts 次，间隔从 webhookBaseBackoff 起指数增长并加随机抖动。
+// 待重试的投递记录 next_attempt_at 落库，由 RunWebhookRetries 按时重试，重启后继续
+const (
+	webhookMaxAttempts   = 5
+	webhookBaseBackoff   = 2 * time.Second
+	webhookTimeout       = 10 * time.Second
+	webhookRetryInterval = time.Second
+	webhookRetryBatch    = 20
+	// 投递进行中时把 next_attempt_at 推后 webhookLease，避免被重试循环重复领取；进程中途退出时租约到期后重试
+	webhookLease = 3 * webhookTimeout
+)
+
+var errWebhookAddress = errors.New("webhook address is not public")
+
+// webhookClient 不走代理，并在建立连接前检查实际连接的地址，重定向与 DNS 重绑定也无法指向内网
+var webhookClient = &http.Client{
+	Timeout: webhookTimeout,
+	Transport: &http.Transport{
+		DialContext:         (&net.Dialer{Timeout: 5 * time.Second, Control: checkDialAddress}).DialContext,
+		TLSHandshakeTimeout: 5 * time.Second,
+		MaxIdleConns:        10,
+		IdleConnTimeout:     90 * time.Second,
+	},
+}
+
+func checkDialAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+		return fmt.Errorf("%w: %s", errWebhookAddress, host)
+	}
+	return nil
+}
+
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// publicIP 排除回环、私有、链路本地（含云厂商元数据地址）、组播与未指定地址
+func publicIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() && !ip.IsMulticast() && !ip.IsUnspecified() && !sharedAddressSpace.Contains(ip)
+}
+
+type Webhook struct {
+	ID            int64    `json:"id"`
+	OwnerUsername string   `json:"ownerUsername"`
+	OwnerRole     string   `json:"ownerRole"`
+	URL           string   `json:"url"`
+	Secret        string   `json:"secret,omitempty"`
+	Events        []string `json:"events"`
+	Active        bool     `json:"active"`
+	CreatedAt     string   `json:"createdAt"`
+}
+
+type WebhookDelivery struct {
+	ID           int64  `json:"id"`
+	WebhookID    int64  `json:"webhookId"`
+	Event        string `json:"event"`
+	Payload      string `json:"payload"`
+	Status       string `json:"status"` // pending, succeeded, failed
+	Attempts     int    `json:"attempts"`
+	ResponseCode int    `json:"responseCode,omitempty"`
+	Error        string `json:"error,omitempty"`
+	CreatedAt    string `json:"createdAt"`
+	UpdatedAt    string `json:"updatedAt"`
+	// 待重试时为下次投递时间
+	NextAttemptAt string `json:"nextAttemptAt,omitempty"`
+}
+
+type WebhookStore struct {
+	pool *pgxpool.Pool
+}
+
+func NewWebhookStore(pool *pgxpool.Pool) *WebhookStore {
+	return &WebhookStore{pool: pool}
+}
+
+const webhookColumns = `id, owner_username, owner_role, url, secret, events, active, created_at`
+
+func scanWebhook(row pgx.Row, w *Webhook) error {
+	var evts string
+	var created time.Time
+	if err := row.Scan(&w.ID, &w.OwnerUsername, &w.OwnerRole, &w.URL, &w.Secret, &evts, &w.Active, &created); err != nil {
+		return err
+	}
+	w.Events = strings.Split(evts, ",")
+	w.CreatedAt = created.Format(time.RFC3339)
+	return nil
+}
+
+func (s *WebhookStore) create(ctx context.Context, w *Webhook) error {
+	row := s.pool.QueryRow(ctx, `
+INSERT INTO webhooks (owner_username, owner_role, url, secret, events, active)
+VALUES ($1,$2,$3,$4,$5,true)
+RETURNING id, created_at`, w.OwnerUsername, w.OwnerRole, w.URL, w.Secret, strings.Join(w.Events, ","))
+	var created time.Time
+	if err := row.Scan(&w.ID, &created); err != nil {
+		return err
+	}
+	w.Active = true
+	w.CreatedAt = created.Format(time.RFC3339)
+	return nil
+}
+
+func (s *WebhookStore) get(ctx context.Context, id int64) (*Webhook, error) {
+	var w Webhook
+	row := s.pool.QueryRow(ctx, `SELECT `+webhookColumns+` FROM webhooks WHERE id=$1`, id)
+	if err := scanWebhook(row, &w); err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+func (s *WebhookStore) listByOwner(ctx context.Context, username, role string) ([]Webhook, error) {
+	return s.query(ctx, `SELECT `+webhookColumns+` FROM webhooks WHERE owner_username=$1 AND owner_role=$2 ORDER BY id`, username, role)
+}
+
+// subscribers 返回订阅了某事件的启用中的 Webhook
+func (s *WebhookStore) subscribers(ctx context.Context, username, role, event string) ([]Webhook, error) {
+	return s.query(ctx, `SELECT `+webhookColumns+` FROM webhooks
+WHERE owner_username=$1 AND owner_role=$2 AND active AND $3 = ANY(string_to_array(events, ','))
+ORDER BY id`, username, role, event)
+}
+
+func (s *WebhookStore) query(ctx context.Context, sql string, args ...interface{}) ([]Webhook, error) {
+	rows, err := s.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	hooks := []Webhook{}
+	for rows.Next() {
+		var w Webhook
+		if err := scanWebhook(rows, &w); err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, w)
+	}
+	return hooks, rows.Err()
+}
+
+func (s *WebhookStore) delete(ctx context.Context, id int64) error {
+	_, err := s.pool.Exec(ctx, `DELETE FROM webhooks WHERE id=$1`, id)
+	return err
+}
+
+// addDelivery 记录一次待投递，首次投递随即开始，租约内不会被重试循环领取
+func (s *WebhookStore) addDelivery(ctx context.Context, d *WebhookDelivery) error {
+	row := s.pool.QueryRow(ctx, `
+INSERT INTO webhook_deliveries (webhook_id, event, payload, status, attempts, next_attempt_at)
+VALUES ($1,$2,$3,'pending',0,$4)
+RETURNING id, created_at`, d.WebhookID, d.Event, d.Payload, time.Now().Add(webhookLease))
+	var created time.Time
+	if err := row.Scan(&d.ID, &created); err != nil {
+		return err
+	}
+	d.Status = "pending"
+	d.CreatedAt = created.Format(time.RFC3339)
+	d.UpdatedAt = d.CreatedAt
+	return nil
+}
+
+func (s *WebhookStore) updateDelivery(ctx context.Context, d *WebhookDelivery) error {
+	_, err := s.pool.Exec(ctx, `
+UPDATE webhook_deliveries SET status=$2, attempts=$3, response_code=$4, error=$5, next_attempt_at=$6, updated_at=now()
+WHERE id=$1`, d.ID, d.Status, d.Attempts, d.ResponseCode, d.Error, parseTime(d.NextAttemptAt))
+	return err
+}
+
+const deliveryColumns = `id, webhook_id, event, payload, status, attempts, response_code, error, created_at, updated_at, next_attempt_at`
+
+func (s *WebhookStore) deliveries(ctx context.Context, webhookID int64, limit int) ([]WebhookDelivery, error) {
+	return s.queryDeliveries(ctx, `SELECT `+deliveryColumns+`
+FROM webhook_deliveries WHERE webhook_id=$1 ORDER BY id DESC LIMIT $2`, webhookID, limit)
+}
+
+// claimDue 领取到期待重试的投递并延长租约，多实例同时运行时不会重复领取
+func (s *WebhookStore) claimDue(ctx context.Context, limit int) ([]WebhookDelivery, error) {
+	return s.queryDeliveries(ctx, `
+UPDATE webhook_deliveries SET next_attempt_at=$2
+WHERE id IN (
+  SELECT id FROM webhook_deliveries
+  WHERE status='pending' AND next_attempt_at <= now()
+  ORDER BY next_attempt_at LIMIT $1
+  FOR UPDATE SKIP LOCKED)
+RETURNING `+deliveryColumns, limit, time.Now().Add(webhookLease))
+}
+
+func (s *WebhookStore) queryDeliveries(ctx context.Context, sql string, args ...interface{}) ([]WebhookDelivery, error) {
+	rows, err := s.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []WebhookDelivery{}
+	for rows.Next() {
+		var d WebhookDelivery
+		var created, updated time.Time
+		var next *time.Time
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.Event, &d.Payload, &d.Status, &d.Attempts, &d.ResponseCode, &d.Error, &created, &updated, &next); err != nil {
+			return nil, err
+		}
+		d.CreatedAt = created.Format(time.RFC3339)
+		d.UpdatedAt = updated.Format(time.RFC3339)
+		d.NextAttemptAt = formatTime(next)
+		list = append(list, d)
+	}
+	return list, rows.Err()
+}
+
+// signWebhook 计算签名：HMAC-SHA256(secret, timestamp + "." + body)，十六进制编码
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// attemptDelivery 发送一次请求，返回响应码；非 2xx 视为失败
+func attemptDelivery(ctx context.Context, hook *Webhook, d *WebhookDelivery) (int, error) {
+	body := []byte(d.Payload)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, "POST", hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "auto-grad-webhook/1.0")
+	req.Header.Set("X-AutoGrad-Event", d.Event)
+	req.Header.Set("X-AutoGrad-Delivery", strconv.FormatInt(d.ID, 10))
+	req.Header.Set("X-AutoGrad-Timestamp", timestamp)
+	req.Header.Set("X-AutoGrad-Signature", "sha256="+signWebhook(hook.Secret, timestamp, body))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// webhookBackoff 第 attempt 次失败后的重试间隔
+func webhookBackoff(attempt int) time.Duration {
+	backoff := webhookBaseBackoff << (attempt - 1)
+	return backoff + time.Duration(mathrand.Int63n(int64(backoff/2)))
+}
+
+// deliverAttempt 投递一次并更新投递记录；失败且未达最大次数时记下一次重试时间
+func deliverAttempt(hook *Webhook, d *WebhookDelivery) {
+	code, err := attemptDelivery(context.Background(), hook, d)
+	d.Attempts++
+	d.ResponseCode = code
+	d.Error = ""
+	d.NextAttemptAt = ""
+	switch {
+	case err == nil:
+		d.Status = "succeeded"
+	case d.Attempts >= webhookMaxAttempts:
+		d.Status = "failed"
+		d.Error = err.Error()
+	default:
+		d.Error = err.Error()
+		d.NextAttemptAt = time.Now().Add(webhookBackoff(d.Attempts)).Format(time.RFC3339)
+	}
+	ctx, cancel := backgroundContext()
+	defer cancel()
+	if err := webhookStore.updateDelivery(ctx, d); err != nil {
+		slog.Error("failed to update webhook delivery", "webhook_id", hook.ID, "delivery_id", d.ID, "err", err)
+	}
+}
+
+// RunWebhookRetries 定期重试到期的投递，ctx 取消后在当前投递结束时返回；
+// 已领取但未投递的记录在租约到期后由下一次运行重试
+func RunWebhookRetries(ctx context.Context) {
+	ticker := time.NewTicker(webhookRetryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		retryDueDeliveries(ctx)
+	}
+}
+
+func retryDueDeliveries(ctx context.Context) {
+	qctx, cancel := backgroundContext()
+	due, err := webhookStore.claimDue(qctx, webhookRetryBatch)
+	cancel()
+	if err != nil {
+		slog.Error("failed to claim webhook deliveries", "err", err)
+		return
+	}
+	for i := range due {
+		if ctx.Err() != nil {
+			return
+		}
+		d := &due[i]
+		hctx, cancel := backgroundContext()
+		hook, err := webhookStore.get(hctx, d.WebhookID)
+		cancel()
+		if err != nil {
+			// Webhook 已删除时投递记录随之级联删除
+			if !errors.Is(err, pgx.ErrNoRows) {
+				slog.Error("failed to load webhook", "webhook_id", d.WebhookID, "delivery_id", d.ID, "err", err)
+			}
+			continue
+		}
+		deliverAttempt(hook, d)
+	}
+}
+
+func newDelivery(ctx context.Context, hook *Webhook, event string, data interface{}) (*WebhookDelivery, error) {
+	payload, err := json.Marshal(fiber.Map{
+		"event":     event,
+		"createdAt": time.Now().Format(time.RFC3339),
+		"data":      data,
+	})
+	if err != nil {
+		return nil, err
+	}
+	d := &WebhookDelivery{WebhookID: hook.ID, Event: event, Payload: string(payload)}
+	if err := webhookStore.addDelivery(ctx, d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// notifyWebhooks 将事件投递给用户订阅了该事件的所有 Webhook
+func notifyWebhooks(ctx context.Context, username, role, event string, data interface{}) {
+	hooks, err := webhookStore.subscribers(ctx, username, role, event)
+	if err != nil {
+		logging.FromContext(ctx).Error("failed to load webhook subscribers", "event", event, "err", err)
+		return
+	}
+	for i := range hooks {
+		hook := hooks[i]
+		d, err := newDelivery(ctx, &hook, event, data)
+		if err != nil {
+			logging.FromContext(ctx).Error("failed to record webhook delivery", "webhook_id", hook.ID, "err", err)
+			continue
+		}
+		go deliverAttempt(&hook, d)
+	}
+}
+
+// dispatchWebhooks 监听事件总线，把改卷与教师任务的完成/失败转换为 Webhook 事件
+func dispatchWebhooks(topic string, e events.Event) {
+	kind, id := events.ParseTopic(topic)
+	switch {
+	case kind == "grading" && (e.Type == events.StageCompleted || e.Type == events.StageFailed):
+		go func() {
+			ctx, cancel := backgroundContext()
+			defer cancel()
+			item, err := gradingStore.get(ctx, id)
+			if err != nil {
+				slog.Error("failed to load grading for webhooks", "grading_id", id, "err", err)
+				return
+			}
+			event := WebhookGradingCompleted
+			if e.Type == events.StageFailed {
+				event = WebhookGradingFailed
+			}
+			notifyWebhooks(ctx, item.OwnerUsername, item.OwnerRole, event, item)
+		}()
+	case kind == "task" && (e.Type == events.StageCompleted || e.Type == events.StageFailed):
+		go func() {
+			teacherHandler.mu.Lock()
+			task := teacherHandler.findTask(id)
+			var snapshot TeacherTask
+			if task != nil {
+				snapshot = *task
+			}
+			teacherHandler.mu.Unlock()
+			if task == nil {
+				return
+			}
+			event := WebhookTaskCompleted
+			notify := snapshot.NotifyOnComplete
+			if e.Type == events.StageFailed {
+				event = WebhookTaskFailed
+				notify = snapshot.NotifyOnFailure
+			}
+			if !notify {
+				return
+			}
+			snapshot.Password = ""
+			ctx, cancel := backgroundContext()
+			defer cancel()
+			notifyWebhooks(ctx, snapshot.OwnerUsername, snapshot.OwnerRole, event, snapshot)
+		}()
+	}
+}
+
+var errInvalidWebhookURL = errors.New("invalid webhook url")
+
+// checkWebhookURL 校验地址格式并解析主机名，任一解析结果不是公网地址即拒绝
+func checkWebhookURL(ctx context.Context, raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return errInvalidWebhookURL
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil {
+		return fmt.Errorf("resolve %s: %w", u.Hostname(), err)
+	}
+	for _, a := range addrs {
+		if !publicIP(a.IP) {
+			return fmt.Errorf("%w: %s", errWebhookAddress, a.IP)
+		}
+	}
+	return nil
+}
+
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// ownedWebhook 读取路径参数中的 Webhook 并校验归属
+func ownedWebhook(c *fiber.Ctx) (*Webhook, error) {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return nil, c.Status(400).JSON(fiber.Map{"error": "Invalid webhook id"})
+	}
+	hook, err := webhookStore.get(c.UserContext(), id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, c.Status(404).JSON(fiber.Map{"error": "Webhook not found"})
+	}
+	if err != nil {
+		return nil, storeError(c, "get webhook", err)
+	}
+	user := currentUser(c)
+	if hook.OwnerUsername != user.Username || hook.OwnerRole != user.Role {
+		return nil, c.Status(404).JSON(fiber.Map{"error": "Webhook not found"})
+	}
+	return hook, nil
+}
+
+func listWebhooks(c *fiber.Ctx) error {
+	user := currentUser(c)
+	hooks, err := webhookStore.listByOwner(c.UserContext(), user.Username, user.Role)
+	if err != nil {
+		return storeError(c, "list webhooks", err)
+	}
+	for i := range hooks {
+		hooks[i].Secret = ""
+	}
+	return c.JSON(fiber.Map{"webhooks": hooks, "total": len(hooks), "availableEvents": webhookEvents})
+}
+
+func createWebhook(c *fiber.Ctx) error {
+	type Req struct {
+		URL    string   `json:"url"`
+		Events []string `json:"events"`
+		Secret string   `json:"secret"`
+	}
+	var req Req
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid request"})
+	}
+	if err := checkWebhookURL(c.UserContext(), req.URL); err != nil {
+		switch {
+		case errors.Is(err, errInvalidWebhookURL):
+			return c.Status(400).JSON(fiber.Map{"error": "Webhook 地址必须是 http(s) URL"})
+		case errors.Is(err, errWebhookAddress):
+			return c.Status(400).JSON(fiber.Map{"error": "Webhook 地址不能指向本机或内网"})
+		}
+		return c.Status(400).JSON(fiber.Map{"error": "无法解析 Webhook 地址"})
+	}
+	if len(req.Events) == 0 {
+		req.Events = webhookEvents
+	}
+	for _, e := range req.Events {
+		if !containsString(webhookEvents, e) {
+			return c.Status(400).JSON(fiber.Map{"error": "不支持的事件: " + e})
+		}
+	}
+	if req.Secret == "" {
+		secret, err := newWebhookSecret()
+		if err != nil {
+			logging.FromContext(c.UserContext()).Error("failed to generate webhook secret", "err", err)
+			return c.Status(500).JSON(fiber.Map{"error": "生成签名密钥失败"})
+		}
+		req.Secret = secret
+	}
+
+	user := currentUser(c)
+	hook := &Webhook{
+		OwnerUsername: user.Username,
+		OwnerRole:     user.Role,
+		URL:           req.URL,
+		Secret:        req.Secret,
+		Events:        req.Events,
+	}
+	if err := webhookStore.create(c.UserContext(), hook); err != nil {
+		return storeError(c, "create webhook", err)
+	}
+	// 密钥只在创建时返回一次
+	return c.Status(201).JSON(hook)
+}
+
+func deleteWebhook(c *fiber.Ctx) error {
+	hook, err := ownedWebhook(c)
+	if hook == nil {
+		return err
+	}
+	if err := webhookStore.delete(c.UserContext(), hook.ID); err != nil {
+		return storeError(c, "delete webhook", err)
+	}
+	return c.JSON(fiber.Map{"message": "Webhook deleted", "id": hook.ID})
+}
+
+func listWebhookDeliveries(c *fiber.Ctx) error {
+	hook, err := ownedWebhook(c)
+	if hook == nil {
+		return err
+	}
+	limit := c.QueryInt("limit", 50)
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	list, err := webhookStore.deliveries(c.UserContext(), hook.ID, limit)
+	if err != nil {
+		return storeError(c, "list webhook deliveries", err)
+	}
+	return c.JSON(fiber.Map{"deliveries": list, "total": len(list)})
+}
+
+// testWebhook 同步发送一次 ping 事件（不重试），便于用户立即看到结果
+func testWebhook(c *fiber.Ctx) error {
+	hook, err := ownedWebhook(c)
+	if hook == nil {
+		return err
+	}
+	d, err := newDelivery(c.UserContext(), hook, WebhookPing, fiber.Map{"webhookId": hook.ID, "message": "test delivery"})
+	if err != nil {
+		return storeError(c, "create webhook delivery", err)
+	}
+	// 投递耗时不计入请求的数据库超时，由 webhookClient 自身的超时控制
+	code, derr := attemptDelivery(context.WithoutCancel(c.UserContext()), hook, d)
+	d.Attempts = 1
+	d.ResponseCode = code
+	d.Status = "succeeded"
+	if derr != nil {
+		d.Status = "failed"
+		d.Error = derr.Error()
+	}
+	ctx, cancel := detachedContext(c.UserContext())
+	defer cancel()
+	if err := webhookStore.updateDelivery(ctx, d); err != nil {
+		logging.FromContext(c.UserContext()).Error("failed to update webhook delivery", "webhook_id", hook.ID, "delivery_id", d.ID, "err", err)
+	}
+	return c.JSON(d)
+}
+
+func containsString(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
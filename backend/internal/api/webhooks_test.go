@@ -0,0 +1,124 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSignWebhook(t *testing.T) {
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		body      string
+		want      string
+	}{
+		{"ping", "whsec_test", "1700000000", `{"event":"ping"}`, "aa8efe37b751e71157c508c5ac4acb1e9fe5225db98355dfc00f4b680afbc447"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := signWebhook(tt.secret, tt.timestamp, []byte(tt.body)); got != tt.want {
+				t.Fatalf("signature = %s, want %s", got, tt.want)
+			}
+			// 时间戳参与签名，重放旧请求时签名不匹配
+			if got := signWebhook(tt.secret, tt.timestamp+"1", []byte(tt.body)); got == tt.want {
+				t.Fatal("signature does not depend on timestamp")
+			}
+			if got := signWebhook(tt.secret+"x", tt.timestamp, []byte(tt.body)); got == tt.want {
+				t.Fatal("signature does not depend on secret")
+			}
+		})
+	}
+}
+
+func TestPublicIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"8.8.8.8", true},
+		{"2606:4700:4700::1111", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fc00::1", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"::ffff:127.0.0.1", false},
+		{"224.0.0.1", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			if got := publicIP(net.ParseIP(tt.ip)); got != tt.want {
+				t.Fatalf("publicIP(%s) = %v, want %v", tt.ip, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckWebhookURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want error
+	}{
+		{"https://8.8.8.8/hook", nil},
+		{"http://127.0.0.1:8080/hook", errWebhookAddress},
+		{"http://[::1]/hook", errWebhookAddress},
+		{"http://169.254.169.254/latest/meta-data", errWebhookAddress},
+		{"http://10.0.0.5/hook", errWebhookAddress},
+		{"ftp://8.8.8.8/hook", errInvalidWebhookURL},
+		{"not a url", errInvalidWebhookURL},
+		{"http:///hook", errInvalidWebhookURL},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			err := checkWebhookURL(context.Background(), tt.url)
+			if tt.want == nil && err != nil || tt.want != nil && !errors.Is(err, tt.want) {
+				t.Fatalf("checkWebhookURL(%q) = %v, want %v", tt.url, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebhookClientRefusesPrivateAddress(t *testing.T) {
+	hit := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { hit = true }))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := webhookClient.Do(req)
+	if err == nil {
+		resp.Body.Close()
+	}
+	if !errors.Is(err, errWebhookAddress) {
+		t.Fatalf("err = %v, want errWebhookAddress", err)
+	}
+	if hit {
+		t.Fatal("request reached the loopback server")
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	for attempt := 1; attempt < webhookMaxAttempts; attempt++ {
+		base := webhookBaseBackoff << (attempt - 1)
+		for i := 0; i < 20; i++ {
+			if got := webhookBackoff(attempt); got < base || got >= base+base/2 {
+				t.Fatalf("webhookBackoff(%d) = %v, want in [%v, %v)", attempt, got, base, base+base/2)
+			}
+		}
+	}
+}
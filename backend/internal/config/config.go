@@ -1,56 +1,351 @@
 package config
 
 import (
-	"log"
+	"errors"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+	"io"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
 
-	"github.com/joho/godotenv"
+// 运行环境：production 下启动时拒绝不安全的默认配置
+const (
+	EnvDevelopment = "development"
+	EnvProduction  = "production"
 )
 
+// Config 是全部运行配置。加载顺序为默认值、配置文件（YAML 或 TOML）、环境变量，后者覆盖前者。
+// 字段的 env 标签为对应的环境变量名，嵌套结构上的 envPrefix 会拼接到其内部字段的环境变量名前；
+// 带 secret 标签的字段在打印时隐去
 type Config struct {
-	DBHost     string
-	DBPort     string
-	DBUser     string
-	DBPassword string
-	DBName     string
-	PostgresURL string
-	ServerPort string
-	JWTSecret  string
-	UploadPath string
+	Env        string           `yaml:"env" toml:"env" env:"APP_ENV"`
+	Server     ServerConfig     `yaml:"server" toml:"server"`
+	Database   DatabaseConfig   `yaml:"database" toml:"database"`
+	Storage    StorageConfig    `yaml:"storage" toml:"storage"`
+	Auth       AuthConfig       `yaml:"auth" toml:"auth"`
+	RateLimit  RateLimitConfig  `yaml:"rate_limit" toml:"rate_limit"`
+	Baidu      BaiduConfig      `yaml:"baidu" toml:"baidu"`
+	DeepSeek   DeepSeekConfig   `yaml:"deepseek" toml:"deepseek"`
+	Resilience ResilienceConfig `yaml:"resilience" toml:"resilience"`
+	Grading    GradingConfig    `yaml:"grading" toml:"grading"`
+	SMTP       SMTPConfig       `yaml:"smtp" toml:"smtp"`
+	Log        LogConfig        `yaml:"log" toml:"log"`
+	Health     HealthConfig     `yaml:"health" toml:"health"`
+}
 
-	// API Keys
-	BaiduAPIKey    string
-	BaiduSecretKey string
-	DeepSeekAPIKey string
+type ServerConfig struct {
+	Port         string        `yaml:"port" toml:"port" env:"SERVER_PORT"`
+	BaseURL      string        `yaml:"base_url" toml:"base_url" env:"APP_BASE_URL"`
+	ReadTimeout  time.Duration `yaml:"read_timeout" toml:"read_timeout" env:"SERVER_READ_TIMEOUT"`
+	WriteTimeout time.Duration `yaml:"write_timeout" toml:"write_timeout" env:"SERVER_WRITE_TIMEOUT"`
+	IdleTimeout  time.Duration `yaml:"idle_timeout" toml:"idle_timeout" env:"SERVER_IDLE_TIMEOUT"`
+	// 收到停止信号后等待请求与改卷完成的时间，应小于编排系统的强制终止时间
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout" env:"SERVER_SHUTDOWN_TIMEOUT"`
+	// 反向代理的 IP 或网段，逗号分隔；只有来自这些地址的请求才从 ProxyHeader 读取客户端 IP，为空时使用连接地址
+	TrustedProxies string `yaml:"trusted_proxies" toml:"trusted_proxies" env:"TRUSTED_PROXIES"`
+	ProxyHeader    string `yaml:"proxy_header" toml:"proxy_header" env:"PROXY_HEADER"`
 }
 
-func LoadConfig() *Config {
-	// 尝试加载本地 .env，环境变量优先生效
-	if err := godotenv.Load(".env"); err != nil {
-		// 不阻断启动，保持可用
-		log.Printf("warning: could not load .env file: %v", err)
+// TrustedProxyList 返回拆分后的受信任代理列表
+func (s ServerConfig) TrustedProxyList() []string {
+	var proxies []string
+	for _, p := range strings.Split(s.TrustedProxies, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			proxies = append(proxies, p)
+		}
 	}
+	return proxies
+}
+
+type DatabaseConfig struct {
+	URL     string        `yaml:"url" toml:"url" env:"POSTGRES_URL" secret:"url"`
+	Timeout time.Duration `yaml:"timeout" toml:"timeout" env:"DB_TIMEOUT"`
+}
+
+type StorageConfig struct {
+	UploadDir string `yaml:"upload_dir" toml:"upload_dir" env:"UPLOAD_PATH"`
+}
+
+type AuthConfig struct {
+	JWTSecret string `yaml:"jwt_secret" toml:"jwt_secret" env:"JWT_SECRET" secret:"true"`
+	// 启动时创建密码为 123123 的演示账号，仅用于本地开发
+	SeedDemoUsers bool `yaml:"seed_demo_users" toml:"seed_demo_users" env:"SEED_DEMO_USERS"`
+	// 找回密码邮件中重置链接的有效期
+	ResetTokenTTL time.Duration `yaml:"reset_token_ttl" toml:"reset_token_ttl" env:"PASSWORD_RESET_TTL"`
+	// 访问令牌的有效期，过期后客户端用刷新令牌换发
+	AccessTokenTTL time.Duration `yaml:"access_token_ttl" toml:"access_token_ttl" env:"ACCESS_TOKEN_TTL"`
+	// 会话闲置超过该时长后刷新令牌失效，需要重新登录
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl" toml:"refresh_token_ttl" env:"REFRESH_TOKEN_TTL"`
+}
+
+// RateLimitConfig 是登录失败锁定与提交接口限流的参数，计数保存在 Postgres 中，多实例共享
+type RateLimitConfig struct {
+	// 同一账号、同一 IP 在 LoginWindow 内登录失败达到次数上限后锁定
+	LoginAccountFailures int           `yaml:"login_account_failures" toml:"login_account_failures" env:"LOGIN_ACCOUNT_MAX_FAILURES"`
+	LoginIPFailures      int           `yaml:"login_ip_failures" toml:"login_ip_failures" env:"LOGIN_IP_MAX_FAILURES"`
+	LoginWindow          time.Duration `yaml:"login_window" toml:"login_window" env:"LOGIN_FAILURE_WINDOW"`
+	// 首次锁定的时长，此后每多失败一次加倍，最长 LoginMaxLockout
+	LoginLockout    time.Duration `yaml:"login_lockout" toml:"login_lockout" env:"LOGIN_LOCKOUT"`
+	LoginMaxLockout time.Duration `yaml:"login_max_lockout" toml:"login_max_lockout" env:"LOGIN_MAX_LOCKOUT"`
+	// 每个用户在 SubmitWindow 内最多提交的改卷次数，0 表示不限制
+	SubmitLimit  int           `yaml:"submit_limit" toml:"submit_limit" env:"SUBMIT_RATE_LIMIT"`
+	SubmitWindow time.Duration `yaml:"submit_window" toml:"submit_window" env:"SUBMIT_RATE_WINDOW"`
+}
+
+// ProviderLimits 是单个外部服务的限速与额度，QPS/并发为 0 表示不限制，额度为 0 表示只计数不限制
+type ProviderLimits struct {
+	QPS         float64 `yaml:"qps" toml:"qps" env:"QPS"`
+	Burst       int     `yaml:"burst" toml:"burst" env:"BURST"`
+	Concurrency int     `yaml:"concurrency" toml:"concurrency" env:"CONCURRENCY"`
+	DailyQuota  int     `yaml:"daily_quota" toml:"daily_quota" env:"DAILY_QUOTA"`
+}
+
+type BaiduConfig struct {
+	APIKey    string         `yaml:"api_key" toml:"api_key" env:"BAIDU_API_KEY" secret:"true"`
+	SecretKey string         `yaml:"secret_key" toml:"secret_key" env:"BAIDU_SECRET_KEY" secret:"true"`
+	Limits    ProviderLimits `yaml:"limits" toml:"limits" envPrefix:"BAIDU_"`
+}
+
+type DeepSeekConfig struct {
+	APIKey  string         `yaml:"api_key" toml:"api_key" env:"DEEPSEEK_API_KEY" secret:"true"`
+	BaseURL string         `yaml:"base_url" toml:"base_url" env:"DEEPSEEK_BASE_URL"`
+	Prices  string         `yaml:"prices" toml:"prices" env:"LLM_PRICES"`
+	Limits  ProviderLimits `yaml:"limits" toml:"limits" envPrefix:"DEEPSEEK_"`
+}
+
+// ResilienceConfig 是各外部服务共用的重试与熔断参数
+type ResilienceConfig struct {
+	BreakerThreshold int           `yaml:"breaker_threshold" toml:"breaker_threshold" env:"PROVIDER_BREAKER_THRESHOLD"`
+	BreakerCooldown  time.Duration `yaml:"breaker_cooldown" toml:"breaker_cooldown" env:"PROVIDER_BREAKER_COOLDOWN"`
+	MaxAttempts      int           `yaml:"max_attempts" toml:"max_attempts" env:"PROVIDER_MAX_ATTEMPTS"`
+	RetryBaseDelay   time.Duration `yaml:"retry_base_delay" toml:"retry_base_delay" env:"PROVIDER_RETRY_BASE_DELAY"`
+	RetryMaxDelay    time.Duration `yaml:"retry_max_delay" toml:"retry_max_delay" env:"PROVIDER_RETRY_MAX_DELAY"`
+}
+
+type GradingConfig struct {
+	OCRTimeout      time.Duration `yaml:"ocr_timeout" toml:"ocr_timeout" env:"GRADING_OCR_TIMEOUT"`
+	ScoreTimeout    time.Duration `yaml:"score_timeout" toml:"score_timeout" env:"GRADING_SCORE_TIMEOUT"`
+	Timeout         time.Duration `yaml:"timeout" toml:"timeout" env:"GRADING_TIMEOUT"`
+	ReviewThreshold float64       `yaml:"review_threshold" toml:"review_threshold" env:"REVIEW_CONFIDENCE_THRESHOLD"`
+	DoublePass      bool          `yaml:"double_pass" toml:"double_pass" env:"GRADING_DOUBLE_PASS"`
+}
+
+type SMTPConfig struct {
+	Host     string `yaml:"host" toml:"host" env:"SMTP_HOST"`
+	Port     string `yaml:"port" toml:"port" env:"SMTP_PORT"`
+	Username string `yaml:"username" toml:"username" env:"SMTP_USERNAME"`
+	Password string `yaml:"password" toml:"password" env:"SMTP_PASSWORD" secret:"true"`
+	From     string `yaml:"from" toml:"from" env:"SMTP_FROM"`
+}
+
+type LogConfig struct {
+	Level  string `yaml:"level" toml:"level" env:"LOG_LEVEL"`
+	Format string `yaml:"format" toml:"format" env:"LOG_FORMAT"`
+}
 
+type HealthConfig struct {
+	ProbeTTL   time.Duration `yaml:"probe_ttl" toml:"probe_ttl" env:"HEALTH_PROBE_TTL"`
+	MaxBacklog int           `yaml:"max_backlog" toml:"max_backlog" env:"HEALTH_MAX_BACKLOG"`
+}
+
+// Default 返回开发环境下可直接运行的默认配置，不含任何密钥
+func Default() *Config {
 	return &Config{
-		DBHost:     getEnv("DB_HOST", "localhost"),
-		DBPort:     getEnv("DB_PORT", "3306"),
-		DBUser:     getEnv("DB_USER", "root"),
-		DBPassword: getEnv("DB_PASSWORD", "Root123456!"),
-		DBName:     getEnv("DB_NAME", "auto_grad_web"),
-		PostgresURL: getEnv("POSTGRES_URL", ""),
-		ServerPort: getEnv("SERVER_PORT", "3000"),
-		JWTSecret:  getEnv("JWT_SECRET", "your-jwt-secret-key-change-in-production"),
-		UploadPath: getEnv("UPLOAD_PATH", "./uploads"),
+		Env: EnvDevelopment,
+		Server: ServerConfig{
+			Port:            "8080",
+			BaseURL:         "http://localhost:5174",
+			ReadTimeout:     30 * time.Second,
+			WriteTimeout:    30 * time.Second,
+			IdleTimeout:     60 * time.Second,
+			ShutdownTimeout: 25 * time.Second,
+			ProxyHeader:     "X-Real-IP",
+		},
+		Database: DatabaseConfig{Timeout: 10 * time.Second},
+		Storage:  StorageConfig{UploadDir: "./uploads"},
+		Auth: AuthConfig{
+			ResetTokenTTL:   30 * time.Minute,
+			AccessTokenTTL:  15 * time.Minute,
+			RefreshTokenTTL: 30 * 24 * time.Hour,
+		},
+		RateLimit: RateLimitConfig{
+			LoginAccountFailures: 5,
+			LoginIPFailures:      20,
+			LoginWindow:          15 * time.Minute,
+			LoginLockout:         time.Minute,
+			LoginMaxLockout:      time.Hour,
+			SubmitLimit:          30,
+			SubmitWindow:         time.Hour,
+		},
+		// 百度 OCR 免费额度 QPS 较低，与原批处理脚本每秒一张保持一致
+		Baidu: BaiduConfig{Limits: ProviderLimits{QPS: 1, Burst: 1, Concurrency: 2}},
+		DeepSeek: DeepSeekConfig{
+			BaseURL: "https://api.deepseek.com",
+			Limits:  ProviderLimits{QPS: 5, Burst: 1, Concurrency: 4},
+		},
+		Resilience: ResilienceConfig{
+			BreakerThreshold: 5,
+			BreakerCooldown:  30 * time.Second,
+			MaxAttempts:      3,
+			RetryBaseDelay:   500 * time.Millisecond,
+			RetryMaxDelay:    10 * time.Second,
+		},
+		Grading: GradingConfig{
+			OCRTimeout:      30 * time.Second,
+			ScoreTimeout:    60 * time.Second,
+			Timeout:         5 * time.Minute,
+			ReviewThreshold: 0.7,
+		},
+		SMTP:   SMTPConfig{Port: "25"},
+		Log:    LogConfig{Level: "info", Format: "json"},
+		Health: HealthConfig{ProbeTTL: time.Minute, MaxBacklog: 50},
+	}
+}
+
+// Load 依次应用默认值、配置文件与环境变量，path 为空时使用 CONFIG_FILE。
+// 只报告文件与取值格式错误，取值范围与生产环境要求由 Validate 检查
+func Load(path string) (*Config, error) {
+	cfg := Default()
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	if path != "" {
+		if err := loadFile(path, cfg); err != nil {
+			return cfg, err
+		}
+	}
+	return cfg, applyEnv(cfg)
+}
+
+func loadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(strings.NewReader(string(data)))
+		dec.KnownFields(true)
+		// 空文件返回 io.EOF，视为没有覆盖任何配置
+		if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("parse %s: %w", path, err)
+		}
+	case ".toml":
+		md, err := toml.Decode(string(data), cfg)
+		if err != nil {
+			return fmt.Errorf("parse %s: %w", path, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("parse %s: unknown keys %v", path, undecoded)
+		}
+	default:
+		return fmt.Errorf("unsupported config file %s: use .yaml, .yml or .toml", path)
+	}
+	return nil
+}
 
-		BaiduAPIKey:    getEnv("BAIDU_API_KEY", ""),
-		BaiduSecretKey: getEnv("BAIDU_SECRET_KEY", ""),
-		DeepSeekAPIKey: getEnv("DEEPSEEK_API_KEY", ""),
+// Field 是一个配置项，Key 为配置文件中的路径（如 baidu.limits.qps）
+type Field struct {
+	Key    string
+	Env    string
+	Secret string
+	Value  reflect.Value
+}
+
+// Fields 按声明顺序列出全部配置项
+func (c *Config) Fields() []Field {
+	var fields []Field
+	var walk func(v reflect.Value, key, env string)
+	walk = func(v reflect.Value, key, env string) {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name := key + strings.Split(f.Tag.Get("yaml"), ",")[0]
+			if f.Type.Kind() == reflect.Struct && f.Type != reflect.TypeOf(time.Duration(0)) {
+				walk(v.Field(i), name+".", env+f.Tag.Get("envPrefix"))
+				continue
+			}
+			fields = append(fields, Field{Key: name, Env: env + f.Tag.Get("env"), Secret: f.Tag.Get("secret"), Value: v.Field(i)})
+		}
+	}
+	walk(reflect.ValueOf(c).Elem(), "", "")
+	return fields
+}
+
+// applyEnv 用已设置的环境变量覆盖配置，格式不合法时报错而不是静默忽略
+func applyEnv(cfg *Config) error {
+	var errs []string
+	for _, f := range cfg.Fields() {
+		raw, ok := os.LookupEnv(f.Env)
+		if !ok || raw == "" {
+			continue
+		}
+		if err := setValue(f.Value, raw); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", f.Env, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid environment: %s", strings.Join(errs, "; "))
 	}
+	return nil
 }
 
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+func setValue(v reflect.Value, raw string) error {
+	if v.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(n))
+	case reflect.Float64:
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// Display 返回配置项用于展示的值，密钥只显示是否已设置，连接串隐去密码
+func (f Field) Display() string {
+	if f.Value.Type() == reflect.TypeOf(time.Duration(0)) {
+		return time.Duration(f.Value.Int()).String()
+	}
+	s := fmt.Sprint(f.Value.Interface())
+	switch f.Secret {
+	case "":
+		return s
+	case "url":
+		return redactURL(s)
+	}
+	if s == "" {
+		return "(unset)"
 	}
-	return defaultValue
+	return "[REDACTED]"
 }
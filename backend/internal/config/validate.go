@@ -0,0 +1,145 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// 曾作为默认值或示例出现过的弱密钥，生产环境不允许使用
+var insecureSecrets = map[string]bool{
+	"your-jwt-secret-key-change-in-production": true,
+	"Root123456!": true,
+	"changeme":    true,
+	"password":    true,
+	"postgres":    true,
+	"secret":      true,
+}
+
+const minJWTSecretLength = 32
+
+// Validate 检查取值范围；生产环境下额外拒绝缺失的凭据与不安全的默认值
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Env == EnvDevelopment || c.Env == EnvProduction, "env: must be %s or %s, got %q", EnvDevelopment, EnvProduction, c.Env)
+	port, err := strconv.Atoi(c.Server.Port)
+	check(err == nil && port > 0 && port < 65536, "server.port: invalid port %q", c.Server.Port)
+	check(c.Database.URL != "", "database.url: POSTGRES_URL is required")
+	check(c.Storage.UploadDir != "", "storage.upload_dir: must not be empty")
+
+	for _, d := range []struct {
+		key   string
+		value time.Duration
+	}{
+		{"server.read_timeout", c.Server.ReadTimeout},
+		{"server.write_timeout", c.Server.WriteTimeout},
+		{"server.idle_timeout", c.Server.IdleTimeout},
+		{"server.shutdown_timeout", c.Server.ShutdownTimeout},
+		{"database.timeout", c.Database.Timeout},
+		{"auth.reset_token_ttl", c.Auth.ResetTokenTTL},
+		{"auth.access_token_ttl", c.Auth.AccessTokenTTL},
+		{"auth.refresh_token_ttl", c.Auth.RefreshTokenTTL},
+		{"rate_limit.login_window", c.RateLimit.LoginWindow},
+		{"rate_limit.login_lockout", c.RateLimit.LoginLockout},
+		{"rate_limit.submit_window", c.RateLimit.SubmitWindow},
+		{"resilience.breaker_cooldown", c.Resilience.BreakerCooldown},
+		{"resilience.retry_base_delay", c.Resilience.RetryBaseDelay},
+		{"resilience.retry_max_delay", c.Resilience.RetryMaxDelay},
+		{"grading.ocr_timeout", c.Grading.OCRTimeout},
+		{"grading.score_timeout", c.Grading.ScoreTimeout},
+		{"grading.timeout", c.Grading.Timeout},
+		{"health.probe_ttl", c.Health.ProbeTTL},
+	} {
+		check(d.value > 0, "%s: must be positive", d.key)
+	}
+	for _, p := range []struct {
+		name   string
+		limits ProviderLimits
+	}{{"baidu", c.Baidu.Limits}, {"deepseek", c.DeepSeek.Limits}} {
+		name, l := p.name, p.limits
+		check(l.QPS >= 0, "%s.limits.qps: must not be negative", name)
+		check(l.Burst >= 1, "%s.limits.burst: must be at least 1", name)
+		check(l.Concurrency >= 0, "%s.limits.concurrency: must not be negative", name)
+		check(l.DailyQuota >= 0, "%s.limits.daily_quota: must not be negative", name)
+	}
+	for _, p := range c.Server.TrustedProxyList() {
+		_, _, err := net.ParseCIDR(p)
+		check(err == nil || net.ParseIP(p) != nil, "server.trusted_proxies: %q is not an IP address or CIDR range", p)
+	}
+	check(c.Server.TrustedProxies == "" || c.Server.ProxyHeader != "", "server.proxy_header: required when server.trusted_proxies is set")
+	check(c.RateLimit.LoginAccountFailures >= 1, "rate_limit.login_account_failures: must be at least 1")
+	check(c.RateLimit.LoginIPFailures >= 1, "rate_limit.login_ip_failures: must be at least 1")
+	check(c.RateLimit.LoginMaxLockout >= c.RateLimit.LoginLockout, "rate_limit.login_max_lockout: must not be shorter than login_lockout")
+	check(c.RateLimit.SubmitLimit >= 0, "rate_limit.submit_limit: must not be negative")
+	check(c.Resilience.BreakerThreshold >= 1, "resilience.breaker_threshold: must be at least 1")
+	check(c.Resilience.MaxAttempts >= 1, "resilience.max_attempts: must be at least 1")
+	check(c.Grading.ReviewThreshold >= 0 && c.Grading.ReviewThreshold <= 1, "grading.review_threshold: must be between 0 and 1")
+	check(c.Health.MaxBacklog >= 0, "health.max_backlog: must not be negative")
+	check(c.SMTP.Host == "" || c.SMTP.From != "", "smtp.from: required when smtp.host is set")
+	var level slog.Level
+	check(level.UnmarshalText([]byte(c.Log.Level)) == nil, "log.level: must be debug, info, warn or error")
+	check(c.Log.Format == "json" || c.Log.Format == "text", "log.format: must be json or text")
+	check(c.DeepSeek.Prices == "" || json.Valid([]byte(c.DeepSeek.Prices)), "deepseek.prices: LLM_PRICES must be JSON")
+	if _, err := url.ParseRequestURI(c.DeepSeek.BaseURL); err != nil {
+		errs = append(errs, fmt.Errorf("deepseek.base_url: %v", err))
+	}
+
+	if c.Env == EnvProduction {
+		errs = append(errs, c.validateProduction()...)
+	}
+	return errors.Join(errs...)
+}
+
+func (c *Config) validateProduction() []error {
+	var errs []error
+	switch {
+	case c.Auth.JWTSecret == "":
+		errs = append(errs, errors.New("auth.jwt_secret: JWT_SECRET is required in production"))
+	case insecureSecrets[c.Auth.JWTSecret] || len(c.Auth.JWTSecret) < minJWTSecretLength:
+		errs = append(errs, fmt.Errorf("auth.jwt_secret: must be a random value of at least %d characters", minJWTSecretLength))
+	}
+	if c.Auth.SeedDemoUsers {
+		errs = append(errs, errors.New("auth.seed_demo_users: demo accounts must not be seeded in production"))
+	}
+	if u, err := url.Parse(c.Database.URL); err == nil && u.User != nil {
+		if pw, ok := u.User.Password(); !ok || pw == "" || insecureSecrets[pw] {
+			errs = append(errs, errors.New("database.url: password is empty or a known default"))
+		}
+	}
+	if c.Baidu.APIKey == "" || c.Baidu.SecretKey == "" {
+		errs = append(errs, errors.New("baidu: BAIDU_API_KEY and BAIDU_SECRET_KEY are required in production"))
+	}
+	if c.DeepSeek.APIKey == "" {
+		errs = append(errs, errors.New("deepseek.api_key: DEEPSEEK_API_KEY is required in production"))
+	}
+	if u, err := url.Parse(c.Server.BaseURL); err != nil || u.Hostname() == "localhost" || u.Hostname() == "127.0.0.1" {
+		errs = append(errs, errors.New("server.base_url: APP_BASE_URL must point to the public site in production"))
+	}
+	return errs
+}
+
+var dsnPassword = regexp.MustCompile(`(password=)\S+`)
+
+// redactURL 隐去连接串中的密码，支持 URL 与 key=value 两种格式
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		return dsnPassword.ReplaceAllString(raw, "${1}xxxxx")
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), "xxxxx")
+	}
+	return u.String()
+}
@@ -0,0 +1,73 @@
+package db
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	file := func(body string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(body)} }
+	tests := []struct {
+		name     string
+		files    fstest.MapFS
+		versions []int64
+		wantErr  string
+	}{
+		{"sorted by version not name", fstest.MapFS{
+			"0010_ten.up.sql":   file("ten"),
+			"0002_two.up.sql":   file("two"),
+			"0002_two.down.sql": file("undo two"),
+			"0001_one.up.sql":   file("one"),
+		}, []int64{1, 2, 10}, ""},
+		{"down only", fstest.MapFS{"0001_one.down.sql": file("x")}, nil, "has no up script"},
+		{"unexpected file", fstest.MapFS{"README.md": file("x")}, nil, "unexpected migration file"},
+		{"missing name", fstest.MapFS{"0001.up.sql": file("x")}, nil, "must be named"},
+		{"bad version", fstest.MapFS{"abc_one.up.sql": file("x")}, nil, "invalid version"},
+		{"conflicting names", fstest.MapFS{
+			"0001_one.up.sql":   file("x"),
+			"0001_uno.down.sql": file("y"),
+		}, nil, "conflicting names"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrations, err := loadMigrations(tt.files)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(migrations) != len(tt.versions) {
+				t.Fatalf("got %d migrations, want %d", len(migrations), len(tt.versions))
+			}
+			for i, v := range tt.versions {
+				if migrations[i].Version != v {
+					t.Fatalf("migrations[%d].Version = %d, want %d", i, migrations[i].Version, v)
+				}
+			}
+			if migrations[1].Name != "two" || migrations[1].Up != "two" || migrations[1].Down != "undo two" {
+				t.Fatalf("migration 2 = %+v", migrations[1])
+			}
+		})
+	}
+}
+
+// 内嵌的迁移版本连续且都能回滚
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := LoadMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, m := range migrations {
+		if m.Version != int64(i+1) {
+			t.Fatalf("migration %d_%s out of sequence, want version %d", m.Version, m.Name, i+1)
+		}
+		if strings.TrimSpace(m.Down) == "" {
+			t.Fatalf("migration %d_%s has no down script", m.Version, m.Name)
+		}
+	}
+}
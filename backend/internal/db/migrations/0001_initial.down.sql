@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS gradings;
+DROP TABLE IF EXISTS users;
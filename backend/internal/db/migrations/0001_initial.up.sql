@@ -0,0 +1,32 @@
+-- 初始表结构；使用 IF NOT EXISTS 以兼容迁移机制引入前已建好的库
+CREATE TABLE IF NOT EXISTS users (
+  username TEXT NOT NULL,
+  role TEXT NOT NULL,
+  password TEXT NOT NULL,
+  name TEXT NOT NULL,
+  email TEXT NOT NULL,
+  student_name TEXT,
+  class TEXT,
+  school TEXT,
+  created_at TIMESTAMPTZ DEFAULT now(),
+  PRIMARY KEY (username, role)
+);
+
+CREATE TABLE IF NOT EXISTS gradings (
+  id TEXT PRIMARY KEY,
+  subject TEXT,
+  paper_image TEXT,
+  answer_image TEXT,
+  description TEXT,
+  status TEXT,
+  score INT DEFAULT 0,
+  ai_score INT DEFAULT 0,
+  total_score INT DEFAULT 100,
+  submit_time TIMESTAMPTZ,
+  created_at TIMESTAMPTZ,
+  complete_time TIMESTAMPTZ,
+  feedback TEXT,
+  ocr_result TEXT,
+  owner_username TEXT,
+  owner_role TEXT
+);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS grading_reviews;
+ALTER TABLE gradings DROP COLUMN IF EXISTS review_note;
+ALTER TABLE gradings DROP COLUMN IF EXISTS reviewed_at;
+ALTER TABLE gradings DROP COLUMN IF EXISTS reviewed_by;
+ALTER TABLE gradings DROP COLUMN IF EXISTS confidence;
@@ -0,0 +1,18 @@
+ALTER TABLE gradings ADD COLUMN IF NOT EXISTS confidence DOUBLE PRECISION NOT NULL DEFAULT 1;
+ALTER TABLE gradings ADD COLUMN IF NOT EXISTS reviewed_by TEXT NOT NULL DEFAULT '';
+ALTER TABLE gradings ADD COLUMN IF NOT EXISTS reviewed_at TIMESTAMPTZ;
+ALTER TABLE gradings ADD COLUMN IF NOT EXISTS review_note TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS grading_reviews (
+  id BIGSERIAL PRIMARY KEY,
+  grading_id TEXT NOT NULL,
+  action TEXT NOT NULL,
+  ai_score INT NOT NULL DEFAULT 0,
+  reviewer_score INT,
+  confidence DOUBLE PRECISION NOT NULL DEFAULT 0,
+  actor_username TEXT NOT NULL DEFAULT '',
+  actor_role TEXT NOT NULL DEFAULT '',
+  note TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_grading_reviews_grading_id ON grading_reviews (grading_id);
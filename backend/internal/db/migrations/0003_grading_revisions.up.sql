@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS grading_revisions (
+  id BIGSERIAL PRIMARY KEY,
+  grading_id TEXT NOT NULL,
+  kind TEXT NOT NULL,
+  score INT NOT NULL,
+  ai_score INT NOT NULL DEFAULT 0,
+  feedback TEXT NOT NULL DEFAULT '',
+  model TEXT NOT NULL DEFAULT '',
+  prompt_version TEXT NOT NULL DEFAULT '',
+  actor_username TEXT NOT NULL DEFAULT '',
+  actor_role TEXT NOT NULL DEFAULT '',
+  reason TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_grading_revisions_grading_id ON grading_revisions (grading_id);
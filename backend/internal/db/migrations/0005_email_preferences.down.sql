@@ -0,0 +1,2 @@
+ALTER TABLE users DROP COLUMN IF EXISTS email_on_failure;
+ALTER TABLE users DROP COLUMN IF EXISTS email_on_complete;
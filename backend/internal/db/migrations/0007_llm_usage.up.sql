@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS llm_usage (
+  id BIGSERIAL PRIMARY KEY,
+  provider TEXT NOT NULL,
+  model TEXT NOT NULL,
+  grading_id TEXT NOT NULL DEFAULT '',
+  task_id TEXT NOT NULL DEFAULT '',
+  owner_username TEXT NOT NULL DEFAULT '',
+  owner_role TEXT NOT NULL DEFAULT '',
+  prompt_tokens INT NOT NULL DEFAULT 0,
+  completion_tokens INT NOT NULL DEFAULT 0,
+  total_tokens INT NOT NULL DEFAULT 0,
+  cache_hit_tokens INT NOT NULL DEFAULT 0,
+  cost NUMERIC(14,6) NOT NULL DEFAULT 0,
+  currency TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_llm_usage_grading_id ON llm_usage (grading_id);
+CREATE INDEX IF NOT EXISTS idx_llm_usage_task_id ON llm_usage (task_id);
+CREATE INDEX IF NOT EXISTS idx_llm_usage_created_at ON llm_usage (created_at);
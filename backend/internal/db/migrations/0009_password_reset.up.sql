@@ -0,0 +1,24 @@
+-- 改密或重置密码时递增，签发令牌时写入，旧版本的令牌随之失效
+ALTER TABLE users ADD COLUMN IF NOT EXISTS session_version INT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS password_resets (
+  id BIGSERIAL PRIMARY KEY,
+  username TEXT NOT NULL,
+  role TEXT NOT NULL,
+  token_hash TEXT NOT NULL UNIQUE,
+  expires_at TIMESTAMPTZ NOT NULL,
+  used_at TIMESTAMPTZ,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_password_resets_account ON password_resets (username, role);
+
+-- 按账号记录的认证事件，用于改密、找回密码等操作的限流
+CREATE TABLE IF NOT EXISTS auth_events (
+  id BIGSERIAL PRIMARY KEY,
+  username TEXT NOT NULL,
+  role TEXT NOT NULL,
+  kind TEXT NOT NULL,
+  ip TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_auth_events_account ON auth_events (username, role, kind, created_at);
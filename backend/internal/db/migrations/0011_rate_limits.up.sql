@@ -0,0 +1,14 @@
+-- 登录失败计数与锁定，key 为 account:<角色>:<用户名> 或 ip:<地址>
+CREATE TABLE IF NOT EXISTS login_throttle (
+  key TEXT PRIMARY KEY,
+  failures INT NOT NULL DEFAULT 0,
+  last_failure_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  locked_until TIMESTAMPTZ
+);
+
+-- 固定窗口限流计数，每个 key 只保留当前窗口一行
+CREATE TABLE IF NOT EXISTS rate_limit_counters (
+  key TEXT PRIMARY KEY,
+  window_start TIMESTAMPTZ NOT NULL,
+  count INT NOT NULL DEFAULT 0
+);
@@ -0,0 +1,2 @@
+ALTER TABLE gradings DROP COLUMN IF EXISTS student_id;
+DROP TABLE IF EXISTS students;
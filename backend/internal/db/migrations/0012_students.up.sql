@@ -0,0 +1,24 @@
+-- 家长名下的孩子，一个家长账号可以有多个
+CREATE TABLE IF NOT EXISTS students (
+  id BIGSERIAL PRIMARY KEY,
+  owner_username TEXT NOT NULL,
+  owner_role TEXT NOT NULL,
+  name TEXT NOT NULL,
+  class TEXT NOT NULL DEFAULT '',
+  school TEXT NOT NULL DEFAULT '',
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS idx_students_owner ON students (owner_username, owner_role);
+
+-- 删除孩子时保留改卷记录，只解除关联
+ALTER TABLE gradings ADD COLUMN IF NOT EXISTS student_id BIGINT REFERENCES students(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS idx_gradings_student ON gradings (student_id, submit_time DESC);
+
+-- 账号上原有的孩子信息转为学生记录，该家长已提交的改卷归到这个孩子名下
+INSERT INTO students (owner_username, owner_role, name, class, school)
+SELECT username, role, student_name, coalesce(class, ''), coalesce(school, '') FROM users
+WHERE role = 'parent' AND student_name <> ''
+  AND NOT EXISTS (SELECT 1 FROM students s WHERE s.owner_username = users.username AND s.owner_role = users.role);
+UPDATE gradings g SET student_id = s.id
+FROM students s
+WHERE g.student_id IS NULL AND g.owner_username = s.owner_username AND g.owner_role = s.owner_role;
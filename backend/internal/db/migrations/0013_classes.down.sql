@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS class_enrollments;
+ALTER TABLE students DROP COLUMN IF EXISTS student_number;
+DROP TABLE IF EXISTS classes;
+DROP TABLE IF EXISTS schools;
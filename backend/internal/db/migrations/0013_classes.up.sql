@@ -0,0 +1,30 @@
+CREATE TABLE IF NOT EXISTS schools (
+  id BIGSERIAL PRIMARY KEY,
+  name TEXT NOT NULL UNIQUE,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- 班级归属于创建它的教师；家长凭 join_code 把孩子加入班级
+CREATE TABLE IF NOT EXISTS classes (
+  id BIGSERIAL PRIMARY KEY,
+  school_id BIGINT NOT NULL REFERENCES schools(id),
+  name TEXT NOT NULL,
+  grade TEXT NOT NULL DEFAULT '',
+  owner_username TEXT NOT NULL,
+  owner_role TEXT NOT NULL,
+  join_code TEXT NOT NULL UNIQUE,
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  UNIQUE (school_id, name)
+);
+CREATE INDEX IF NOT EXISTS idx_classes_owner ON classes (owner_username, owner_role);
+
+-- 教师导入名单时建立的学生还没有家长认领，owner 为空
+ALTER TABLE students ADD COLUMN IF NOT EXISTS student_number TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS class_enrollments (
+  class_id BIGINT NOT NULL REFERENCES classes(id) ON DELETE CASCADE,
+  student_id BIGINT NOT NULL REFERENCES students(id) ON DELETE CASCADE,
+  enrolled_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (class_id, student_id)
+);
+CREATE INDEX IF NOT EXISTS idx_class_enrollments_student ON class_enrollments (student_id);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_webhook_deliveries_due;
+ALTER TABLE webhook_deliveries DROP COLUMN IF EXISTS next_attempt_at;
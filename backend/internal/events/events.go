@@ -0,0 +1,223 @@
+package events
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 改卷流水线阶段
+const (
+	StageUploaded    = "uploaded"
+	StageOCRStarted  = "ocr_started"
+	StageOCRDone     = "ocr_done"
+	StageGrading     = "grading"
+	StageNeedsReview = "needs_review"
+	StageCompleted   = "completed"
+	StageFailed      = "failed"
+	// 外部服务当日额度用完，改卷停止
+	StageQuotaExceeded = "quota_exceeded"
+	// 服务停止时未完成，已排队等待重启后继续处理
+	StageQueued = "queued"
+
+	// 教师任务事件
+	StageProgress  = "progress"
+	StagePaused    = "paused"
+	StageResumed   = "resumed"
+	StageSkipped   = "skipped"
+	StageCancelled = "cancelled"
+)
+
+// Event 是推送给订阅方的一条进度事件
+type Event struct {
+	Type    string                 `json:"type"`
+	ID      string                 `json:"id"`
+	Message string                 `json:"message,omitempty"`
+	Data    map[string]interface{} `json:"data,omitempty"`
+	Time    string                 `json:"time"`
+}
+
+// Terminal 表示该事件之后不会再有新的进度
+func (e Event) Terminal() bool {
+	switch e.Type {
+	case StageCompleted, StageFailed, StageNeedsReview, StageCancelled, StageQuotaExceeded:
+		return true
+	}
+	return false
+}
+
+// Bus 是进程内的发布/订阅，按主题分发事件
+type Bus struct {
+	mu        sync.Mutex
+	topics    map[string]map[*subscription]struct{}
+	listeners []*listener
+}
+
+type subscription struct {
+	ch   chan Event
+	once sync.Once
+}
+
+func (s *subscription) close() {
+	s.once.Do(func() { close(s.ch) })
+}
+
+// listener 按发布顺序在独立协程中执行回调，队列不设上限，事件不会丢弃
+type listener struct {
+	fn    func(topic string, e Event)
+	wake  chan struct{}
+	mu    sync.Mutex
+	queue []topicEvent
+	busy  bool
+}
+
+type topicEvent struct {
+	topic string
+	e     Event
+}
+
+func (l *listener) push(topic string, e Event) {
+	l.mu.Lock()
+	l.queue = append(l.queue, topicEvent{topic, e})
+	l.mu.Unlock()
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (l *listener) run() {
+	for range l.wake {
+		for {
+			l.mu.Lock()
+			if len(l.queue) == 0 {
+				l.busy = false
+				l.mu.Unlock()
+				break
+			}
+			next := l.queue[0]
+			l.queue[0] = topicEvent{}
+			l.queue = l.queue[1:]
+			l.busy = true
+			l.mu.Unlock()
+			l.fn(next.topic, next.e)
+		}
+	}
+}
+
+func (l *listener) idle() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.queue) == 0 && !l.busy
+}
+
+// Default 是流水线与任务管理器共用的事件总线
+var Default = NewBus()
+
+func NewBus() *Bus {
+	return &Bus{topics: make(map[string]map[*subscription]struct{})}
+}
+
+func GradingTopic(id string) string {
+	return "grading:" + id
+}
+
+func TaskTopic(id string) string {
+	return "task:" + id
+}
+
+// Subscribe 订阅主题，返回的 cancel 必须调用以释放订阅。
+// 收到终态事件后通道随即关闭，订阅自动释放
+func (b *Bus) Subscribe(topic string) (<-chan Event, func()) {
+	sub := &subscription{ch: make(chan Event, 32)}
+	b.mu.Lock()
+	if b.topics[topic] == nil {
+		b.topics[topic] = make(map[*subscription]struct{})
+	}
+	b.topics[topic][sub] = struct{}{}
+	b.mu.Unlock()
+
+	return sub.ch, func() {
+		b.mu.Lock()
+		b.unsubscribe(topic, sub)
+		b.mu.Unlock()
+	}
+}
+
+// unsubscribe 需持有 b.mu
+func (b *Bus) unsubscribe(topic string, sub *subscription) {
+	delete(b.topics[topic], sub)
+	if len(b.topics[topic]) == 0 {
+		delete(b.topics, topic)
+	}
+	sub.close()
+}
+
+// Listen 注册接收所有主题事件的回调，回调在该回调专属的协程中按发布顺序执行
+func (b *Bus) Listen(fn func(topic string, e Event)) {
+	l := &listener{fn: fn, wake: make(chan struct{}, 1)}
+	go l.run()
+	b.mu.Lock()
+	b.listeners = append(b.listeners, l)
+	b.mu.Unlock()
+}
+
+// Publish 向主题的所有订阅者投递事件，不阻塞发布方。
+// 订阅者处理过慢时丢弃进度事件；终态事件会挤掉最旧的一条保证送达，随后关闭通道
+func (b *Bus) Publish(topic string, e Event) {
+	if e.Time == "" {
+		e.Time = time.Now().Format(time.RFC3339)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, l := range b.listeners {
+		l.push(topic, e)
+	}
+	for sub := range b.topics[topic] {
+		if !e.Terminal() {
+			select {
+			case sub.ch <- e:
+			default:
+			}
+			continue
+		}
+		// 只有发布方向通道写入，且发布持有 b.mu，腾出一格后写入不会阻塞
+		select {
+		case sub.ch <- e:
+		default:
+			select {
+			case <-sub.ch:
+			default:
+			}
+			sub.ch <- e
+		}
+		b.unsubscribe(topic, sub)
+	}
+}
+
+// Flush 等待所有回调处理完已发布的事件，ctx 到期时返回 false
+func (b *Bus) Flush(ctx context.Context) bool {
+	b.mu.Lock()
+	listeners := append([]*listener(nil), b.listeners...)
+	b.mu.Unlock()
+
+	ticker := time.NewTicker(20 * time.Millisecond)
+	defer ticker.Stop()
+	for _, l := range listeners {
+		for !l.idle() {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// ParseTopic 拆分主题为类型（grading/task）与 ID
+func ParseTopic(topic string) (kind, id string) {
+	kind, id, _ = strings.Cut(topic, ":")
+	return kind, id
+}
@@ -0,0 +1,113 @@
+package events
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPublishDeliversTerminalEventToSlowSubscriber(t *testing.T) {
+	b := NewBus()
+	ch, cancel := b.Subscribe("grading:1")
+	defer cancel()
+
+	// 订阅者不读取，缓冲区被进度事件填满
+	for i := 0; i < 100; i++ {
+		b.Publish("grading:1", Event{Type: StageGrading})
+	}
+	b.Publish("grading:1", Event{Type: StageCompleted})
+
+	var last Event
+	n := 0
+	for e := range ch {
+		last = e
+		n++
+	}
+	if last.Type != StageCompleted {
+		t.Fatalf("last event = %q, want %q", last.Type, StageCompleted)
+	}
+	if n != cap(ch) {
+		t.Fatalf("received %d events, want %d", n, cap(ch))
+	}
+	// 通道已随终态事件关闭，再次取消不能 panic
+	cancel()
+}
+
+func TestPublishClosesOnlyOnTerminal(t *testing.T) {
+	tests := []struct {
+		stage  string
+		closed bool
+	}{
+		{StageOCRStarted, false},
+		{StageProgress, false},
+		{StagePaused, false},
+		{StageCompleted, true},
+		{StageFailed, true},
+		{StageNeedsReview, true},
+		{StageCancelled, true},
+		{StageQuotaExceeded, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.stage, func(t *testing.T) {
+			b := NewBus()
+			ch, cancel := b.Subscribe("task:1")
+			defer cancel()
+			b.Publish("task:1", Event{Type: tt.stage})
+			if e := <-ch; e.Type != tt.stage {
+				t.Fatalf("event = %q, want %q", e.Type, tt.stage)
+			}
+			select {
+			case _, ok := <-ch:
+				if ok || !tt.closed {
+					t.Fatalf("unexpected receive, ok = %v", ok)
+				}
+			default:
+				if tt.closed {
+					t.Fatal("channel still open after terminal event")
+				}
+			}
+		})
+	}
+}
+
+func TestListenRunsOffPublishPathInOrder(t *testing.T) {
+	b := NewBus()
+	release := make(chan struct{})
+	var got []string
+	b.Listen(func(topic string, e Event) {
+		<-release
+		got = append(got, e.Type)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		b.Publish("grading:1", Event{Type: StageUploaded})
+		b.Publish("grading:1", Event{Type: StageGrading})
+		b.Publish("grading:1", Event{Type: StageCompleted})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Publish blocked on a slow listener")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if b.Flush(ctx) {
+		t.Fatal("Flush returned before the listener finished")
+	}
+	close(release)
+	if !b.Flush(context.Background()) {
+		t.Fatal("Flush did not complete")
+	}
+	want := []string{StageUploaded, StageGrading, StageCompleted}
+	if len(got) != len(want) {
+		t.Fatalf("listener got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("listener got %v, want %v", got, want)
+		}
+	}
+}
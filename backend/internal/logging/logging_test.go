@@ -0,0 +1,51 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"baidu url", "https://aip.baidubce.com/ocr?access_token=24.abc.def&x=1", "https://aip.baidubce.com/ocr?access_token=[REDACTED]&x=1"},
+		{"oauth params", "grant_type=client_credentials&client_id=AK123&client_secret=SK456", "grant_type=client_credentials&client_id=[REDACTED]&client_secret=[REDACTED]"},
+		{"json body", `{"access_token":"24.abc","expires_in":2592000}`, `{"access_token":"[REDACTED]","expires_in":2592000}`},
+		{"bearer header", "Authorization: Bearer sk-abcdef", "Authorization: Bearer [REDACTED]"},
+		{"bare key", "invalid key sk-0123456789abcdefXYZ", "invalid key sk-[REDACTED]"},
+		{"case insensitive", "ACCESS_TOKEN=xyz", "ACCESS_TOKEN=[REDACTED]"},
+		{"nothing secret", "grading failed: timeout", "grading failed: timeout"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Redact(tt.in); got != tt.want {
+				t.Fatalf("Redact(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoggerRedactsAttributes(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, slog.LevelInfo, "json")
+	logger.Info("request failed",
+		"password", "hunter2",
+		"Authorization", "Bearer abc",
+		"url", "https://x/?access_token=leak1",
+		"err", errors.New(`Post "https://x/?client_secret=leak2": timeout`),
+		"grading_id", "grading_1",
+	)
+	out := buf.String()
+	for _, leak := range []string{"hunter2", "abc", "leak1", "leak2"} {
+		if strings.Contains(out, leak) {
+			t.Fatalf("log output contains %q: %s", leak, out)
+		}
+	}
+	if !strings.Contains(out, `"grading_id":"grading_1"`) {
+		t.Fatalf("log output lost a plain attribute: %s", out)
+	}
+}
@@ -0,0 +1,101 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"time"
+)
+
+const namespace = "autograd"
+
+// HTTP 请求，route 使用路由模板（如 /api/grading/:id）避免标签基数过高
+var (
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP 请求数",
+	}, []string{"method", "route", "status"})
+
+	HTTPDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP 请求耗时",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+)
+
+// 改卷流水线各阶段，stage 取值 read / ocr / llm
+var (
+	StageDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "grading_stage_duration_seconds",
+		Help:      "改卷流水线各阶段耗时",
+		Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 20, 30, 60, 120},
+	}, []string{"stage", "result"})
+
+	GradingsFinished = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "grading_pipelines_total",
+		Help:      "结束的改卷流水线数，按最终状态",
+	}, []string{"status"})
+
+	QueueDepth = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "provider_queue_depth",
+		Help:      "等待外部服务调用名额的请求数",
+	}, []string{"provider"})
+
+	ProviderInflight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "provider_inflight_requests",
+		Help:      "正在进行的外部服务调用数",
+	}, []string{"provider"})
+
+	ProviderErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "provider_errors_total",
+		Help:      "外部服务调用失败次数，code 为服务商错误码、http_<状态码> 或错误类别",
+	}, []string{"provider", "code"})
+)
+
+// 被限流拒绝的请求，limiter 取值 login（登录锁定）/ submit（提交改卷）
+var RateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "rate_limited_total",
+	Help:      "被登录锁定或提交限流拒绝的请求数",
+}, []string{"limiter"})
+
+// 批量自动改卷任务（AutomationService）
+var (
+	AutomationTasks = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "automation_tasks_total",
+		Help:      "自动改卷任务数，按事件（started / completed / cancelled）",
+	}, []string{"event"})
+
+	AutomationRunning = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "automation_tasks_running",
+		Help:      "执行中（含暂停）的自动改卷任务数",
+	})
+
+	AutomationPapers = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "automation_papers_total",
+		Help:      "自动改卷任务处理的试卷数，按结果（completed / failed / skipped）",
+	}, []string{"result"})
+)
+
+// ObserveStage 记录流水线某阶段从 start 到现在的耗时
+func ObserveStage(stage string, start time.Time, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	StageDuration.WithLabelValues(stage, result).Observe(time.Since(start).Seconds())
+}
+
+// RegisterGaugeFunc 注册一个在抓取时取值的指标，用于由其他模块持有的状态
+func RegisterGaugeFunc(name, help string, fn func() float64) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{Namespace: namespace, Name: name, Help: help}, fn)
+}
@@ -2,11 +2,13 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -38,11 +40,7 @@ type DeepSeekResponse struct {
 		} `json:"message"`
 		FinishReason string `json:"finish_reason"`
 	} `json:"choices"`
-	Usage struct {
-		PromptTokens     int `json:"prompt_tokens"`
-		CompletionTokens int `json:"completion_tokens"`
-		TotalTokens      int `json:"total_tokens"`
-	} `json:"usage"`
+	Usage TokenUsage `json:"usage"`
 	Error *struct {
 		Message string `json:"message"`
 		Type    string `json:"type"`
@@ -56,16 +54,27 @@ type GradingResult struct {
 	WrongQuestions []string `json:"wrongQuestions"`
 	CorrectAnswers []string `json:"correctAnswers"`
 	Feedback       string   `json:"feedback"`
+	// 以下由接口响应填充，不从模型输出中解析
+	Model string     `json:"-"`
+	Usage TokenUsage `json:"-"`
 }
 
-func NewDeepSeekService(apiKey string) *DeepSeekService {
+// NewDeepSeekService baseURL 为空时使用官方地址
+func NewDeepSeekService(apiKey, baseURL string) *DeepSeekService {
+	if baseURL == "" {
+		baseURL = "https://api.deepseek.com"
+	}
 	return &DeepSeekService{
 		apiKey:  apiKey,
-		baseURL: "https://api.deepseek.com",
+		baseURL: strings.TrimRight(baseURL, "/"),
 	}
 }
 
-func (s *DeepSeekService) GradePaper(ocrText, referenceAnswer string) (*GradingResult, error) {
+func (s *DeepSeekService) Configured() bool {
+	return s.apiKey != ""
+}
+
+func (s *DeepSeekService) GradePaper(ctx context.Context, ocrText, referenceAnswer string) (*GradingResult, error) {
 	if s.apiKey == "" {
 		return nil, errors.New("DeepSeek API key not configured")
 	}
@@ -73,7 +82,7 @@ func (s *DeepSeekService) GradePaper(ocrText, referenceAnswer string) (*GradingR
 	prompt := s.buildGradingPrompt(ocrText, referenceAnswer)
 
 	request := DeepSeekRequest{
-		Model: "deepseek-chat",
+		Model: DeepSeekChatModel,
 		Messages: []struct {
 			Role    string `json:"role"`
 			Content string `json:"content"`
@@ -90,7 +99,7 @@ func (s *DeepSeekService) GradePaper(ocrText, referenceAnswer string) (*GradingR
 	}
 
 	url := s.baseURL + "/chat/completions"
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -123,7 +132,13 @@ func (s *DeepSeekService) GradePaper(ocrText, referenceAnswer string) (*GradingR
 		return nil, fmt.Errorf("no response from DeepSeek API")
 	}
 
-	return s.parseGradingResult(response.Choices[0].Message.Content)
+	result, err := s.parseGradingResult(response.Choices[0].Message.Content)
+	if err != nil {
+		return nil, err
+	}
+	result.Model = response.Model
+	result.Usage = response.Usage
+	return result, nil
 }
 
 func (s *DeepSeekService) buildGradingPrompt(ocrText, referenceAnswer string) string {
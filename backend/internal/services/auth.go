@@ -10,6 +10,7 @@ import (
 
 type AuthService struct {
 	jwtSecret []byte
+	accessTTL time.Duration
 }
 
 type Claims struct {
@@ -17,15 +18,26 @@ type Claims struct {
 	OpenID   string `json:"openId"`
 	Role     string `json:"role"`
 	UserRole string `json:"userRole"`
+	// 账号的会话版本，与库中不一致的令牌视为已失效
+	Version int `json:"ver,omitempty"`
+	// 令牌所属的登录会话，会话被撤销后令牌立即失效
+	SessionID string `json:"sid,omitempty"`
 	jwt.StandardClaims
 }
 
-func NewAuthService(jwtSecret string) *AuthService {
+// NewAuthService 创建令牌服务，accessTTL 为访问令牌的有效期
+func NewAuthService(jwtSecret string, accessTTL time.Duration) *AuthService {
 	return &AuthService{
 		jwtSecret: []byte(jwtSecret),
+		accessTTL: accessTTL,
 	}
 }
 
+// AccessTTL 返回访问令牌的有效期
+func (s *AuthService) AccessTTL() time.Duration {
+	return s.accessTTL
+}
+
 func (s *AuthService) HashPassword(password string) (string, error) {
 	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	return string(bytes), err
@@ -43,7 +55,7 @@ func (s *AuthService) GenerateToken(user *models.User) (string, error) {
 		Role:     user.Role,
 		UserRole: "",
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(24 * time.Hour).Unix(),
+			ExpiresAt: time.Now().Add(s.accessTTL).Unix(),
 		},
 	}
 
@@ -55,8 +67,28 @@ func (s *AuthService) GenerateToken(user *models.User) (string, error) {
 	return token.SignedString(s.jwtSecret)
 }
 
+// GenerateUserToken 为 users 表中的账号签发会话 sessionID 下的访问令牌，OpenID 为用户名
+func (s *AuthService) GenerateUserToken(username, role string, version int, sessionID string) (string, error) {
+	claims := &Claims{
+		OpenID:    username,
+		Role:      role,
+		UserRole:  role,
+		Version:   version,
+		SessionID: sessionID,
+		StandardClaims: jwt.StandardClaims{
+			IssuedAt:  time.Now().Unix(),
+			ExpiresAt: time.Now().Add(s.accessTTL).Unix(),
+		},
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(s.jwtSecret)
+}
+
 func (s *AuthService) ValidateToken(tokenString string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
 		return s.jwtSecret, nil
 	})
 
@@ -1,14 +1,88 @@
 package services
 
 import (
+	"auto-grad-backend/internal/events"
+	"auto-grad-backend/internal/metrics"
+	"errors"
 	"fmt"
+	"log/slog"
 	"sync"
 	"time"
 )
 
+var (
+	ErrTaskNotFound   = errors.New("task not found")
+	ErrTaskNotRunning = errors.New("task is not running")
+	ErrTaskNotPaused  = errors.New("task is not paused")
+	ErrTaskRunning    = errors.New("task is already running")
+)
+
 type AutomationService struct {
 	taskManager *TaskManager
+	controls    map[string]*taskControl
 	mutex       sync.RWMutex
+	gradePaper  PaperGrader
+	onUsage     UsageRecorder
+}
+
+// PaperResult 是任务批改一张试卷的结果；调用了大模型时 Provider、Model 与 Usage 记录本次用量
+type PaperResult struct {
+	Score    float64
+	Provider string
+	Model    string
+	Usage    TokenUsage
+}
+
+// PaperGrader 批改任务中的第 paper 张试卷
+type PaperGrader func(taskID string, paper int) (PaperResult, error)
+
+// UsageRecorder 在批改试卷产生大模型用量后调用，用于把费用计入任务
+type UsageRecorder func(taskID string, result PaperResult)
+
+// taskControl 是工作协程与控制命令之间的协作状态，工作协程在两张试卷之间检查它
+type taskControl struct {
+	mu        sync.Mutex
+	cond      *sync.Cond
+	paused    bool
+	cancelled bool
+	skip      int
+}
+
+func newTaskControl() *taskControl {
+	ctl := &taskControl{}
+	ctl.cond = sync.NewCond(&ctl.mu)
+	return ctl
+}
+
+// checkpoint 在暂停期间阻塞；返回是否继续执行以及是否跳过下一张试卷
+func (c *taskControl) checkpoint() (proceed bool, skip bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.paused && !c.cancelled {
+		c.cond.Wait()
+	}
+	if c.cancelled {
+		return false, false
+	}
+	if c.skip > 0 {
+		c.skip--
+		return true, true
+	}
+	return true, false
+}
+
+// stopped 报告任务是否已取消；取消后重新执行会换用新的 taskControl，旧协程据此停止写入进度
+func (c *taskControl) stopped() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.cancelled
+}
+
+func (c *taskControl) set(fn func(*taskControl)) {
+	c.mu.Lock()
+	fn(c)
+	c.mu.Unlock()
+	c.cond.Broadcast()
 }
 
 type TaskManager struct {
@@ -22,6 +96,7 @@ type TaskStatus struct {
 	TotalPapers     int       `json:"totalPapers"`
 	CompletedPapers int       `json:"completedPapers"`
 	FailedPapers    int       `json:"failedPapers"`
+	SkippedPapers   int       `json:"skippedPapers"`
 	AverageScore    float64   `json:"averageScore"`
 	CurrentPaper    int       `json:"currentPaper"`
 	Message         string    `json:"message"`
@@ -33,9 +108,16 @@ type TaskStatus struct {
 func NewAutomationService() *AutomationService {
 	return &AutomationService{
 		taskManager: NewTaskManager(),
+		controls:    make(map[string]*taskControl),
+		gradePaper:  simulatePaper,
 	}
 }
 
+// SetUsageRecorder 设置用量回调，应在执行任务之前调用
+func (s *AutomationService) SetUsageRecorder(fn UsageRecorder) {
+	s.onUsage = fn
+}
+
 // 创建新的任务管理器
 func NewTaskManager() *TaskManager {
 	return &TaskManager{
@@ -43,11 +125,15 @@ func NewTaskManager() *TaskManager {
 	}
 }
 
-// 开始执行任务
+// 开始执行任务；任务执行中或已暂停时返回 ErrTaskRunning，原工作协程仍在等待同一个 taskControl
 func (s *AutomationService) StartTask(taskID string, totalPapers int, targetURL, account, password string) error {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
+	if status, ok := s.taskManager.GetTask(taskID); ok && (status.Status == "running" || status.Status == "paused") {
+		return ErrTaskRunning
+	}
+
 	// 创建任务状态
 	status := &TaskStatus{
 		TaskID:          taskID,
@@ -63,46 +149,145 @@ func (s *AutomationService) StartTask(taskID string, totalPapers int, targetURL,
 	}
 
 	s.taskManager.tasks[taskID] = status
+	s.taskManager.publish(status, events.StageProgress)
+	metrics.AutomationTasks.WithLabelValues("started").Inc()
+	metrics.AutomationRunning.Inc()
+
+	ctl := newTaskControl()
+	s.controls[taskID] = ctl
+
+	slog.Info("automation task started", "task_id", taskID, "total_papers", totalPapers)
 
 	// 启动模拟执行
-	go s.simulateTaskExecution(taskID, totalPapers)
+	go s.simulateTaskExecution(taskID, totalPapers, ctl)
 
 	return nil
 }
 
 // 模拟任务执行
-func (s *AutomationService) simulateTaskExecution(taskID string, totalPapers int) {
+func (s *AutomationService) simulateTaskExecution(taskID string, totalPapers int, ctl *taskControl) {
+	logger := slog.With("task_id", taskID)
 	for i := 1; i <= totalPapers; i++ {
+		// 暂停时在此等待，取消时退出
+		proceed, skip := ctl.checkpoint()
+		if !proceed {
+			break
+		}
+
 		// 检查任务是否还存在
 		status, exists := s.taskManager.GetTask(taskID)
 		if !exists || status.Status == "cancelled" {
 			break
 		}
 
-		// 模拟处理一张试卷
-		time.Sleep(2 * time.Second) // 模拟处理时间
+		if skip {
+			logger.Info("paper skipped", "paper", i)
+			s.taskManager.SkipPaper(taskID, i)
+			continue
+		}
+
+		result, err := s.gradePaper(taskID, i)
+		// 任务在批改期间被取消时用量也已产生，先记账再退出
+		if result.Usage.TotalTokens > 0 && s.onUsage != nil {
+			s.onUsage(taskID, result)
+		}
+		if ctl.stopped() {
+			break
+		}
 
 		// 更新进度
-		score := 60 + (i % 40) // 模拟分数 60-99
-		s.taskManager.UpdateProgress(taskID, i, score >= 60, float64(score))
+		if err != nil {
+			logger.Warn("paper failed", "paper", i, "err", err)
+		} else {
+			logger.Debug("paper graded", "paper", i, "score", result.Score)
+		}
+		s.taskManager.UpdateProgress(taskID, i, err == nil, result.Score)
 
 		// 每10张试卷更新一次状态
 		if i%10 == 0 || i == totalPapers {
-			message := fmt.Sprintf("已处理 %d/%d 张试卷，平均分: %.1f", i, totalPapers, status.AverageScore)
-			s.taskManager.UpdateMessage(taskID, message)
+			if status, ok := s.taskManager.GetTask(taskID); ok {
+				message := fmt.Sprintf("已处理 %d/%d 张试卷，平均分: %.1f", i, totalPapers, status.AverageScore)
+				s.taskManager.UpdateMessage(taskID, message)
+			}
 		}
 	}
 
+	if ctl.stopped() {
+		logger.Info("automation task stopped")
+		return
+	}
 	// 任务完成
 	s.taskManager.CompleteTask(taskID)
+	if status, ok := s.taskManager.GetTask(taskID); ok {
+		logger.Info("automation task finished", "status", status.Status, "completed", status.CompletedPapers, "failed", status.FailedPapers, "skipped", status.SkippedPapers)
+	}
+}
+
+// simulatePaper 模拟处理一张试卷，不调用大模型
+func simulatePaper(taskID string, paper int) (PaperResult, error) {
+	time.Sleep(2 * time.Second)
+	// 模拟分数 60-99
+	return PaperResult{Score: float64(60 + paper%40)}, nil
 }
 
 // 停止任务
 func (s *AutomationService) StopTask(taskID string) error {
+	if ctl := s.control(taskID); ctl != nil {
+		ctl.set(func(c *taskControl) { c.cancelled = true })
+	}
 	s.taskManager.CancelTask(taskID)
 	return nil
 }
 
+// 暂停任务，当前试卷处理完后生效
+func (s *AutomationService) PauseTask(taskID string) error {
+	ctl := s.control(taskID)
+	if ctl == nil {
+		return ErrTaskNotFound
+	}
+	if err := s.taskManager.setPaused(taskID, true); err != nil {
+		return err
+	}
+	ctl.set(func(c *taskControl) { c.paused = true })
+	return nil
+}
+
+// 恢复已暂停的任务
+func (s *AutomationService) ResumeTask(taskID string) error {
+	ctl := s.control(taskID)
+	if ctl == nil {
+		return ErrTaskNotFound
+	}
+	if err := s.taskManager.setPaused(taskID, false); err != nil {
+		return err
+	}
+	ctl.set(func(c *taskControl) { c.paused = false })
+	return nil
+}
+
+// 跳过下一张待处理的试卷
+func (s *AutomationService) SkipPaper(taskID string) error {
+	ctl := s.control(taskID)
+	if ctl == nil {
+		return ErrTaskNotFound
+	}
+	status, ok := s.taskManager.GetTask(taskID)
+	if !ok {
+		return ErrTaskNotFound
+	}
+	if status.Status != "running" && status.Status != "paused" {
+		return ErrTaskNotRunning
+	}
+	ctl.set(func(c *taskControl) { c.skip++ })
+	return nil
+}
+
+func (s *AutomationService) control(taskID string) *taskControl {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.controls[taskID]
+}
+
 // 获取任务状态
 func (s *AutomationService) GetTaskStatus(taskID string) (*TaskStatus, bool) {
 	return s.taskManager.GetTask(taskID)
@@ -114,12 +299,17 @@ func (s *AutomationService) GetAllTasks() map[string]*TaskStatus {
 }
 
 // TaskManager 方法
+// GetTask 返回任务状态的副本，与 GetAllTasks 一致，调用方读取时无需持有锁
 func (tm *TaskManager) GetTask(taskID string) (*TaskStatus, bool) {
 	tm.mutex.RLock()
 	defer tm.mutex.RUnlock()
 
 	task, exists := tm.tasks[taskID]
-	return task, exists
+	if !exists {
+		return nil, false
+	}
+	taskCopy := *task
+	return &taskCopy, true
 }
 
 func (tm *TaskManager) UpdateProgress(taskID string, paperNum int, success bool, score float64) {
@@ -127,13 +317,17 @@ func (tm *TaskManager) UpdateProgress(taskID string, paperNum int, success bool,
 	defer tm.mutex.Unlock()
 
 	if task, exists := tm.tasks[taskID]; exists {
+		defer tm.publish(task, events.StageProgress)
+
 		task.CurrentPaper = paperNum
 		task.LastUpdateTime = time.Now()
 
 		if success {
 			task.CompletedPapers++
+			metrics.AutomationPapers.WithLabelValues("completed").Inc()
 		} else {
 			task.FailedPapers++
+			metrics.AutomationPapers.WithLabelValues("failed").Inc()
 		}
 
 		// 计算平均分
@@ -144,6 +338,49 @@ func (tm *TaskManager) UpdateProgress(taskID string, paperNum int, success bool,
 	}
 }
 
+func (tm *TaskManager) SkipPaper(taskID string, paperNum int) {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+
+	if task, exists := tm.tasks[taskID]; exists {
+		task.CurrentPaper = paperNum
+		task.SkippedPapers++
+		metrics.AutomationPapers.WithLabelValues("skipped").Inc()
+		task.Message = fmt.Sprintf("已跳过第 %d 张试卷", paperNum)
+		task.LastUpdateTime = time.Now()
+		tm.publish(task, events.StageSkipped)
+	}
+}
+
+// setPaused 切换任务的暂停状态，仅允许 running <-> paused
+func (tm *TaskManager) setPaused(taskID string, paused bool) error {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+
+	task, exists := tm.tasks[taskID]
+	if !exists {
+		return ErrTaskNotFound
+	}
+	if paused {
+		if task.Status != "running" {
+			return ErrTaskNotRunning
+		}
+		task.Status = "paused"
+		task.Message = "任务已暂停"
+		task.LastUpdateTime = time.Now()
+		tm.publish(task, events.StagePaused)
+		return nil
+	}
+	if task.Status != "paused" {
+		return ErrTaskNotPaused
+	}
+	task.Status = "running"
+	task.Message = "任务已恢复"
+	task.LastUpdateTime = time.Now()
+	tm.publish(task, events.StageResumed)
+	return nil
+}
+
 func (tm *TaskManager) UpdateMessage(taskID string, message string) {
 	tm.mutex.Lock()
 	defer tm.mutex.Unlock()
@@ -158,10 +395,22 @@ func (tm *TaskManager) CompleteTask(taskID string) {
 	tm.mutex.Lock()
 	defer tm.mutex.Unlock()
 
-	if task, exists := tm.tasks[taskID]; exists {
+	// 已取消的任务保持取消状态
+	if task, exists := tm.tasks[taskID]; exists && task.Status != "cancelled" {
+		task.LastUpdateTime = time.Now()
+		metrics.AutomationRunning.Dec()
+		// 处理过试卷但全部失败时任务记为失败
+		if task.FailedPapers > 0 && task.CompletedPapers == 0 {
+			task.Status = "failed"
+			task.Message = fmt.Sprintf("任务执行失败，%d 张试卷全部处理失败", task.FailedPapers)
+			tm.publish(task, events.StageFailed)
+			metrics.AutomationTasks.WithLabelValues("failed").Inc()
+			return
+		}
 		task.Status = "completed"
 		task.Message = "任务执行完成"
-		task.LastUpdateTime = time.Now()
+		tm.publish(task, events.StageCompleted)
+		metrics.AutomationTasks.WithLabelValues("completed").Inc()
 	}
 }
 
@@ -170,9 +419,15 @@ func (tm *TaskManager) CancelTask(taskID string) {
 	defer tm.mutex.Unlock()
 
 	if task, exists := tm.tasks[taskID]; exists {
+		// 只统计从执行中取消的任务，重复取消或取消已完成的任务不重复计数
+		if task.Status == "running" || task.Status == "paused" {
+			metrics.AutomationTasks.WithLabelValues("cancelled").Inc()
+			metrics.AutomationRunning.Dec()
+		}
 		task.Status = "cancelled"
 		task.Message = "任务已取消"
 		task.LastUpdateTime = time.Now()
+		tm.publish(task, events.StageCancelled)
 	}
 }
 
@@ -188,3 +443,25 @@ func (tm *TaskManager) GetAllTasks() map[string]*TaskStatus {
 	}
 	return result
 }
+
+// publish 推送任务当前进度，调用方需持有锁
+func (tm *TaskManager) publish(task *TaskStatus, stage string) {
+	events.Default.Publish(events.TaskTopic(task.TaskID), events.Event{
+		Type:    stage,
+		ID:      task.TaskID,
+		Message: task.Message,
+		Data:    task.progressData(),
+	})
+}
+
+func (t *TaskStatus) progressData() map[string]interface{} {
+	return map[string]interface{}{
+		"status":          t.Status,
+		"totalPapers":     t.TotalPapers,
+		"completedPapers": t.CompletedPapers,
+		"failedPapers":    t.FailedPapers,
+		"skippedPapers":   t.SkippedPapers,
+		"currentPaper":    t.CurrentPaper,
+		"averageScore":    t.AverageScore,
+	}
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"auto-grad-backend/internal/events"
+	"errors"
+	"testing"
+)
+
+func TestStartTaskRejectsActiveTask(t *testing.T) {
+	s := NewAutomationService()
+	if err := s.StartTask("t1", 1, "", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	defer s.StopTask("t1")
+
+	if err := s.StartTask("t1", 1, "", "", ""); !errors.Is(err, ErrTaskRunning) {
+		t.Fatalf("start running task: err = %v, want ErrTaskRunning", err)
+	}
+	if err := s.PauseTask("t1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.StartTask("t1", 1, "", "", ""); !errors.Is(err, ErrTaskRunning) {
+		t.Fatalf("start paused task: err = %v, want ErrTaskRunning", err)
+	}
+
+	// 取消后可以重新执行
+	if err := s.StopTask("t1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.StartTask("t1", 1, "", "", ""); err != nil {
+		t.Fatalf("restart cancelled task: %v", err)
+	}
+}
+
+func TestGetTaskReturnsCopy(t *testing.T) {
+	tm := NewTaskManager()
+	tm.tasks["t1"] = &TaskStatus{TaskID: "t1", Status: "running"}
+
+	got, ok := tm.GetTask("t1")
+	if !ok {
+		t.Fatal("task not found")
+	}
+	got.Status = "changed"
+	tm.UpdateProgress("t1", 1, true, 80)
+
+	again, _ := tm.GetTask("t1")
+	if again.Status != "running" || again.AverageScore != 80 {
+		t.Fatalf("task = %+v, want running with average 80", again)
+	}
+	if got.AverageScore != 0 {
+		t.Fatal("copy was updated by UpdateProgress")
+	}
+	if _, ok := tm.GetTask("missing"); ok {
+		t.Fatal("missing task found")
+	}
+}
+
+func TestCompleteTaskStatus(t *testing.T) {
+	tests := []struct {
+		name      string
+		completed int
+		failed    int
+		want      string
+		stage     string
+	}{
+		{"all succeeded", 3, 0, "completed", events.StageCompleted},
+		{"some failed", 2, 1, "completed", events.StageCompleted},
+		{"all failed", 0, 3, "failed", events.StageFailed},
+		{"nothing processed", 0, 0, "completed", events.StageCompleted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tm := NewTaskManager()
+			tm.tasks["t1"] = &TaskStatus{TaskID: "t1", Status: "running", CompletedPapers: tt.completed, FailedPapers: tt.failed}
+			ch, cancel := events.Default.Subscribe(events.TaskTopic("t1"))
+			defer cancel()
+
+			tm.CompleteTask("t1")
+			if got, _ := tm.GetTask("t1"); got.Status != tt.want {
+				t.Fatalf("status = %q, want %q", got.Status, tt.want)
+			}
+			if e := <-ch; e.Type != tt.stage {
+				t.Fatalf("event = %q, want %q", e.Type, tt.stage)
+			}
+		})
+	}
+}
+
+func TestTaskUsageRecorded(t *testing.T) {
+	tests := []struct {
+		name   string
+		result PaperResult
+		err    error
+		want   int
+	}{
+		{"model call", PaperResult{Score: 80, Provider: "deepseek", Model: "deepseek-chat", Usage: TokenUsage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15}}, nil, 2},
+		{"failed after model call", PaperResult{Model: "deepseek-chat", Usage: TokenUsage{TotalTokens: 15}}, errors.New("parse failed"), 2},
+		{"no model call", PaperResult{Score: 80}, nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewAutomationService()
+			s.gradePaper = func(string, int) (PaperResult, error) { return tt.result, tt.err }
+			var got []PaperResult
+			s.SetUsageRecorder(func(taskID string, result PaperResult) {
+				if taskID != "t1" {
+					t.Errorf("usage recorded for %q, want t1", taskID)
+				}
+				got = append(got, result)
+			})
+			ch, cancel := events.Default.Subscribe(events.TaskTopic("t1"))
+			defer cancel()
+			if err := s.StartTask("t1", 2, "", "", ""); err != nil {
+				t.Fatal(err)
+			}
+			for e := range ch {
+				if e.Type == events.StageCompleted || e.Type == events.StageFailed {
+					break
+				}
+			}
+			if len(got) != tt.want {
+				t.Fatalf("recorded %d usages, want %d", len(got), tt.want)
+			}
+			for _, r := range got {
+				if r.Usage != tt.result.Usage || r.Model != tt.result.Model {
+					t.Fatalf("recorded %+v, want %+v", r, tt.result)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	baiduTokenURL = "https://aip.baidubce.com/oauth/2.0/token"
+	// token 提前过期的时间，避免请求途中恰好过期
+	baiduTokenEarlyExpiry = 5 * time.Minute
+	// 刷新请求独立于调用方的 context，单个调用方取消不会影响其他等待者
+	baiduTokenFetchTimeout = 15 * time.Second
+)
+
+// 百度返回这些错误码时说明 access_token 无效或已过期，需要重新获取
+const (
+	BaiduErrTokenInvalid = 110
+	BaiduErrTokenExpired = 111
+)
+
+var ErrBaiduNotConfigured = errors.New("Baidu OCR credentials not configured")
+
+// IsBaiduTokenError 判断 OCR 接口的错误码是否由 token 失效引起
+func IsBaiduTokenError(code int) bool {
+	return code == BaiduErrTokenInvalid || code == BaiduErrTokenExpired
+}
+
+// BaiduTokenCache 在所有改卷流水线间共享百度 access_token：
+// 并发请求只触发一次刷新（single-flight），到期前提前刷新，遇到鉴权错误时可主动作废
+type BaiduTokenCache struct {
+	apiKey    string
+	secretKey string
+	tokenURL  string
+	client    *http.Client
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+	// 非 nil 表示有刷新正在进行，刷新结束时关闭
+	inflight chan struct{}
+	lastErr  error
+}
+
+func NewBaiduTokenCache(apiKey, secretKey string) *BaiduTokenCache {
+	return &BaiduTokenCache{
+		apiKey:    apiKey,
+		secretKey: secretKey,
+		tokenURL:  baiduTokenURL,
+		client:    &http.Client{Timeout: baiduTokenFetchTimeout},
+	}
+}
+
+func (c *BaiduTokenCache) Configured() bool {
+	return c != nil && c.apiKey != "" && c.secretKey != ""
+}
+
+// Token 返回有效的 access_token，必要时等待（或发起）一次刷新
+func (c *BaiduTokenCache) Token(ctx context.Context) (string, error) {
+	if !c.Configured() {
+		return "", ErrBaiduNotConfigured
+	}
+	for {
+		c.mu.Lock()
+		if c.token != "" && time.Now().Before(c.expires) {
+			token := c.token
+			c.mu.Unlock()
+			return token, nil
+		}
+		wait := c.inflight
+		if wait == nil {
+			wait = make(chan struct{})
+			c.inflight = wait
+			go c.refresh(wait)
+		}
+		c.mu.Unlock()
+
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+
+		c.mu.Lock()
+		token, err := c.token, c.lastErr
+		c.mu.Unlock()
+		if err != nil {
+			return "", err
+		}
+		// 刷新成功后又被作废时重新取
+		if token != "" {
+			return token, nil
+		}
+	}
+}
+
+// Invalidate 作废指定 token；只在缓存中仍是该 token 时生效，避免把别人刚刷新的新 token 清掉
+func (c *BaiduTokenCache) Invalidate(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.token == token {
+		c.token = ""
+		c.expires = time.Time{}
+	}
+}
+
+func (c *BaiduTokenCache) refresh(done chan struct{}) {
+	ctx, cancel := context.WithTimeout(context.Background(), baiduTokenFetchTimeout)
+	defer cancel()
+	token, ttl, err := c.fetch(ctx)
+
+	c.mu.Lock()
+	c.lastErr = err
+	if err == nil {
+		c.token = token
+		lifetime := ttl - baiduTokenEarlyExpiry
+		if lifetime < ttl/2 {
+			// 有效期异常短时至少缓存一半时间
+			lifetime = ttl / 2
+		}
+		c.expires = time.Now().Add(lifetime)
+	}
+	c.inflight = nil
+	c.mu.Unlock()
+	close(done)
+}
+
+func (c *BaiduTokenCache) fetch(ctx context.Context) (string, time.Duration, error) {
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	form.Set("client_id", c.apiKey)
+	form.Set("client_secret", c.secretKey)
+	req, err := http.NewRequestWithContext(ctx, "POST", c.tokenURL+"?"+form.Encode(), nil)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to get access token: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to read token response: %w", err)
+	}
+
+	var tokenResp struct {
+		AccessToken      string `json:"access_token"`
+		ExpiresIn        int    `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.Unmarshal(body, &tokenResp); err != nil {
+		return "", 0, fmt.Errorf("failed to parse token response: %w", err)
+	}
+	if tokenResp.AccessToken == "" {
+		return "", 0, fmt.Errorf("failed to get access token: %s %s", tokenResp.Error, tokenResp.ErrorDescription)
+	}
+	return tokenResp.AccessToken, time.Duration(tokenResp.ExpiresIn) * time.Second, nil
+}
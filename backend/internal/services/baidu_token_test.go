@@ -0,0 +1,132 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// tokenServer 每次请求返回 token-N；release 非 nil 时请求阻塞到其关闭
+func tokenServer(t *testing.T, release <-chan struct{}) (*BaiduTokenCache, *atomic.Int32) {
+	t.Helper()
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := hits.Add(1)
+		if release != nil {
+			<-release
+		}
+		fmt.Fprintf(w, `{"access_token":"token-%d","expires_in":2592000}`, n)
+	}))
+	t.Cleanup(srv.Close)
+	c := NewBaiduTokenCache("ak", "sk")
+	c.tokenURL = srv.URL
+	return c, &hits
+}
+
+func TestBaiduTokenCacheSingleFlight(t *testing.T) {
+	release := make(chan struct{})
+	c, hits := tokenServer(t, release)
+
+	const callers = 20
+	var wg sync.WaitGroup
+	tokens := make([]string, callers)
+	errs := make([]error, callers)
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			tokens[i], errs[i] = c.Token(context.Background())
+		}(i)
+	}
+	// 等所有调用方都进入等待后再放行刷新请求
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	for i := range tokens {
+		if errs[i] != nil || tokens[i] != "token-1" {
+			t.Fatalf("caller %d: token = %q, err = %v", i, tokens[i], errs[i])
+		}
+	}
+	if n := hits.Load(); n != 1 {
+		t.Fatalf("token endpoint called %d times, want 1", n)
+	}
+}
+
+func TestBaiduTokenCacheInvalidate(t *testing.T) {
+	tests := []struct {
+		name       string
+		invalidate string
+		wantToken  string
+		wantHits   int32
+	}{
+		{"cached", "", "token-1", 1},
+		{"stale token ignored", "token-0", "token-1", 1},
+		{"current token refreshed", "token-1", "token-2", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, hits := tokenServer(t, nil)
+			if _, err := c.Token(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if tt.invalidate != "" {
+				c.Invalidate(tt.invalidate)
+			}
+			got, err := c.Token(context.Background())
+			if err != nil || got != tt.wantToken || hits.Load() != tt.wantHits {
+				t.Fatalf("token = %q, err = %v, hits = %d; want %q, %d", got, err, hits.Load(), tt.wantToken, tt.wantHits)
+			}
+		})
+	}
+}
+
+func TestBaiduTokenCacheErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantErr string
+	}{
+		{"rejected credentials", `{"error":"invalid_client","error_description":"unknown client id"}`, "invalid_client unknown client id"},
+		{"malformed response", `not json`, "failed to parse token response"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, tt.body)
+			}))
+			defer srv.Close()
+			c := NewBaiduTokenCache("ak", "sk")
+			c.tokenURL = srv.URL
+			if _, err := c.Token(context.Background()); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := NewBaiduTokenCache("", "").Token(context.Background()); !errors.Is(err, ErrBaiduNotConfigured) {
+		t.Fatalf("unconfigured: err = %v", err)
+	}
+}
+
+// 等待刷新的调用方取消时立即返回，不影响刷新本身
+func TestBaiduTokenCacheCallerCancel(t *testing.T) {
+	release := make(chan struct{})
+	c, _ := tokenServer(t, release)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := c.Token(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want DeadlineExceeded", err)
+	}
+	close(release)
+	if got, err := c.Token(context.Background()); err != nil || got != "token-1" {
+		t.Fatalf("token = %q, err = %v", got, err)
+	}
+}
@@ -1,120 +1,122 @@
 package services
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"strings"
-	"time"
 )
 
-type BaiduOCRService struct {
-	apiKey    string
-	secretKey string
-	token     string
-	tokenExp  time.Time
-}
+// 外部服务名称，用于错误信息、限流与用量统计
+const (
+	ProviderBaiduOCR = "baidu_ocr"
+	ProviderDeepSeek = "deepseek"
+)
 
-type BaiduTokenResponse struct {
-	AccessToken string `json:"access_token"`
-	ExpiresIn   int    `json:"expires_in"`
+const baiduOCRURL = "https://aip.baidubce.com/rest/2.0/ocr/v1/accurate_basic"
+
+type BaiduOCRService struct {
+	tokens *BaiduTokenCache
+	apiURL string
 }
 
 type BaiduOCRResponse struct {
 	WordsResult []struct {
-		Words string `json:"words"`
+		Words       string `json:"words"`
+		Probability *struct {
+			Average float64 `json:"average"`
+		} `json:"probability"`
 	} `json:"words_result"`
 	ErrorCode int    `json:"error_code,omitempty"`
 	ErrorMsg  string `json:"error_msg,omitempty"`
 }
 
-func NewBaiduOCRService(apiKey, secretKey string) *BaiduOCRService {
-	return &BaiduOCRService{
-		apiKey:    apiKey,
-		secretKey: secretKey,
-	}
+// OCRResult 是识别出的文本与各行识别置信度的平均值
+type OCRResult struct {
+	Text       string
+	Confidence float64
 }
 
-func (s *BaiduOCRService) GetAccessToken() error {
-	if s.apiKey == "" || s.secretKey == "" {
-		return errors.New("Baidu OCR credentials not configured")
-	}
-
-	if s.token != "" && time.Now().Before(s.tokenExp) {
-		return nil
-	}
-
-	url := fmt.Sprintf("https://aip.baidubce.com/oauth/2.0/token?grant_type=client_credentials&client_id=%s&client_secret=%s",
-		s.apiKey, s.secretKey)
-
-	resp, err := http.Get(url)
-	if err != nil {
-		return fmt.Errorf("failed to get access token: %w", err)
-	}
-	defer resp.Body.Close()
+func NewBaiduOCRService(tokens *BaiduTokenCache) *BaiduOCRService {
+	return &BaiduOCRService{tokens: tokens, apiURL: baiduOCRURL}
+}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to read response body: %w", err)
-	}
+func (s *BaiduOCRService) Configured() bool {
+	return s.tokens.Configured()
+}
 
-	var tokenResp BaiduTokenResponse
-	if err := json.Unmarshal(body, &tokenResp); err != nil {
-		return fmt.Errorf("failed to parse token response: %w", err)
+// RecognizeText 识别图片文字；token 失效时作废缓存并重试一次
+func (s *BaiduOCRService) RecognizeText(ctx context.Context, imageData []byte) (string, error) {
+	res, err := s.Recognize(ctx, imageData)
+	if perr, ok := err.(*ProviderError); ok && IsBaiduTokenError(perr.Code) {
+		res, err = s.Recognize(ctx, imageData)
 	}
-
-	s.token = tokenResp.AccessToken
-	s.tokenExp = time.Now().Add(time.Duration(tokenResp.ExpiresIn-300) * time.Second) // 提前5分钟过期
-
-	return nil
+	return res.Text, err
 }
 
-func (s *BaiduOCRService) RecognizeText(imageData []byte) (string, error) {
-	if err := s.GetAccessToken(); err != nil {
-		return "", err
+// Recognize 调用高精度识别接口一次，服务端错误以 *ProviderError 返回；
+// token 失效时先作废缓存，由调用方的重试策略决定是否重试
+func (s *BaiduOCRService) Recognize(ctx context.Context, imageData []byte) (OCRResult, error) {
+	if !s.tokens.Configured() {
+		return OCRResult{}, fmt.Errorf("缺少 BAIDU_API_KEY/BAIDU_SECRET_KEY")
+	}
+	token, err := s.tokens.Token(ctx)
+	if err != nil {
+		return OCRResult{}, fmt.Errorf("获取百度 token 失败: %w", err)
 	}
-
-	apiURL := fmt.Sprintf("https://aip.baidubce.com/rest/2.0/ocr/v1/general_basic?access_token=%s", s.token)
 
 	form := url.Values{}
 	form.Set("image", base64.StdEncoding.EncodeToString(imageData))
-
-	req, err := http.NewRequest("POST", apiURL, strings.NewReader(form.Encode()))
+	form.Set("language_type", "CHN_ENG")
+	form.Set("probability", "true")
+	req, err := http.NewRequestWithContext(ctx, "POST", s.apiURL+"?access_token="+token, strings.NewReader(form.Encode()))
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return OCRResult{}, err
 	}
-
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to send request: %w", err)
+		return OCRResult{}, err
 	}
 	defer resp.Body.Close()
-
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("failed to read response: %w", err)
+		return OCRResult{}, err
+	}
+	if resp.StatusCode >= 300 {
+		return OCRResult{}, &ProviderError{Provider: ProviderBaiduOCR, StatusCode: resp.StatusCode, Message: string(body)}
 	}
 
 	var ocrResp BaiduOCRResponse
 	if err := json.Unmarshal(body, &ocrResp); err != nil {
-		return "", fmt.Errorf("failed to parse OCR response: %w", err)
+		return OCRResult{}, fmt.Errorf("解析 OCR 响应失败: %v", err)
 	}
-
 	if ocrResp.ErrorCode != 0 {
-		return "", fmt.Errorf("OCR API error: %d - %s", ocrResp.ErrorCode, ocrResp.ErrorMsg)
+		if IsBaiduTokenError(ocrResp.ErrorCode) {
+			s.tokens.Invalidate(token)
+		}
+		return OCRResult{}, &ProviderError{Provider: ProviderBaiduOCR, Code: ocrResp.ErrorCode, Message: ocrResp.ErrorMsg}
 	}
-
-	var result string
-	for _, word := range ocrResp.WordsResult {
-		result += word.Words + "\n"
+	if len(ocrResp.WordsResult) == 0 {
+		return OCRResult{}, fmt.Errorf("未识别到文本")
 	}
 
-	return result, nil
+	lines := make([]string, 0, len(ocrResp.WordsResult))
+	probSum, probCount := 0.0, 0
+	for _, w := range ocrResp.WordsResult {
+		lines = append(lines, w.Words)
+		if w.Probability != nil {
+			probSum += w.Probability.Average
+			probCount++
+		}
+	}
+	confidence := 1.0
+	if probCount > 0 {
+		confidence = probSum / float64(probCount)
+	}
+	return OCRResult{Text: strings.Join(lines, "\n"), Confidence: confidence}, nil
 }
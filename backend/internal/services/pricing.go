@@ -0,0 +1,84 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// TokenUsage 对应 OpenAI 兼容接口返回的 usage 字段；DeepSeek 额外返回命中缓存的输入 token 数
+type TokenUsage struct {
+	PromptTokens         int `json:"prompt_tokens"`
+	CompletionTokens     int `json:"completion_tokens"`
+	TotalTokens          int `json:"total_tokens"`
+	PromptCacheHitTokens int `json:"prompt_cache_hit_tokens"`
+}
+
+func (u *TokenUsage) Add(o TokenUsage) {
+	u.PromptTokens += o.PromptTokens
+	u.CompletionTokens += o.CompletionTokens
+	u.TotalTokens += o.TotalTokens
+	u.PromptCacheHitTokens += o.PromptCacheHitTokens
+}
+
+// ModelPrice 是每百万 token 的单价；CachedInput 为 0 时命中缓存的输入按 Input 计价
+type ModelPrice struct {
+	Input       float64 `json:"input"`
+	CachedInput float64 `json:"cachedInput"`
+	Output      float64 `json:"output"`
+}
+
+// PriceTable 按模型名查单价，所有价格使用同一币种
+type PriceTable struct {
+	Currency string                `json:"currency"`
+	Models   map[string]ModelPrice `json:"models"`
+}
+
+// DefaultPriceTable 为 DeepSeek 官网标价（人民币/百万 token），价格调整时可用配置覆盖
+func DefaultPriceTable() PriceTable {
+	return PriceTable{
+		Currency: "CNY",
+		Models: map[string]ModelPrice{
+			"deepseek-chat":     {Input: 2, CachedInput: 0.2, Output: 3},
+			"deepseek-reasoner": {Input: 2, CachedInput: 0.2, Output: 3},
+		},
+	}
+}
+
+// ParsePriceTable 解析 JSON 配置并覆盖默认价格表中的同名模型，
+// 如 {"currency":"CNY","models":{"deepseek-chat":{"input":2,"cachedInput":0.2,"output":3}}}
+func ParsePriceTable(raw string) (PriceTable, error) {
+	table := DefaultPriceTable()
+	if raw == "" {
+		return table, nil
+	}
+	var override PriceTable
+	if err := json.Unmarshal([]byte(raw), &override); err != nil {
+		return table, fmt.Errorf("invalid price table: %w", err)
+	}
+	if override.Currency != "" {
+		table.Currency = override.Currency
+	}
+	for model, price := range override.Models {
+		table.Models[model] = price
+	}
+	return table, nil
+}
+
+// Cost 计算一次调用的费用；未知模型返回 0 和 false
+func (p PriceTable) Cost(model string, u TokenUsage) (float64, bool) {
+	price, ok := p.Models[model]
+	if !ok {
+		return 0, false
+	}
+	cached := price.CachedInput
+	if cached == 0 {
+		cached = price.Input
+	}
+	hits := u.PromptCacheHitTokens
+	if hits > u.PromptTokens {
+		hits = u.PromptTokens
+	}
+	cost := (float64(u.PromptTokens-hits)*price.Input + float64(hits)*cached + float64(u.CompletionTokens)*price.Output) / 1e6
+	return math.Round(cost*1e6) / 1e6, true
+}
@@ -0,0 +1,66 @@
+package services
+
+import "testing"
+
+func TestPriceTableCost(t *testing.T) {
+	table := PriceTable{
+		Currency: "CNY",
+		Models: map[string]ModelPrice{
+			"cached":   {Input: 2, CachedInput: 0.2, Output: 3},
+			"uncached": {Input: 2, Output: 3},
+		},
+	}
+	tests := []struct {
+		name   string
+		model  string
+		usage  TokenUsage
+		want   float64
+		wantOK bool
+	}{
+		{"unknown model", "gpt-x", TokenUsage{PromptTokens: 1000}, 0, false},
+		{"no tokens", "cached", TokenUsage{}, 0, true},
+		{"input and output", "cached", TokenUsage{PromptTokens: 1_000_000, CompletionTokens: 1_000_000}, 5, true},
+		{"cache hits at cached price", "cached", TokenUsage{PromptTokens: 1_000_000, PromptCacheHitTokens: 500_000}, 1.1, true},
+		{"no cached price falls back to input", "uncached", TokenUsage{PromptTokens: 1_000_000, PromptCacheHitTokens: 500_000}, 2, true},
+		{"hits capped at prompt tokens", "cached", TokenUsage{PromptTokens: 1000, PromptCacheHitTokens: 5000}, 0.0002, true},
+		{"rounded to six decimals", "cached", TokenUsage{PromptTokens: 1, CompletionTokens: 1}, 0.000005, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := table.Cost(tt.model, tt.usage)
+			if got != tt.want || ok != tt.wantOK {
+				t.Fatalf("Cost = %v, %v; want %v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestParsePriceTable(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      string
+		currency string
+		model    string
+		want     ModelPrice
+		wantErr  bool
+	}{
+		{"default", "", "CNY", "deepseek-chat", ModelPrice{Input: 2, CachedInput: 0.2, Output: 3}, false},
+		{"override model", `{"models":{"deepseek-chat":{"input":4,"output":8}}}`, "CNY", "deepseek-chat", ModelPrice{Input: 4, Output: 8}, false},
+		{"add model keeps defaults", `{"currency":"USD","models":{"m":{"input":1}}}`, "USD", "deepseek-reasoner", ModelPrice{Input: 2, CachedInput: 0.2, Output: 3}, false},
+		{"invalid json", `{`, "", "", ModelPrice{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table, err := ParsePriceTable(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if table.Currency != tt.currency || table.Models[tt.model] != tt.want {
+				t.Fatalf("table = %+v, want currency %s and %s = %+v", table, tt.currency, tt.model, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package services
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// ProviderLimiter 限制对单个外部服务的调用：令牌桶控制 QPS，信号量控制同时在途的请求数
+type ProviderLimiter struct {
+	qps   float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+
+	slots chan struct{}
+}
+
+// NewProviderLimiter qps<=0 表示不限速，concurrency<=0 表示不限并发
+func NewProviderLimiter(qps float64, burst, concurrency int) *ProviderLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	l := &ProviderLimiter{
+		qps:    qps,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+	if concurrency > 0 {
+		l.slots = make(chan struct{}, concurrency)
+	}
+	return l
+}
+
+// Acquire 等待并发名额和令牌，返回归还并发名额的函数；ctx 结束时放弃等待
+func (l *ProviderLimiter) Acquire(ctx context.Context) (func(), error) {
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	release := func() {
+		if l.slots != nil {
+			<-l.slots
+		}
+	}
+	if err := l.wait(ctx); err != nil {
+		release()
+		return nil, err
+	}
+	return release, nil
+}
+
+// wait 预留一个令牌，不足时按欠缺的量计算需要等待的时间；取消时归还预留
+func (l *ProviderLimiter) wait(ctx context.Context) error {
+	if l.qps <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.qps)
+	l.last = now
+	l.tokens--
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.qps * float64(time.Second))
+	}
+	l.mu.Unlock()
+	if delay == 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		l.tokens++
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
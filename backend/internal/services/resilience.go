@@ -0,0 +1,241 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// 百度接口的可重试错误码：1 未知错误、2 服务暂不可用、18 QPS 超限、282000 服务内部错误
+var baiduUnavailableCodes = map[int]bool{1: true, 2: true, 18: true, 282000: true}
+
+var ErrCircuitOpen = errors.New("provider circuit open")
+
+// ProviderError 是外部服务返回的错误，StatusCode 为 HTTP 状态码，Code 为服务商的业务错误码
+type ProviderError struct {
+	Provider   string
+	StatusCode int
+	Code       int
+	Message    string
+}
+
+func (e *ProviderError) Error() string {
+	switch {
+	case e.Code != 0:
+		return fmt.Sprintf("%s 返回错误 %d: %s", e.Provider, e.Code, e.Message)
+	case e.StatusCode != 0:
+		return fmt.Sprintf("%s 返回 HTTP %d: %s", e.Provider, e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("%s 返回错误: %s", e.Provider, e.Message)
+}
+
+// Unavailable 表示服务端过载或故障，计入熔断
+func (e *ProviderError) Unavailable() bool {
+	return e.StatusCode == 429 || e.StatusCode >= 500 || baiduUnavailableCodes[e.Code]
+}
+
+// Retryable 服务不可用或 token 失效（已作废缓存，下次会取新 token）时可以重试
+func (e *ProviderError) Retryable() bool {
+	return e.Unavailable() || IsBaiduTokenError(e.Code)
+}
+
+// IsRetryable 判断一次调用失败后是否值得重试；调用方自身取消或超时不重试
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var perr *ProviderError
+	if errors.As(err, &perr) {
+		return perr.Retryable()
+	}
+	return isNetworkError(err)
+}
+
+// isUnavailable 判断错误是否说明服务不可用，只有这类错误计入熔断
+func isUnavailable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var perr *ProviderError
+	if errors.As(err, &perr) {
+		return perr.Unavailable()
+	}
+	return isNetworkError(err)
+}
+
+func isNetworkError(err error) bool {
+	var nerr net.Error
+	if errors.As(err, &nerr) {
+		return true
+	}
+	var uerr *url.Error
+	if errors.As(err, &uerr) {
+		return true
+	}
+	return errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF)
+}
+
+// 熔断器状态
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half_open"
+)
+
+// CircuitBreaker 连续失败达到阈值后打开，冷却期内的调用等待而不是直接失败（相当于暂停队列）；
+// 冷却结束后放行一个探测请求，成功则关闭，失败则重新打开
+type CircuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	state     string
+	failures  int
+	openUntil time.Time
+	probing   bool
+	lastError string
+}
+
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &CircuitBreaker{threshold: threshold, cooldown: cooldown, state: BreakerClosed}
+}
+
+// BreakerSnapshot 是熔断器当前状态，用于健康检查
+type BreakerSnapshot struct {
+	State     string `json:"state"`
+	Failures  int    `json:"failures"`
+	OpenUntil string `json:"openUntil,omitempty"`
+	LastError string `json:"lastError,omitempty"`
+}
+
+func (b *CircuitBreaker) Snapshot() BreakerSnapshot {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := BreakerSnapshot{State: b.state, Failures: b.failures, LastError: b.lastError}
+	if b.state == BreakerOpen {
+		s.OpenUntil = b.openUntil.Format(time.RFC3339)
+	}
+	return s
+}
+
+// allow 返回是否放行；不放行时返回建议的等待时间
+func (b *CircuitBreaker) allow() (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		if wait := time.Until(b.openUntil); wait > 0 {
+			return false, wait
+		}
+		b.state = BreakerHalfOpen
+		b.probing = true
+		return true, 0
+	case BreakerHalfOpen:
+		if b.probing {
+			return false, time.Second
+		}
+		b.probing = true
+		return true, 0
+	}
+	return true, 0
+}
+
+// Wait 阻塞到熔断器放行或 ctx 结束
+func (b *CircuitBreaker) Wait(ctx context.Context) error {
+	for {
+		ok, wait := b.allow()
+		if ok {
+			return nil
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%w: %w", ErrCircuitOpen, ctx.Err())
+		}
+	}
+}
+
+// Record 记录一次调用结果；只有服务不可用类错误计入失败
+func (b *CircuitBreaker) Record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if !isUnavailable(err) {
+		if err == nil || b.state == BreakerHalfOpen {
+			b.state = BreakerClosed
+			b.failures = 0
+		}
+		return
+	}
+	b.failures++
+	b.lastError = err.Error()
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		b.state = BreakerOpen
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+}
+
+// RetryPolicy 是带抖动的指数退避重试策略
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.BaseDelay << (attempt - 1)
+	if d <= 0 || (p.MaxDelay > 0 && d > p.MaxDelay) {
+		d = p.MaxDelay
+	}
+	// 在 [d/2, d) 之间随机，避免大量请求同时重试
+	half := int64(d / 2)
+	if half <= 0 {
+		return d
+	}
+	return time.Duration(half + rand.Int63n(half))
+}
+
+// Do 经过熔断器执行 fn，可重试的错误按退避策略重试，返回最后一次的错误
+func (p RetryPolicy) Do(ctx context.Context, breaker *CircuitBreaker, fn func(ctx context.Context) error) error {
+	attempts := p.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if breaker != nil {
+			if werr := breaker.Wait(ctx); werr != nil {
+				if err != nil {
+					return fmt.Errorf("%w (last error: %v)", werr, err)
+				}
+				return werr
+			}
+		}
+		err = fn(ctx)
+		if breaker != nil {
+			breaker.Record(err)
+		}
+		if err == nil || !IsRetryable(err) || attempt == attempts {
+			return err
+		}
+		timer := time.NewTimer(p.backoff(attempt))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+	}
+	return err
+}
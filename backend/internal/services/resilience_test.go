@@ -0,0 +1,157 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+var (
+	errUnavailable = &ProviderError{Provider: "DeepSeek", StatusCode: 503, Message: "overloaded"}
+	errBadRequest  = &ProviderError{Provider: "DeepSeek", StatusCode: 400, Message: "bad request"}
+)
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	const cooldown = 20 * time.Millisecond
+	type step struct {
+		action    string // fail、ok、client、cooldown 或 allow
+		wantState string
+		wantAllow bool
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"opens at threshold", []step{
+			{action: "fail", wantState: BreakerClosed},
+			{action: "fail", wantState: BreakerOpen},
+			{action: "allow", wantState: BreakerOpen, wantAllow: false},
+		}},
+		{"success resets failures", []step{
+			{action: "fail", wantState: BreakerClosed},
+			{action: "ok", wantState: BreakerClosed},
+			{action: "fail", wantState: BreakerClosed},
+		}},
+		{"client errors do not count", []step{
+			{action: "client", wantState: BreakerClosed},
+			{action: "client", wantState: BreakerClosed},
+			{action: "client", wantState: BreakerClosed},
+		}},
+		{"half open probe succeeds", []step{
+			{action: "fail"}, {action: "fail", wantState: BreakerOpen},
+			{action: "cooldown"},
+			{action: "allow", wantState: BreakerHalfOpen, wantAllow: true},
+			// 探测进行中时不放行其他调用
+			{action: "allow", wantState: BreakerHalfOpen, wantAllow: false},
+			{action: "ok", wantState: BreakerClosed},
+			{action: "allow", wantState: BreakerClosed, wantAllow: true},
+		}},
+		{"half open probe fails", []step{
+			{action: "fail"}, {action: "fail", wantState: BreakerOpen},
+			{action: "cooldown"},
+			{action: "allow", wantState: BreakerHalfOpen, wantAllow: true},
+			{action: "fail", wantState: BreakerOpen},
+			{action: "allow", wantState: BreakerOpen, wantAllow: false},
+		}},
+		{"half open client error closes", []step{
+			{action: "fail"}, {action: "fail", wantState: BreakerOpen},
+			{action: "cooldown"},
+			{action: "allow", wantState: BreakerHalfOpen, wantAllow: true},
+			{action: "client", wantState: BreakerClosed},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewCircuitBreaker(2, cooldown)
+			for i, s := range tt.steps {
+				switch s.action {
+				case "fail":
+					b.Record(errUnavailable)
+				case "ok":
+					b.Record(nil)
+				case "client":
+					b.Record(errBadRequest)
+				case "cooldown":
+					time.Sleep(cooldown + 5*time.Millisecond)
+					continue
+				case "allow":
+					if ok, _ := b.allow(); ok != s.wantAllow {
+						t.Fatalf("step %d: allow = %v, want %v", i, ok, s.wantAllow)
+					}
+				}
+				if s.wantState != "" {
+					if got := b.Snapshot().State; got != s.wantState {
+						t.Fatalf("step %d (%s): state = %s, want %s", i, s.action, got, s.wantState)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerWaitHonoursContext(t *testing.T) {
+	b := NewCircuitBreaker(1, time.Hour)
+	b.Record(errUnavailable)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := b.Wait(ctx)
+	if !errors.Is(err, ErrCircuitOpen) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Wait = %v, want ErrCircuitOpen wrapping DeadlineExceeded", err)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"canceled", context.Canceled, false},
+		{"deadline", fmt.Errorf("call: %w", context.DeadlineExceeded), false},
+		{"http 503", errUnavailable, true},
+		{"http 429", &ProviderError{StatusCode: 429}, true},
+		{"http 400", errBadRequest, false},
+		{"baidu qps limit", &ProviderError{Code: 18}, true},
+		{"baidu bad image", &ProviderError{Code: 216201}, false},
+		{"wrapped provider error", fmt.Errorf("ocr: %w", errUnavailable), true},
+		{"plain error", errors.New("parse failed"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRetryable(tt.err); got != tt.want {
+				t.Fatalf("IsRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 2 * time.Millisecond}
+	tests := []struct {
+		name      string
+		errs      []error
+		wantCalls int
+		wantErr   error
+	}{
+		{"first try", []error{nil}, 1, nil},
+		{"retry then succeed", []error{errUnavailable, nil}, 2, nil},
+		{"give up after max attempts", []error{errUnavailable, errUnavailable, errUnavailable}, 3, errUnavailable},
+		{"no retry on client error", []error{errBadRequest}, 1, errBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := policy.Do(context.Background(), nil, func(context.Context) error {
+				err := tt.errs[calls]
+				calls++
+				return err
+			})
+			if calls != tt.wantCalls || !errors.Is(err, tt.wantErr) {
+				t.Fatalf("calls = %d, err = %v; want %d, %v", calls, err, tt.wantCalls, tt.wantErr)
+			}
+		})
+	}
+}
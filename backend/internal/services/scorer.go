@@ -0,0 +1,153 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+)
+
+// 评分所用模型与提示词版本，随每次 AI 评分写入历史
+const (
+	DeepSeekChatModel  = "deepseek-chat"
+	ScorePromptVersion = "score-json-v1"
+)
+
+// 模型未按 JSON 输出、或未给出有效把握程度时使用的置信度
+const unstructuredConfidence = 0.5
+
+// ScoreResult 是一次评分的结构化结果
+type ScoreResult struct {
+	Score      int     `json:"score"`
+	Feedback   string  `json:"feedback"`
+	Confidence float64 `json:"confidence"`
+	// 接口返回的 token 用量，不从模型输出中解析
+	Usage TokenUsage `json:"-"`
+}
+
+// BuildScorePrompt 生成评分提示词；rubric 为空时使用通用的 0-100 评分要求
+func BuildScorePrompt(subject, answer, rubric string) string {
+	var b strings.Builder
+	b.WriteString("你是一名阅卷老师，请根据学生答案给出0-100的分数并简要反馈，同时给出你对该评分的把握程度（0-1之间的小数，答案模糊、识别不清或难以判断时应给低值）。\n")
+	fmt.Fprintf(&b, "【科目】%s\n", subject)
+	if rubric = strings.TrimSpace(rubric); rubric != "" {
+		fmt.Fprintf(&b, "【评分标准】%s\n请严格按评分标准给分，忽略 OCR 产生的明显错别字。\n", rubric)
+	}
+	fmt.Fprintf(&b, "【学生答案】%s\n", answer)
+	b.WriteString(`请只输出JSON：{"score": 分数, "confidence": 把握程度, "feedback": "简短中文反馈"}`)
+	return b.String()
+}
+
+// Score 调用一次评分接口，服务端错误以 *ProviderError 返回，由调用方决定是否重试
+func (s *DeepSeekService) Score(ctx context.Context, subject, answer, rubric string) (ScoreResult, error) {
+	if s.apiKey == "" {
+		return ScoreResult{}, fmt.Errorf("缺少 DEEPSEEK_API_KEY")
+	}
+	payload := map[string]interface{}{
+		"model": DeepSeekChatModel,
+		"messages": []map[string]string{
+			{"role": "user", "content": BuildScorePrompt(subject, answer, rubric)},
+		},
+		"temperature":     0.2,
+		"response_format": map[string]string{"type": "json_object"},
+	}
+	bodyBytes, err := json.Marshal(payload)
+	if err != nil {
+		return ScoreResult{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", s.baseURL+"/chat/completions", bytes.NewReader(bodyBytes))
+	if err != nil {
+		return ScoreResult{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return ScoreResult{}, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return ScoreResult{}, err
+	}
+	if resp.StatusCode >= 300 {
+		return ScoreResult{}, &ProviderError{Provider: ProviderDeepSeek, StatusCode: resp.StatusCode, Message: string(respBody)}
+	}
+
+	var dsResp DeepSeekResponse
+	if err := json.Unmarshal(respBody, &dsResp); err != nil {
+		return ScoreResult{}, fmt.Errorf("解析 DeepSeek 响应失败: %v", err)
+	}
+	if len(dsResp.Choices) == 0 {
+		return ScoreResult{}, fmt.Errorf("DeepSeek 无返回内容")
+	}
+	result := ParseScoreContent(dsResp.Choices[0].Message.Content)
+	result.Usage = dsResp.Usage
+	return result, nil
+}
+
+// ParseScoreContent 解析模型输出；不是合法 JSON 时退回到提取首个数字，并视为低置信度
+func ParseScoreContent(content string) ScoreResult {
+	trimmed := strings.TrimSpace(content)
+	trimmed = strings.TrimPrefix(trimmed, "```json")
+	trimmed = strings.TrimPrefix(trimmed, "```")
+	trimmed = strings.TrimSuffix(trimmed, "```")
+
+	var result ScoreResult
+	if err := json.Unmarshal([]byte(strings.TrimSpace(trimmed)), &result); err != nil {
+		return ScoreResult{
+			Score:      clampScore(extractFirstNumber(content)),
+			Feedback:   content,
+			Confidence: unstructuredConfidence,
+		}
+	}
+	result.Score = clampScore(result.Score)
+	if result.Confidence <= 0 || result.Confidence > 1 {
+		result.Confidence = unstructuredConfidence
+	}
+	return result
+}
+
+func clampScore(score int) int {
+	if score < 0 {
+		return 0
+	}
+	if score > 100 {
+		return 100
+	}
+	return score
+}
+
+func extractFirstNumber(s string) int {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			continue
+		}
+		num := 0
+		for j := i; j < len(s) && s[j] >= '0' && s[j] <= '9'; j++ {
+			num = num*10 + int(s[j]-'0')
+		}
+		return num
+	}
+	return 0
+}
+
+// PassAgreement 将两次评分的分差映射为 0-1 的一致性，分差达到 20 分视为完全不一致
+func PassAgreement(a, b int) float64 {
+	diff := math.Abs(float64(a - b))
+	return math.Max(0, 1-diff/20)
+}
+
+// CombineConfidence 取各信号中的最小值，任一环节不可靠即整体不可靠
+func CombineConfidence(signals ...float64) float64 {
+	confidence := 1.0
+	for _, s := range signals {
+		confidence = math.Min(confidence, s)
+	}
+	return math.Round(confidence*100) / 100
+}
@@ -0,0 +1,70 @@
+package services
+
+import "testing"
+
+func TestParseScoreContent(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    ScoreResult
+	}{
+		{"json", `{"score":85,"feedback":"步骤完整","confidence":0.9}`, ScoreResult{Score: 85, Feedback: "步骤完整", Confidence: 0.9}},
+		{"fenced json", "```json\n{\"score\":70,\"feedback\":\"ok\",\"confidence\":0.8}\n```", ScoreResult{Score: 70, Feedback: "ok", Confidence: 0.8}},
+		{"bare fence", "```\n{\"score\":60,\"confidence\":1}\n```", ScoreResult{Score: 60, Confidence: 1}},
+		{"score clamped", `{"score":130,"confidence":0.7}`, ScoreResult{Score: 100, Confidence: 0.7}},
+		{"negative score", `{"score":-5,"confidence":0.7}`, ScoreResult{Score: 0, Confidence: 0.7}},
+		{"missing confidence", `{"score":50}`, ScoreResult{Score: 50, Confidence: unstructuredConfidence}},
+		{"confidence above 1", `{"score":50,"confidence":3}`, ScoreResult{Score: 50, Confidence: unstructuredConfidence}},
+		{"plain text", "得分：78分，书写工整", ScoreResult{Score: 78, Feedback: "得分：78分，书写工整", Confidence: unstructuredConfidence}},
+		{"plain text over 100", "总分 250", ScoreResult{Score: 100, Feedback: "总分 250", Confidence: unstructuredConfidence}},
+		{"no number", "无法评分", ScoreResult{Score: 0, Feedback: "无法评分", Confidence: unstructuredConfidence}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseScoreContent(tt.content); got != tt.want {
+				t.Fatalf("ParseScoreContent = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPassAgreement(t *testing.T) {
+	tests := []struct {
+		a, b int
+		want float64
+	}{
+		{80, 80, 1},
+		{80, 90, 0.5},
+		{90, 80, 0.5},
+		{80, 95, 0.25},
+		{60, 80, 0},
+		{0, 100, 0},
+	}
+	for _, tt := range tests {
+		if got := PassAgreement(tt.a, tt.b); got != tt.want {
+			t.Errorf("PassAgreement(%d, %d) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestCombineConfidence(t *testing.T) {
+	tests := []struct {
+		name    string
+		signals []float64
+		want    float64
+	}{
+		{"no signals", nil, 1},
+		{"single", []float64{0.8}, 0.8},
+		{"minimum wins", []float64{0.9, 0.4, 0.7}, 0.4},
+		{"rounded", []float64{0.876}, 0.88},
+		{"capped at 1", []float64{1.5}, 1},
+		{"zero", []float64{0.9, 0}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CombineConfidence(tt.signals...); got != tt.want {
+				t.Fatalf("CombineConfidence(%v) = %v, want %v", tt.signals, got, tt.want)
+			}
+		})
+	}
+}
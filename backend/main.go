@@ -4,21 +4,57 @@ import (
 	"auto-grad-backend/internal/api"
 	"auto-grad-backend/internal/config"
 	"auto-grad-backend/internal/db"
+	"auto-grad-backend/internal/events"
+	"auto-grad-backend/internal/logging"
+	"context"
+	"flag"
+	"fmt"
 	"github.com/gofiber/fiber/v2"
 	"github.com/joho/godotenv"
-	"log"
+	"log/slog"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 )
 
 func main() {
+	configPath := flag.String("config", "", "配置文件路径（.yaml/.yml/.toml），默认读取 CONFIG_FILE")
+	flag.Parse()
+	args := flag.Args()
+
 	// 加载本地 .env（环境变量优先）
 	_ = godotenv.Load(".env")
 
-	cfg := config.LoadConfig()
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	logging.Setup(cfg.Log.Level, cfg.Log.Format)
+
+	// 子命令：migrate status|up|down，config print|check，admin users|gradings
+	if len(args) > 0 {
+		switch args[0] {
+		case "migrate":
+			os.Exit(runMigrateCommand(cfg, args[1:]))
+		case "config":
+			os.Exit(runConfigCommand(cfg, args[1:]))
+		case "admin":
+			os.Exit(runAdminCommand(cfg, args[1:]))
+		}
+	}
+
+	// 配置不合法（包括生产环境使用默认密钥）时拒绝启动
+	if err := cfg.Validate(); err != nil {
+		slog.Error("invalid configuration", "env", cfg.Env, "err", err)
+		os.Exit(1)
+	}
+
 	pool, err := db.InitPostgres(cfg)
 	if err != nil {
-		log.Fatalf("failed to init postgres: %v", err)
+		slog.Error("failed to init postgres", "err", err)
+		os.Exit(1)
 	}
 
 	// 创建Fiber应用
@@ -32,29 +68,75 @@ func main() {
 				"error": err.Error(),
 			})
 		},
-		ReadTimeout:  30 * time.Second,
-		WriteTimeout: 30 * time.Second,
-		IdleTimeout:  60 * time.Second,
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
+		IdleTimeout:  cfg.Server.IdleTimeout,
+		// 只信任配置的反向代理转发的客户端 IP，登录锁定与日志据此区分来源
+		EnableTrustedProxyCheck: true,
+		TrustedProxies:          cfg.Server.TrustedProxyList(),
+		ProxyHeader:             cfg.Server.ProxyHeader,
+		EnableIPValidation:      true,
 	})
 
 	// 设置统一系统路由（包含家长端和教师端）
-	api.SetupUnifiedRoutes(app, pool)
+	api.SetupUnifiedRoutes(app, pool, cfg)
+
+	// 继续处理上次停机时排队的改卷
+	resumeCtx, cancelResume := context.WithTimeout(context.Background(), cfg.Database.Timeout)
+	if n, err := api.ResumeQueuedGradings(resumeCtx); err != nil {
+		slog.Error("failed to resume queued gradings", "err", err)
+	} else if n > 0 {
+		slog.Info("resumed queued gradings", "count", n)
+	}
+	cancelResume()
 
 	// 静态文件服务（模拟）
-	app.Static("/uploads", "./uploads")
+	app.Static("/uploads", cfg.Storage.UploadDir)
 
 	// 启动服务器
-	port := os.Getenv("SERVER_PORT")
-	if port == "" {
-		port = "8080"
+	port := cfg.Server.Port
+	slog.Info("server starting", "addr", ":"+port, "env", cfg.Env, "health", "/health/ready", "metrics", "/metrics")
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	// 重试上次停机前未送达的 Webhook，收到停止信号后结束
+	retriesDone := make(chan struct{})
+	go func() {
+		defer close(retriesDone)
+		api.RunWebhookRetries(ctx)
+	}()
+	defer stop()
+	listenErr := make(chan error, 1)
+	go func() { listenErr <- app.Listen(":" + port) }()
+	select {
+	case err := <-listenErr:
+		slog.Error("server stopped", "err", err)
+		pool.Close()
+		os.Exit(1)
+	case <-ctx.Done():
+	}
+	// 恢复默认信号处理，再次收到信号时立即退出
+	stop()
+
+	// 停止接收新请求，同时等待进行中的请求与改卷，到期后中断并把未完成的改卷重新排队
+	slog.Info("shutting down", "timeout", cfg.Server.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	httpDone := make(chan struct{})
+	go func() {
+		defer close(httpDone)
+		if err := app.ShutdownWithContext(shutdownCtx); err != nil {
+			slog.Warn("http shutdown incomplete", "err", err)
+		}
+	}()
+	requeued := api.DrainGradings(shutdownCtx)
+	<-httpDone
+	<-retriesDone
+	// 等待 Webhook、邮件等事件回调处理完停机前发布的事件（含刚重新排队的）；此时 shutdownCtx 可能已到期
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFlush()
+	if !events.Default.Flush(flushCtx) {
+		slog.Warn("event listeners did not finish before shutdown")
 	}
-	log.Printf("🚀 智能改卷统一系统启动成功!")
-	log.Printf("📍 服务地址: http://localhost:%s", port)
-	log.Printf("🔗 API文档: http://localhost:%s/api", port)
-	log.Printf("👨‍🏫 教师端: http://localhost:%s/api/teacher/dashboard", port)
-	log.Printf("👨‍👩‍👧‍👦 家长端: http://localhost:%s/api/parent/dashboard", port)
-	log.Printf("❤️ 健康检查: http://localhost:%s/health", port)
-	log.Printf("🔐 用户登录: http://localhost:%s/api/auth/login", port)
-
-	log.Fatal(app.Listen(":" + port))
+	pool.Close()
+	slog.Info("shutdown complete", "requeued", requeued)
 }
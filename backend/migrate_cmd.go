@@ -0,0 +1,87 @@
+package main
+
+import (
+	"auto-grad-backend/internal/config"
+	"auto-grad-backend/internal/db"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+)
+
+const migrateUsage = `usage: auto-grad-backend [-config file] migrate <command>
+
+commands:
+  status        列出所有迁移及其应用状态
+  up            应用所有未执行的迁移
+  down [n]      回滚最近的 n 个迁移（默认 1）`
+
+// runMigrateCommand 处理 migrate 子命令，返回进程退出码
+func runMigrateCommand(cfg *config.Config, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	pool, err := db.Connect(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer pool.Close()
+	ctx := context.Background()
+
+	switch args[0] {
+	case "status":
+		states, err := db.MigrationStatus(ctx, pool)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+		for _, s := range states {
+			status, at := "pending", "-"
+			if s.Applied {
+				status, at = "applied", s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\t%s\n", s.Version, s.Name, status, at)
+		}
+		_ = w.Flush()
+	case "up":
+		applied, err := db.MigrateUp(ctx, pool)
+		for _, m := range applied {
+			fmt.Printf("applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if len(applied) == 0 {
+			fmt.Println("database is up to date")
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				fmt.Fprintln(os.Stderr, "down: n must be a positive integer")
+				return 2
+			}
+			steps = n
+		}
+		reverted, err := db.MigrateDown(ctx, pool, steps)
+		for _, m := range reverted {
+			fmt.Printf("reverted %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+	return 0
+}
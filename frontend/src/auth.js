@@ -0,0 +1,56 @@
+// 访问令牌有效期较短，过期后用刷新令牌换发；刷新令牌每次使用后轮换，需要保存新值
+
+export function saveTokens(data) {
+  localStorage.setItem("token", data.token);
+  if (data.refreshToken) {
+    localStorage.setItem("refreshToken", data.refreshToken);
+  }
+}
+
+export function clearTokens() {
+  localStorage.removeItem("token");
+  localStorage.removeItem("refreshToken");
+}
+
+// refreshSession 成功时返回 true；刷新令牌失效或已被使用时清除本地令牌
+export async function refreshSession() {
+  const refreshToken = localStorage.getItem("refreshToken");
+  if (!refreshToken) {
+    return false;
+  }
+  try {
+    const response = await fetch("/api/auth/refresh", {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({ refreshToken }),
+    });
+    if (!response.ok) {
+      clearTokens();
+      return false;
+    }
+    saveTokens(await response.json());
+    return true;
+  } catch (error) {
+    console.error("刷新登录失败:", error);
+    return false;
+  }
+}
+
+// logoutSession 通知后端撤销当前会话，失败时也会清除本地令牌
+export async function logoutSession() {
+  const token = localStorage.getItem("token");
+  const refreshToken = localStorage.getItem("refreshToken");
+  try {
+    await fetch("/api/auth/logout", {
+      method: "POST",
+      headers: {
+        "Content-Type": "application/json",
+        Authorization: `Bearer ${token}`,
+      },
+      body: JSON.stringify({ refreshToken }),
+    });
+  } catch (error) {
+    console.error("退出登录失败:", error);
+  }
+  clearTokens();
+}